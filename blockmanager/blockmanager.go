@@ -90,6 +90,36 @@ func (bm *BlockManager) WriteBlock(id BlockID, data []byte) error {
 	return nil
 }
 
+// SyncFile radi fsync fajla, tek posle toga su blokovi upisani preko WriteBlock sigurno na disku
+func (bm *BlockManager) SyncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// Truncate skracuje fajl na size bajtova i izbacuje iz kesa sve blokove od mesta skracivanja do kraja
+func (bm *BlockManager) Truncate(path string, size int64) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(path, size); err != nil {
+		return err
+	}
+
+	blockSize := int64(bm.blockSize)
+	for num := size / blockSize; num*blockSize < info.Size(); num++ {
+		bm.cache.Remove(BlockID{Path: path, Num: num})
+	}
+	return nil
+}
+
 /*
 +-------------------------+-------------------------+-------------------------+
 | Blok 0: Data             | Blok 1: Data             | Blok 2: Data             |
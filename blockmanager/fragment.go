@@ -0,0 +1,121 @@
+package blockmanager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Zapis koji ne staje u jedan blok deli se na vise uzastopnih blokova (fragmenata), kao kod LevelDB loga
+// Svaki blok koji nosi fragment pocinje zaglavljem:
+//
+// | TYPE(1) | LEN(4) | DATA | nule do kraja bloka |
+//
+// TYPE: FULL - ceo zapis je u ovom bloku
+//       FIRST, MIDDLE, LAST - prvi, srednji i poslednji deo zapisa koji se prostire kroz vise blokova
+// Blok koji je ceo od nula (TYPE = 0) je prazan
+
+const (
+	FragmentFull   byte = 1
+	FragmentFirst  byte = 2
+	FragmentMiddle byte = 3
+	FragmentLast   byte = 4
+
+	FragmentHeaderSize = 5
+)
+
+// ErrEmptyBlock se vraca kada blok ne sadrzi nijedan fragment
+var ErrEmptyBlock = errors.New("prazan blok")
+
+// FragmentCapacity vraca koliko bajtova podataka staje u jedan blok pored zaglavlja
+func (bm *BlockManager) FragmentCapacity() int {
+	return bm.blockSize - FragmentHeaderSize
+}
+
+// WriteFragmented upisuje zapis pocevsi od bloka startBlock, po potrebi u vise blokova
+// vraca broj upisanih blokova
+func (bm *BlockManager) WriteFragmented(path string, startBlock int64, data []byte) (int64, error) {
+	capacity := bm.FragmentCapacity()
+	if capacity <= 0 {
+		return 0, fmt.Errorf("blok je premali za zaglavlje fragmenta")
+	}
+
+	blocks := int64(0)
+	for first := true; first || len(data) > 0; first = false {
+		chunk := data
+		if len(chunk) > capacity {
+			chunk = chunk[:capacity]
+		}
+		data = data[len(chunk):]
+		last := len(data) == 0
+
+		var fragmentType byte
+		switch {
+		case first && last:
+			fragmentType = FragmentFull
+		case first:
+			fragmentType = FragmentFirst
+		case last:
+			fragmentType = FragmentLast
+		default:
+			fragmentType = FragmentMiddle
+		}
+
+		buf := make([]byte, FragmentHeaderSize, FragmentHeaderSize+len(chunk))
+		buf[0] = fragmentType
+		binary.LittleEndian.PutUint32(buf[1:5], uint32(len(chunk)))
+		buf = append(buf, chunk...)
+
+		if err := bm.WriteBlock(BlockID{Path: path, Num: startBlock + blocks}, buf); err != nil {
+			return blocks, err
+		}
+		blocks++
+	}
+	return blocks, nil
+}
+
+// ReadFragmented cita zapis koji pocinje u bloku blockNum i spaja njegove fragmente
+// vraca podatke i broj procitanih blokova
+func (bm *BlockManager) ReadFragmented(path string, blockNum int64) ([]byte, int64, error) {
+	var result []byte
+	blocks := int64(0)
+
+	for {
+		data, err := bm.ReadBlock(BlockID{Path: path, Num: blockNum + blocks})
+		if err != nil {
+			if blocks > 0 && errors.Is(err, io.EOF) {
+				return nil, blocks, io.ErrUnexpectedEOF // zapis je presecen na kraju fajla
+			}
+			return nil, blocks, err
+		}
+		blocks++
+
+		if len(data) < FragmentHeaderSize {
+			return nil, blocks, fmt.Errorf("blok %d je premali za zaglavlje fragmenta", blockNum+blocks-1)
+		}
+		fragmentType := data[0]
+		if fragmentType == 0 && blocks == 1 {
+			return nil, blocks, ErrEmptyBlock
+		}
+		length := int(binary.LittleEndian.Uint32(data[1:5]))
+		if FragmentHeaderSize+length > len(data) {
+			return nil, blocks, fmt.Errorf("neispravna duzina fragmenta u bloku %d", blockNum+blocks-1)
+		}
+		chunk := data[FragmentHeaderSize : FragmentHeaderSize+length]
+
+		// prvi blok mora biti FULL ili FIRST, a svaki sledeci MIDDLE ili LAST
+		switch {
+		case blocks == 1 && fragmentType == FragmentFull:
+			return chunk, blocks, nil
+		case blocks == 1 && fragmentType == FragmentFirst:
+			result = append(result, chunk...)
+		case blocks > 1 && fragmentType == FragmentMiddle:
+			result = append(result, chunk...)
+		case blocks > 1 && fragmentType == FragmentLast:
+			return append(result, chunk...), blocks, nil
+		default:
+			return nil, blocks, fmt.Errorf("neocekivan tip fragmenta %d u bloku %d", fragmentType, blockNum+blocks-1)
+		}
+	}
+}
@@ -48,6 +48,11 @@ func (bf *BloomFilter) Add(key string) {
 
 // MayContain proverava da li kljuc "mozda" postoji u filteru
 func (bf *BloomFilter) MayContain(key string) bool {
+	// prazan filter (npr. za praznu tabelu) ne sadrzi nista
+	if bf.Size == 0 {
+		return false
+	}
+
 	data := []byte(key)
 
 	// Prolazimo kroz sve hes funkcije
@@ -16,7 +16,7 @@ type LRUCache struct {
 	items    map[string]*Node // mapa za brz pristup cvorovima
 	head     *Node            // najskorije koriscen
 	tail     *Node            // najmanje koriscen
-	lock     sync.Mutex
+	lock     sync.Mutex       // i Get menja listu (pomera cvor na pocetak), pa sve metode uzimaju isti lock
 }
 
 // NewLRUCache pravi novi kes sa datim kapacitetima
@@ -31,6 +31,9 @@ func NewLRUCache(cap int) *LRUCache {
 // Ako postoji - vraca vrednost i true
 // Ako ne postoji - vraca nil i false
 func (lru *LRUCache) Get(key string) ([]byte, bool) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
 	node, exists := lru.items[key]
 	if !exists {
 		return nil, false
@@ -83,6 +86,9 @@ func (lru *LRUCache) removeNode(node *Node) {
 // Put dodaje novi kljuc i vrednost u kes
 // Ako je kes pun, uklanja se najmanje koriscen (tail)
 func (lru *LRUCache) Put(key string, value []byte) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
 	// Ako vec postoji - samo azuriraj vrednost i premesti na pocetak
 	if node, exists := lru.items[key]; exists {
 		node.value = value
@@ -127,6 +133,9 @@ func (lru *LRUCache) Put(key string, value []byte) {
 
 // Remove uklanja kljuc iz kesa ako postoji
 func (lru *LRUCache) Remove(key string) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
 	node, exists := lru.items[key]
 	if !exists {
 		return // nema šta da brišemo
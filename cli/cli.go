@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"napredni/cli_bloomfilter"
 	"napredni/cli_cmsketch"
@@ -15,6 +16,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Start pokrece komandnu petlju
@@ -22,7 +25,7 @@ func Start(engine *kvengine.Engine) {
 	reader := bufio.NewReader(os.Stdin)
 
 	fmt.Println("Key-Value Store CLI - upisi HELP za komande")
-	var prefixIterator *kvengine.PrefixIterator
+	var prefixIterator *cliIterator
 	for {
 		fmt.Print("> ")
 		input, _ := reader.ReadString('\n')
@@ -84,17 +87,38 @@ func Start(engine *kvengine.Engine) {
 
 		case "PUT":
 
-			if len(args) != 3 {
-				fmt.Println("Koriscenje: PUT kljuc vrednost")
+			// opciono SYNC na kraju - fsync WAL-a pre odgovora
+			syncWrite := len(args) == 4 && strings.ToUpper(args[3]) == "SYNC"
+			if len(args) != 3 && !syncWrite {
+				fmt.Println("Koriscenje: PUT kljuc vrednost [SYNC]")
 				continue
 			}
-			err := engine.Put(args[1], []byte(args[2]))
+			err := engine.Put(args[1], []byte(args[2]), kvengine.WriteOptions{Sync: syncWrite})
 			if err != nil {
 				fmt.Println("Greska pri upisu: ", err)
 			} else {
 				fmt.Println("Uspesno upisano.")
 			}
 
+		case "PUT_TTL":
+
+			syncWrite := len(args) == 5 && strings.ToUpper(args[4]) == "SYNC"
+			if len(args) != 4 && !syncWrite {
+				fmt.Println("Koriscenje: PUT_TTL kljuc vrednost ttl [SYNC] (ttl u sekundama ili kao 30s, 5m, 1h)")
+				continue
+			}
+			ttl, err := parseTTL(args[3])
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			err = engine.PutWithTTL(args[1], []byte(args[2]), ttl, kvengine.WriteOptions{Sync: syncWrite})
+			if err != nil {
+				fmt.Println("Greska pri upisu: ", err)
+			} else {
+				fmt.Printf("Uspesno upisano, istice za %s.\n", ttl)
+			}
+
 		case "GET":
 
 			// rl
@@ -114,6 +138,53 @@ func Start(engine *kvengine.Engine) {
 				fmt.Println("Kljuc nije pronadjen")
 			}
 
+		case "GET_AT":
+
+			if len(args) != 3 {
+				fmt.Println("Koriscenje: GET_AT kljuc seq|vreme (vreme u RFC3339 formatu, npr. 2024-05-01T12:00:00Z)")
+				continue
+			}
+			at, err := parseReadPoint(args[2])
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			val, found := engine.GetAt(args[1], at)
+			if found {
+				fmt.Printf("Vrednost za %s (%s) je: %s\n", args[1], at, val)
+			} else {
+				fmt.Println("Kljuc nije pronadjen")
+			}
+
+		case "HISTORY":
+
+			if len(args) != 2 {
+				fmt.Println("Koriscenje: HISTORY kljuc")
+				continue
+			}
+			versions, err := engine.History(args[1])
+			if err != nil {
+				fmt.Println("Greska:", err)
+				continue
+			}
+			if len(versions) == 0 {
+				fmt.Println("Kljuc nema sacuvanih verzija")
+				continue
+			}
+			for _, v := range versions {
+				when := "-"
+				if !v.Time.IsZero() {
+					when = v.Time.Format(time.RFC3339Nano)
+				}
+				if v.Deleted {
+					fmt.Printf(" seq %d  %s  (obrisan)\n", v.Seq, when)
+				} else if !v.Expires.IsZero() {
+					fmt.Printf(" seq %d  %s  %s  (istice %s)\n", v.Seq, when, v.Value, v.Expires.Format(time.RFC3339Nano))
+				} else {
+					fmt.Printf(" seq %d  %s  %s\n", v.Seq, when, v.Value)
+				}
+			}
+
 		case "DELETE":
 
 			// rl
@@ -122,17 +193,97 @@ func Start(engine *kvengine.Engine) {
 				break
 			}
 
-			if len(args) != 2 {
-				fmt.Println("Koriscenje: DELETE kljuc")
+			syncWrite := len(args) == 3 && strings.ToUpper(args[2]) == "SYNC"
+			if len(args) != 2 && !syncWrite {
+				fmt.Println("Koriscenje: DELETE kljuc [SYNC]")
 				continue
 			}
-			err := engine.Delete(args[1])
+			err := engine.Delete(args[1], kvengine.WriteOptions{Sync: syncWrite})
 			if err != nil {
 				fmt.Println("Greska pri brisanju: ", err)
 			} else {
 				fmt.Println("Kljuc logicki obrisan")
 			}
 
+		case "DELETE_RANGE":
+			syncWrite := len(args) == 4 && strings.ToUpper(args[3]) == "SYNC"
+			if len(args) != 3 && !syncWrite {
+				fmt.Println("Koriscenje: DELETE_RANGE from to [SYNC]")
+				break
+			}
+			if err := engine.DeleteRange(args[1], args[2], kvengine.WriteOptions{Sync: syncWrite}); err != nil {
+				fmt.Println("Greska pri brisanju opsega: ", err)
+			} else {
+				fmt.Println("Opseg logicki obrisan")
+			}
+
+		case "DELETE_PREFIX":
+			syncWrite := len(args) == 3 && strings.ToUpper(args[2]) == "SYNC"
+			if len(args) != 2 && !syncWrite {
+				fmt.Println("Koriscenje: DELETE_PREFIX prefix [SYNC]")
+				break
+			}
+			if err := engine.DeletePrefix(args[1], kvengine.WriteOptions{Sync: syncWrite}); err != nil {
+				fmt.Println("Greska pri brisanju prefiksa: ", err)
+			} else {
+				fmt.Println("Kljucevi sa prefiksom logicki obrisani")
+			}
+
+		case "PUT_IF_ABSENT":
+			if len(args) != 3 {
+				fmt.Println("Koriscenje: PUT_IF_ABSENT kljuc vrednost")
+				break
+			}
+			printConditional(engine.PutIfAbsent(args[1], []byte(args[2])), "Uspesno upisano.")
+
+		case "CAS":
+			if len(args) != 4 {
+				fmt.Println("Koriscenje: CAS kljuc ocekivana_vrednost nova_vrednost")
+				break
+			}
+			printConditional(engine.CompareAndSwap(args[1], []byte(args[2]), []byte(args[3])), "Uspesno zamenjeno.")
+
+		case "GET_VERSION":
+			if len(args) != 2 {
+				fmt.Println("Koriscenje: GET_VERSION kljuc")
+				break
+			}
+			val, version, found := engine.GetWithVersion(args[1])
+			if found {
+				fmt.Printf("Vrednost za %s je: %s (verzija %d)\n", args[1], val, version)
+			} else {
+				fmt.Println("Kljuc nije pronadjen")
+			}
+
+		case "DELETE_IF_VERSION":
+			if len(args) != 3 {
+				fmt.Println("Koriscenje: DELETE_IF_VERSION kljuc verzija")
+				break
+			}
+			version, err := strconv.ParseUint(args[2], 10, 64)
+			if err != nil {
+				fmt.Println("verzija mora biti broj")
+				break
+			}
+			printConditional(engine.DeleteIfVersion(args[1], version), "Kljuc logicki obrisan")
+
+		case "BATCH":
+			if len(args) != 1 {
+				fmt.Println("Koriscenje: BATCH, pa PUT/DELETE u narednim redovima i COMMIT ili ABORT na kraju")
+				break
+			}
+			fmt.Println("Grupni upis: PUT kljuc vrednost i DELETE kljuc, COMMIT za upis ili ABORT za odustajanje")
+			batch, commit := readBatch(reader)
+			if !commit {
+				fmt.Println("Grupni upis odbacen")
+				break
+			}
+			if err := engine.Write(batch); err != nil {
+				fmt.Println("Greska pri grupnom upisu: ", err)
+			} else {
+				fmt.Printf("Uspesno upisano %d operacija.\n", batch.Len())
+			}
+
 		case "RANGE":
 			if len(args) != 3 {
 				fmt.Println("Koriscenje: RANGE <od_kljuca> <do_kljuca>")
@@ -182,65 +333,38 @@ func Start(engine *kvengine.Engine) {
 			}
 
 		case "RANGE_SCAN":
-			if len(args) != 5 {
-				fmt.Println("Koriscenje: RANGE_SCAN <from> <to> <pageNumber> <pageSize>")
+			if len(args) != 4 && len(args) != 5 {
+				fmt.Println("Koriscenje: RANGE_SCAN <from> <to> <pageSize> [token]")
 				break
 			}
-			from := args[1]
-			to := args[2]
-			pageNum, _ := strconv.Atoi(args[3])
-			pageSize, _ := strconv.Atoi(args[4])
-			results := engine.RangeScanPaginated(from, to, pageNum, pageSize)
-			if len(results) == 0 {
-				fmt.Println("nema rezultata za ovu stranicu")
-			} else {
-				fmt.Println("Rezultati:")
-				var keys []string
-				for k := range results {
-					keys = append(keys, k)
-				}
-				// Sortira ključeve
-				sort.Strings(keys)
-
-				// Ispisuje po redu
-				for _, k := range keys {
-					fmt.Printf("%s - %s\n", k, results[k])
-				}
-			}
-
-		case "PREFIX_SCAN":
-			if len(args) != 4 {
-				fmt.Println("Koriscenje: PREFIX_SCAN <prefix> <pageNumber> <pageSize>")
+			pageSize, err := strconv.Atoi(args[3])
+			if err != nil {
+				fmt.Println("neispravna velicina stranice")
 				break
 			}
-			prefix := args[1]
-			pageNumber, err1 := strconv.Atoi(args[2])
-			pageSize, err2 := strconv.Atoi(args[3])
-			if err1 != nil || err2 != nil {
-				fmt.Println("neispravni parametri za broj stranica ili velicinu")
-				return
+			token := ""
+			if len(args) == 5 {
+				token = args[4]
 			}
+			page, next, err := engine.RangeScanPage(args[1], args[2], pageSize, token)
+			printScanPage(page, next, err)
 
-			results := engine.PrefixScanPagination(prefix, pageNumber, pageSize)
-
-			if len(results) == 0 {
-				fmt.Println("Nema rezultata za zadati prefiks")
+		case "PREFIX_SCAN":
+			if len(args) != 3 && len(args) != 4 {
+				fmt.Println("Koriscenje: PREFIX_SCAN <prefix> <pageSize> [token]")
 				break
 			}
-
-			fmt.Println("Kljucevi sa prefiksom:", prefix)
-			var keys []string
-			for k := range results {
-				keys = append(keys, k)
+			pageSize, err := strconv.Atoi(args[2])
+			if err != nil {
+				fmt.Println("neispravna velicina stranice")
+				break
 			}
-
-			// Sortira ključeve
-			sort.Strings(keys)
-
-			// Ispisuje po redu
-			for _, k := range keys {
-				fmt.Printf("%s - %s\n", k, results[k])
+			token := ""
+			if len(args) == 4 {
+				token = args[3]
 			}
+			page, next, err := engine.PrefixScanPage(args[1], pageSize, token)
+			printScanPage(page, next, err)
 
 		case "PREFIX_ITERATE":
 			if len(args) != 2 {
@@ -248,7 +372,10 @@ func Start(engine *kvengine.Engine) {
 				break
 			}
 			prefix := args[1]
-			prefixIterator = engine.NewPrefixIterator(prefix)
+			if prefixIterator != nil {
+				prefixIterator.it.Close()
+			}
+			prefixIterator = &cliIterator{it: engine.NewPrefixIterator(prefix)}
 			fmt.Println("Prefix iterator kreiran za prefiks:", prefix)
 
 		case "RANGE_ITERATOR":
@@ -259,44 +386,37 @@ func Start(engine *kvengine.Engine) {
 
 			from := args[1]
 			to := args[2]
-			it := engine.NewRangeIterator(from, to)
+			it := &cliIterator{it: engine.NewRangeIterator(from, to)}
 
-			fmt.Println("Pokrenut RANGE_ITERATOR. Kucaj NEXT za sledeci, STOP za kraj")
+			fmt.Println("Pokrenut RANGE_ITERATOR. Kucaj NEXT za sledeci, PREV za prethodni, SEEK <kljuc> za skok, STOP za kraj")
 		iteratorLoop:
 			for {
 				fmt.Println("> ")
 				reader := bufio.NewReader(os.Stdin)
 				command, _ := reader.ReadString('\n')
-				command = strings.TrimSpace(command)
-
-				switch strings.ToUpper(command) {
-				case "NEXT":
-					k, v, ok := it.Next()
-					if !ok {
-						fmt.Println("nema vise elemenata")
-					} else {
-						fmt.Printf(" %s - %s\n", k, string(v))
-					}
+				fields := strings.Fields(command)
+				if len(fields) == 0 {
+					continue
+				}
+
+				switch strings.ToUpper(fields[0]) {
+				case "NEXT", "PREV", "SEEK":
+					it.step(fields)
 				case "STOP":
-					it.Stop()
+					it.it.Close()
 					fmt.Println("iterator zaustavljen")
 					break iteratorLoop
 				default:
-					fmt.Println("nepoznata komanda, koristi NEXT ili STOP")
+					fmt.Println("nepoznata komanda, koristi NEXT, PREV, SEEK ili STOP")
 				}
 			}
 
-		case "NEXT":
+		case "NEXT", "PREV", "SEEK":
 			if prefixIterator == nil {
 				fmt.Println("Nema aktivnog prefiks iteratora")
 				break
 			}
-			key, value := prefixIterator.Next()
-			if key == "" {
-				fmt.Println("Nema vise elemenata")
-			} else {
-				fmt.Printf(" %s - %s\n", key, string(value))
-			}
+			prefixIterator.step(args)
 
 		case "STOP":
 			if prefixIterator == nil {
@@ -304,13 +424,14 @@ func Start(engine *kvengine.Engine) {
 				break
 
 			}
-			prefixIterator.Stop()
+			prefixIterator.it.Close()
+			prefixIterator = nil
 			fmt.Println("Prefiks iterator zaustavljen")
 
 		case "MERGE":
 			fmt.Println(" Pokrećem kompaktiranje SSTable-ova...")
 
-			err := sstable.CompactSSTables(engine.DataPath, engine.BlockManager)
+			err := sstable.CompactSSTables(engine.Manifest, engine.BlockManager)
 			if err != nil {
 				fmt.Println(" Greška pri kompaktiranju:", err)
 			} else {
@@ -318,14 +439,14 @@ func Start(engine *kvengine.Engine) {
 			}
 
 		case "SNAPSHOT_SAVE":
-			err := engine.Memtables[0].SaveSnapshot("data/memtable.snapshot")
+			err := engine.GetMemtable().SaveSnapshot("data/memtable.snapshot")
 			if err != nil {
 				fmt.Println(" Greska pri snimanju snapshot-a:", err)
 			} else {
 				fmt.Println(" Snapshot uspesno snimljen.")
 			}
 		case "SNAPSHOT_LOAD":
-			err := engine.Memtables[0].LoadSnapshot("data/memtable.snapshot")
+			err := engine.GetMemtable().LoadSnapshot("data/memtable.snapshot")
 			if err != nil {
 				fmt.Println(" Greska pri ucitavanju snapshot-a:", err)
 			} else {
@@ -351,22 +472,37 @@ func Start(engine *kvengine.Engine) {
 
 		case "STATS":
 			fmt.Println("Statistika baze:")
-			fmt.Println(". Broj kljuceva u memtable:", engine.Memtables[0].Size())
-			fmt.Println(". Broj SSTable fajlova:", countSSTables(engine.DataPath))
-			fmt.Println(". Ukupno GET poziva:", engine.GetCount)
-			fmt.Println(". Ukupno PUT poziva:", engine.PutCount)
+			fmt.Println(". Broj kljuceva u memtable:", engine.GetMemtable().Size())
+			fmt.Println(". Broj SSTable fajlova:", len(engine.Manifest.Tables()))
+			fmt.Println(". Ukupno GET poziva:", atomic.LoadInt64(&engine.GetCount))
+			fmt.Println(". Ukupno PUT poziva:", atomic.LoadInt64(&engine.PutCount))
+			fmt.Println(". SSTable pretrage preskocene bloom filterom:", sstable.BloomSkippedCount())
+			syncStats := engine.WalWriter.SyncStats()
+			fmt.Println(". WAL sync mod:", syncStats.Mode)
+			fmt.Println(". Broj WAL fsync-ova:", syncStats.Fsyncs)
+			fmt.Printf(". Velicina grupe (zapisa po fsync-u): poslednja %d, najveca %d, prosek %.2f\n",
+				syncStats.LastGroup, syncStats.MaxGroup, syncStats.AvgGroup())
+			stalls := engine.StallStats()
+			fmt.Printf(". Usporeni upisi (slowdown): %d, ukupno %v\n", stalls.Slowdowns, stalls.SlowdownTime)
+			fmt.Printf(". Zaustavljeni upisi (stop): %d, ukupno %v\n", stalls.Stops, stalls.StopTime)
+			if stalls.LastReason != "" {
+				fmt.Println(". Poslednji razlog:", stalls.LastReason)
+			}
+			fmt.Println(". Tabela na L0:", len(engine.Manifest.LevelTables(0)))
+			fmt.Println(". Bajtova ceka kompakciju:", sstable.PendingCompactionBytes(engine.Manifest))
 
 		case "WAL_STATE":
 			name, count := engine.WalWriter.StateInfo()
 			fmt.Printf("Aktivni WAL fajl: %s\n, broj zapisa: %d\n", name, count)
+			fmt.Println(engine.WALRecovery)
 
 		case "MEMTABLE_STATE":
 			fmt.Println("Stanje memtable-a")
 			fmt.Println(". Tip:", config.Current.MemtableType)
-			fmt.Println(". Broj kljuceva:", engine.Memtables[0].Size())
+			fmt.Println(". Broj kljuceva:", engine.GetMemtable().Size())
 			// Prikaz nekoliko parova
 			fmt.Println("Primer unosa:")
-			all := engine.Memtables[0].RangeScan("", "zzzzzz")
+			all := engine.GetMemtable().RangeScan("", "zzzzzz")
 			fmt.Println("Prvih 3 kljuca u memtable:")
 			i := 0
 			for k, v := range all {
@@ -387,22 +523,44 @@ func Start(engine *kvengine.Engine) {
 			fmt.Println("Trenutna konfiguracija baze:")
 			fmt.Println(". Tip memtable:", config.Current.MemtableType)
 			fmt.Println(". Max broj unosa u Memtable:", config.Current.MemtableMaxEntries)
-			fmt.Println(". Velicina WAL segmenta:", config.Current.WALSegmentSize)
+			fmt.Println(". Velicina WAL segmenta (bajtova):", config.Current.WALSegmentBytes)
+			fmt.Println(". WAL sync mod:", config.Current.WALSyncMode)
+			fmt.Println(". WAL recovery mod:", config.Current.WALRecoveryMode)
 			fmt.Println(". Velicina bloka:", config.Current.BlockSizeKBK)
 			fmt.Println(". Cache kapacitet:", config.Current.CacheCapacity)
+			fmt.Println(". Strategija kompakcije:", sstable.CompactionStrategy())
+			fmt.Printf(". L0 okidaci (usporavanje/zaustavljanje): %d/%d\n",
+				config.Current.L0SlowdownWritesTrigger, config.Current.L0StopWritesTrigger)
+			fmt.Printf(". Bajtovi za kompakciju (usporavanje/zaustavljanje): %d/%d\n",
+				config.Current.SoftPendingCompactionBytes, config.Current.HardPendingCompactionBytes)
+			for _, rule := range config.Current.VersionRetention {
+				fmt.Printf(". Cuvanje verzija za prefiks %q: %d verzija, %ds\n", rule.Prefix, rule.MaxVersions, rule.RetentionSeconds)
+			}
 
 		case "HELP":
 			fmt.Println("# Dostupne komande:")
 			fmt.Println("PUT ključ vrednost  - dodaj ili ažuriraj podatak")
+			fmt.Println("PUT ključ vrednost SYNC - isto, uz fsync WAL-a pre odgovora")
+			fmt.Println("PUT_TTL ključ vrednost ttl - upis koji istice posle ttl (sekunde ili 30s, 5m, 1h), uz opciono SYNC")
 			fmt.Println("GET ključ            - dohvat vrednosti za dati ključ")
+			fmt.Println("GET_AT ključ seq|vreme - vrednost ključa posle upisa seq ili u datom trenutku (RFC3339)")
+			fmt.Println("HISTORY ključ        - sve sačuvane verzije ključa, od najnovije")
 			fmt.Println("DELETE ključ         - obriši ključ (logički)")
+			fmt.Println("DELETE ključ SYNC    - isto, uz fsync WAL-a pre odgovora")
+			fmt.Println("DELETE_RANGE from to - obriši sve ključeve u opsegu od - do (jednim zapisom), uz opciono SYNC")
+			fmt.Println("DELETE_PREFIX prefix - obriši sve ključeve sa datim prefiksom, uz opciono SYNC")
+			fmt.Println("PUT_IF_ABSENT ključ vrednost - upis samo ako ključ ne postoji")
+			fmt.Println("CAS ključ stara nova - upis nove vrednosti samo ako je trenutna jednaka staroj")
+			fmt.Println("GET_VERSION ključ    - vrednost i verzija (seq) ključa")
+			fmt.Println("DELETE_IF_VERSION ključ verzija - brisanje samo ako je trenutna verzija ključa jednaka datoj")
+			fmt.Println("BATCH ... COMMIT     - grupni upis: PUT i DELETE izmedju BATCH i COMMIT se upisuju zajedno ili nijedan (ABORT odustaje)")
 			fmt.Println("RANGE from to        - ispis kljuceva u opsegu od - do")
 			fmt.Println("RANGE_ALL            - ispis svih kljuceva i vrednosti")
-			fmt.Println("RANGE_SCAN from to pageNumber pageSize     - ispis kljuceva u opsegu po stranici")
-			fmt.Println("PREFIX_SCAN prefix   - isto kao RANGE_SCAN samo za prefiks")
-			fmt.Println("PREFIX_ITERATE prefix       - isto kao PREFIX_SCAN samo postoje pozivi NEXT, I STOP dokle god ima rezultata")
-			fmt.Println("RANGE_ITERATOR from to      - isto kao PREFIX_SCAN samo sto se odnosi na ceo kljuc, a ne prefiks")
-			fmt.Println("MERGE                - kompaktiranje SSTable")
+			fmt.Println("RANGE_SCAN from to pageSize [token]     - ispis kljuceva u opsegu po stranici, token sa kraja stranice daje sledecu")
+			fmt.Println("PREFIX_SCAN prefix pageSize [token]     - isto kao RANGE_SCAN samo za prefiks")
+			fmt.Println("PREFIX_ITERATE prefix       - isto kao PREFIX_SCAN samo postoje pozivi NEXT, PREV, SEEK kljuc i STOP dokle god ima rezultata")
+			fmt.Println("RANGE_ITERATOR from to      - isto kao PREFIX_ITERATE samo sto se odnosi na ceo kljuc, a ne prefiks")
+			fmt.Println("MERGE                - spajanje svih SSTable u jednu (po aktivnoj compaction_strategy)")
 			fmt.Println("SNAPSHOT_SAVE ime    - 'zamrzavanje' trenutne baze, cuvanje vrednosti")
 			fmt.Println("SNAPSHOT_LOAD ime    - ucitava prethodno sacuvani snapshot sa informacijama")
 			fmt.Println("MERKLE_VALIDATE ime  - validacija Merkle stabla za dati SSTable folder")
@@ -416,6 +574,10 @@ func Start(engine *kvengine.Engine) {
 
 		case "EXIT":
 			fmt.Println(" Zatvaranje baze. Doviđenja!")
+			if prefixIterator != nil {
+				prefixIterator.it.Close()
+			}
+			engine.Close() // prvo zaustavi flush i kompakciju u pozadini
 			engine.FlushAllMemtables()
 			return
 
@@ -426,18 +588,137 @@ func Start(engine *kvengine.Engine) {
 
 }
 
-// pomocna funkcija
-func countSSTables(path string) int {
-	files, err := os.ReadDir(path)
+// printScanPage ispisuje stranicu skeniranja i token za sledecu stranicu
+func printScanPage(page []kvengine.KV, next string, err error) {
+	if err != nil {
+		fmt.Println(" Greska pri skeniranju:", err)
+		return
+	}
+	if len(page) == 0 {
+		fmt.Println("nema rezultata za ovu stranicu")
+		return
+	}
+	fmt.Println("Rezultati:")
+	for _, kv := range page {
+		fmt.Printf("%s - %s\n", kv.Key, kv.Value)
+	}
+	if next != "" {
+		fmt.Println("Sledeca stranica, token:", next)
+	} else {
+		fmt.Println("Kraj rezultata")
+	}
+}
+
+// printConditional ispisuje ishod uslovnog upisa
+func printConditional(err error, ok string) {
+	switch {
+	case err == nil:
+		fmt.Println(ok)
+	case errors.Is(err, kvengine.ErrKeyExists), errors.Is(err, kvengine.ErrValueMismatch), errors.Is(err, kvengine.ErrVersionMismatch):
+		fmt.Println("Uslov nije ispunjen:", err)
+	default:
+		fmt.Println("Greska pri upisu: ", err)
+	}
+}
+
+// readBatch cita PUT i DELETE komande grupnog upisa do COMMIT (true) ili ABORT (false)
+func readBatch(reader *bufio.Reader) (*kvengine.WriteBatch, bool) {
+	batch := kvengine.NewWriteBatch()
+	for {
+		fmt.Print("batch> ")
+		line, err := reader.ReadString('\n')
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			if err != nil {
+				return batch, false // kraj ulaza bez COMMIT
+			}
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "PUT":
+			if len(fields) != 3 {
+				fmt.Println("Koriscenje: PUT kljuc vrednost")
+				continue
+			}
+			batch.Put(fields[1], []byte(fields[2]))
+		case "DELETE":
+			if len(fields) != 2 {
+				fmt.Println("Koriscenje: DELETE kljuc")
+				continue
+			}
+			batch.Delete(fields[1])
+		case "COMMIT":
+			return batch, true
+		case "ABORT":
+			return batch, false
+		default:
+			fmt.Println("u grupnom upisu su dozvoljeni samo PUT, DELETE, COMMIT i ABORT")
+		}
+	}
+}
+
+// parseTTL cita ttl za PUT_TTL: broj sekundi ili trajanje u Go formatu (30s, 5m, 1h30m)
+func parseTTL(arg string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(arg); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	ttl, err := time.ParseDuration(arg)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("neispravan ttl %q: ocekuje se broj sekundi ili trajanje (npr. 30s, 5m)", arg)
+	}
+	return ttl, nil
+}
+
+// parseReadPoint cita trenutak za GET_AT: redni broj upisa ili vreme u RFC3339 formatu
+func parseReadPoint(arg string) (kvengine.ReadPoint, error) {
+	if seq, err := strconv.ParseUint(arg, 10, 64); err == nil {
+		return kvengine.AtSequence(seq), nil
+	}
+	t, err := time.Parse(time.RFC3339, arg)
 	if err != nil {
-		return 0
+		return kvengine.ReadPoint{}, fmt.Errorf("neispravan trenutak %q: ocekuje se redni broj upisa ili vreme (RFC3339)", arg)
+	}
+	return kvengine.AtTime(t), nil
+}
+
+// cliIterator je iterator koji korisnik pomera komandama NEXT, PREV i SEEK
+type cliIterator struct {
+	it      kvengine.Iterator
+	started bool // prvi NEXT ide na prvi kljuc, a prvi PREV na poslednji
+}
+
+// step pomera iterator po komandi i ispisuje zapis na kom je stao
+func (c *cliIterator) step(args []string) {
+	switch strings.ToUpper(args[0]) {
+	case "NEXT":
+		if c.started {
+			c.it.Next()
+		} else {
+			c.it.SeekToFirst()
+		}
+	case "PREV":
+		if c.started {
+			c.it.Prev()
+		} else {
+			c.it.SeekToLast()
+		}
+	case "SEEK":
+		if len(args) != 2 {
+			fmt.Println("Koriscenje: SEEK <kljuc>")
+			return
+		}
+		c.it.Seek(args[1])
 	}
+	c.started = true
 
-	count := 0
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "sstable_") {
-			count++
+	if !c.it.Valid() {
+		if err := c.it.Err(); err != nil {
+			fmt.Println(" Greska iteratora:", err)
+		} else {
+			fmt.Println("Nema vise elemenata")
 		}
+		return
 	}
-	return count
+	fmt.Printf(" %s - %s\n", c.it.Key(), string(c.it.Value()))
 }
@@ -4,20 +4,64 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 )
 
 // Struktura koja odgovara JSON fajlu
 type Config struct {
-	MemtableType         string `json:"memtable_type"`
-	MemtableMaxEntries   int    `json:"memtable_max_entries"`
-	MemtableMaxTables    int    `json:"memtable_max_tables"`
-	WALSegmentSize       int    `json:"wal_segment_size"`
-	MaxSSTableFiles      int    `json:"max_sstable_files"`
-	MaxSSTableLevels     int    `json:"max_levels"`
-	SSTableFilesPerLevel int    `json:"sstable_files_per_level"`
-	BlockSizeKBK         int    `json:"block_size_kb"`
-	CacheCapacity        int    `json:"cache_capacity"`
-	SummaryKeyDistance   int    `json:"summary_key_distance"`
+	MemtableType               string `json:"memtable_type"`
+	MemtableMaxEntries         int    `json:"memtable_max_entries"`
+	MemtableMaxTables          int    `json:"memtable_max_tables"`
+	WALSegmentBytes            int    `json:"wal_segment_bytes"`
+	WALSyncMode                string `json:"wal_sync_mode"`          // always, group ili none
+	WALGroupCommitMs           int    `json:"wal_group_commit_ms"`    // group: fsync najkasnije posle ovoliko ms
+	WALGroupCommitBytes        int    `json:"wal_group_commit_bytes"` // group: fsync cim se skupi ovoliko bajtova
+	WALRecoveryMode            string `json:"wal_recovery_mode"`      // absolute_consistency, tolerate_corrupted_tail, point_in_time ili skip_any_corrupted
+	MaxSSTableFiles            int    `json:"max_sstable_files"`
+	MaxSSTableLevels           int    `json:"max_levels"`
+	CompactionStrategy         string `json:"compaction_strategy"`           // leveled ili size_tiered
+	MinThreshold               int    `json:"min_threshold"`                 // size_tiered: grupa slicnih tabela se spaja kada ih ima bar ovoliko
+	SSTableFilesPerLevel       int    `json:"sstable_files_per_level"`       // L0 se kompaktira kada ima vise tabela od ovoga
+	LevelBaseBytes             int64  `json:"level_base_bytes"`              // ciljna velicina L1 u bajtovima
+	LevelSizeMultiplier        int    `json:"level_size_multiplier"`         // svaki sledeci nivo je ovoliko puta veci
+	CompactionWorkers          int    `json:"compaction_workers"`            // broj gorutina koje rade kompakciju u pozadini
+	TargetFileSizeBytes        int64  `json:"target_file_size_bytes"`        // kompakcija zapocinje novu tabelu kada trenutna predje ovoliko bajtova
+	L0SlowdownWritesTrigger    int    `json:"l0_slowdown_writes_trigger"`    // upisi se usporavaju kada na L0 ima bar ovoliko tabela
+	L0StopWritesTrigger        int    `json:"l0_stop_writes_trigger"`        // upisi cekaju dok na L0 ima bar ovoliko tabela
+	SoftPendingCompactionBytes int64  `json:"soft_pending_compaction_bytes"` // usporavanje kada ovoliko bajtova ceka kompakciju (0 - iskljuceno)
+	HardPendingCompactionBytes int64  `json:"hard_pending_compaction_bytes"` // upisi cekaju kada ovoliko bajtova ceka kompakciju (0 - iskljuceno)
+	DelayedWriteRate           int    `json:"delayed_write_rate"`            // broj upisa u sekundi dok traje usporavanje
+	BlockSizeKBK               int    `json:"block_size_kb"`
+	CacheCapacity              int    `json:"cache_capacity"`
+	SummaryKeyDistance         int    `json:"summary_key_distance"`
+
+	// koliko starih verzija kljuca kompakcija cuva, po prefiksu kljuca (vazi pravilo sa najduzim prefiksom)
+	// bez pravila za kljuc ostaje samo najnovija verzija (i one koje trebaju zivim snapshot-ovima)
+	VersionRetention []VersionRetention `json:"version_retention"`
+
+	// stari kljuc: maksimalan broj zapisa po WAL segmentu, kada je svaki zapis zauzimao ceo blok
+	// LoadConfig ga pretvara u WALSegmentBytes (broj zapisa * velicina bloka)
+	WALSegmentSize int `json:"wal_segment_size,omitempty"`
+}
+
+// VersionRetention je pravilo cuvanja starih verzija za kljuceve sa datim prefiksom ("" - svi kljucevi)
+// verzija ostaje ako je medju MaxVersions najnovijih ili ako je bila vazeca u poslednjih RetentionSeconds sekundi
+type VersionRetention struct {
+	Prefix           string `json:"prefix"`
+	MaxVersions      int    `json:"max_versions"`      // broj verzija koje se cuvaju, ukljucujuci najnoviju (0 ili 1 - samo najnovija)
+	RetentionSeconds int64  `json:"retention_seconds"` // 0 - bez vremenskog prozora
+}
+
+// RetentionFor vraca pravilo cuvanja verzija za kljuc, false ako nijedno ne odgovara
+func (c Config) RetentionFor(key string) (VersionRetention, bool) {
+	var best VersionRetention
+	found := false
+	for _, r := range c.VersionRetention {
+		if strings.HasPrefix(key, r.Prefix) && (!found || len(r.Prefix) > len(best.Prefix)) {
+			best, found = r, true
+		}
+	}
+	return best, found
 }
 
 // Globalna promenljiva u koju ucitavamo konfiguraciju
@@ -36,7 +80,27 @@ func LoadConfig(path string) error {
 	if err != nil {
 		return fmt.Errorf("greska pri ucitavanju JSON konfiguracije: %v", err)
 	}
+	if err := Current.convertLegacyKeys(); err != nil {
+		return err
+	}
 
 	fmt.Println("Konfiguracija uspesno ucitanaL:", Current)
 	return nil
 }
+
+// convertLegacyKeys prevodi kljuceve iz starijih verzija konfiguracije u nove
+func (c *Config) convertLegacyKeys() error {
+	if c.WALSegmentSize > 0 {
+		if c.WALSegmentBytes > 0 {
+			return fmt.Errorf("konfiguracija sadrzi i wal_segment_size i wal_segment_bytes, ostavi samo wal_segment_bytes")
+		}
+		if c.BlockSizeKBK <= 0 {
+			return fmt.Errorf("wal_segment_size (stari kljuc) zahteva block_size_kb da bi se pretvorio u wal_segment_bytes")
+		}
+		c.WALSegmentBytes = c.WALSegmentSize * c.BlockSizeKBK * 1024
+		fmt.Printf("Upozorenje: wal_segment_size je zastareo, koristim wal_segment_bytes = %d (%d zapisa * %d KB)\n",
+			c.WALSegmentBytes, c.WALSegmentSize, c.BlockSizeKBK)
+		c.WALSegmentSize = 0
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadFrom(t *testing.T, content string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Current = Config{}
+	return LoadConfig(path)
+}
+
+// stari wal_segment_size (broj zapisa, svaki u svom bloku) se pretvara u bajtove
+func TestLegacyWALSegmentSize(t *testing.T) {
+	if err := loadFrom(t, `{"wal_segment_size": 3, "block_size_kb": 4}`); err != nil {
+		t.Fatal(err)
+	}
+	if Current.WALSegmentBytes != 3*4*1024 {
+		t.Fatalf("WALSegmentBytes = %d, ocekivano %d", Current.WALSegmentBytes, 3*4*1024)
+	}
+}
+
+func TestLegacyAndNewWALSegmentKeys(t *testing.T) {
+	if err := loadFrom(t, `{"wal_segment_size": 3, "wal_segment_bytes": 16384, "block_size_kb": 4}`); err == nil {
+		t.Fatal("ocekivana greska kada su navedena oba kljuca")
+	}
+}
@@ -0,0 +1,299 @@
+package kvengine
+
+import (
+	"fmt"
+	"napredni/config"
+	"napredni/memtable"
+	"napredni/ratelimiter"
+	"napredni/sstable"
+	"time"
+)
+
+// Flush i kompakcija rade u pozadini, da klijent koji je napunio Memtable ne bi cekao na njih:
+//   - flusher je jedna gorutina koja upisuje RO Memtable u L0, od najstarije ka najnovijoj
+//     (red cekanja su same RO Memtable u e.Memtables, flushCh ga samo budi)
+//   - kompakciju radi compaction_workers gorutina; svaka pokrene AutoCompact, a nivo koji
+//     vec neko kompaktira se preskace, pa vise radnika moze da radi na razlicitim nivoima
+//   - kada kompakcija pocne da kasni upisi se prvo usporavaju (slowdown): svaki upis uzima token iz
+//     posebnog TokenBucket-a sa delayed_write_rate tokena u sekundi; okidaci su l0_slowdown_writes_trigger
+//     tabela na L0 ili soft_pending_compaction_bytes bajtova koji cekaju kompakciju
+//     (kod size_tiered strategije sve tabele su na L0, pa tamo vaze samo okidaci po bajtovima)
+//   - upis potpuno staje (stop) samo kada pozadina ozbiljno kasni: kada treba zameniti RW Memtable, a RO Memtable
+//     ima vise nego sto memtable_max_tables dozvoljava, kada na L0 ima l0_stop_writes_trigger tabela
+//     ili kada hard_pending_compaction_bytes bajtova ceka kompakciju
+//   - posle svakog flush-a i kompakcije budi se roomCond, na kome cekaju zaustavljeni upisi
+//   - broj i trajanje usporavanja i zaustavljanja se vide u StallStats (komanda STATS)
+
+// StallStats opisuje koliko su upisi cekali na flush i kompakciju
+type StallStats struct {
+	Slowdowns    int64         // broj usporenih upisa
+	SlowdownTime time.Duration // ukupno vreme usporavanja
+	Stops        int64         // broj upisa koji su morali da stanu
+	StopTime     time.Duration // ukupno vreme cekanja zaustavljenih upisa
+	LastReason   string        // razlog poslednjeg usporavanja ili zaustavljanja
+}
+
+// startBackground pokrece flusher i radnike za kompakciju, poziva se na kraju NewEngine
+func (e *Engine) startBackground() {
+	e.flushCh = make(chan struct{}, 1)
+	e.compactCh = make(chan struct{}, 1)
+	e.stopCh = make(chan struct{})
+	e.slowdown = ratelimiter.NewTokenBucket(1, 1000/delayedWriteRate())
+
+	e.bgWG.Add(1)
+	go e.flushLoop()
+
+	for i := 0; i < compactionWorkers(); i++ {
+		e.bgWG.Add(1)
+		go e.compactionLoop()
+	}
+
+	// mozda je posle replay-a vec nesto ostalo za flush ili kompakciju
+	e.scheduleFlush()
+	e.scheduleCompaction()
+}
+
+func compactionWorkers() int {
+	if config.Current.CompactionWorkers > 0 {
+		return config.Current.CompactionWorkers
+	}
+	return 1
+}
+
+// l0StopWritesTrigger vraca broj L0 tabela na kom upisi staju
+// podrazumevano je to tri puta vise od praga za kompakciju L0
+func l0StopWritesTrigger() int {
+	if config.Current.L0StopWritesTrigger > 0 {
+		return config.Current.L0StopWritesTrigger
+	}
+	return 3*config.Current.SSTableFilesPerLevel + 1
+}
+
+// l0SlowdownWritesTrigger vraca broj L0 tabela od kog se upisi usporavaju
+func l0SlowdownWritesTrigger() int {
+	if config.Current.L0SlowdownWritesTrigger > 0 {
+		return config.Current.L0SlowdownWritesTrigger
+	}
+	return 2*config.Current.SSTableFilesPerLevel + 1
+}
+
+// delayedWriteRate vraca broj upisa u sekundi dok traje usporavanje (najvise 1000, jer TokenBucket broji u ms)
+func delayedWriteRate() int {
+	rate := config.Current.DelayedWriteRate
+	if rate <= 0 {
+		rate = 100
+	}
+	if rate > 1000 {
+		rate = 1000
+	}
+	return rate
+}
+
+// scheduleFlush budi flusher (ako je vec budan, signal se ne gomila)
+func (e *Engine) scheduleFlush() {
+	select {
+	case e.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) scheduleCompaction() {
+	select {
+	case e.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+// wakeWriters budi upise koji cekaju na mesto
+// roomCond se budi pod e.mu, da se signal ne bi izgubio izmedju provere uslova i Wait
+func (e *Engine) wakeWriters() {
+	e.mu.Lock()
+	e.roomCond.Broadcast()
+	e.mu.Unlock()
+}
+
+// setBackgroundError pamti gresku iz pozadine, posle nje svi upisi vracaju tu gresku
+func (e *Engine) setBackgroundError(err error) {
+	e.mu.Lock()
+	if e.bgErr == nil {
+		e.bgErr = err
+	}
+	e.roomCond.Broadcast()
+	e.mu.Unlock()
+}
+
+func (e *Engine) flushLoop() {
+	defer e.bgWG.Done()
+
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-e.flushCh:
+		}
+
+		for {
+			oldest := e.oldestToFlush()
+			if oldest == nil {
+				break
+			}
+			if err := e.flushImmutable(oldest); err != nil {
+				fmt.Printf(" Greska pri flush-u u pozadini: %v\n", err)
+				e.setBackgroundError(fmt.Errorf("flush u pozadini nije uspeo: %v", err))
+				return
+			}
+			e.scheduleCompaction()
+		}
+	}
+}
+
+// oldestToFlush vraca najstariju RO Memtable ako ih ima vise nego sto je dozvoljeno, inace nil
+func (e *Engine) oldestToFlush() memtable.MemtableInterface {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.Memtables) > config.Current.MemtableMaxTables && len(e.Memtables) > 1 {
+		return e.Memtables[1]
+	}
+	return nil
+}
+
+func (e *Engine) compactionLoop() {
+	defer e.bgWG.Done()
+
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-e.compactCh:
+		}
+
+		if err := sstable.AutoCompact(e.Manifest, e.BlockManager); err != nil {
+			// ne zakazujemo odmah ponovo, da se ne bi vrtelo u krug; sledeci flush ce je probati opet
+			fmt.Printf(" Greska pri kompakciji u pozadini: %v\n", err)
+			e.wakeWriters()
+			continue
+		}
+		e.wakeWriters()
+
+		// dok je ovaj radnik radio, flush je mozda napunio neki nivo koji je tada bio zauzet
+		if sstable.NeedsCompaction(e.Manifest) {
+			e.scheduleCompaction()
+		}
+	}
+}
+
+// okidaci po broju L0 tabela imaju smisla samo kod leveled strategije
+func leveled() bool {
+	return sstable.CompactionStrategy() == sstable.StrategyLeveled
+}
+
+// writeSlowdownReason vraca razlog za usporavanje upisa, ili prazan string ako kompakcija stize
+func (e *Engine) writeSlowdownReason() string {
+	if n := len(e.Manifest.LevelTables(0)); leveled() && n >= l0SlowdownWritesTrigger() {
+		return fmt.Sprintf("usporavanje: %d tabela na L0", n)
+	}
+	if limit := config.Current.SoftPendingCompactionBytes; limit > 0 {
+		if pending := sstable.PendingCompactionBytes(e.Manifest); pending >= limit {
+			return fmt.Sprintf("usporavanje: %d bajtova ceka kompakciju", pending)
+		}
+	}
+	return ""
+}
+
+// writeStopReason vraca razlog zbog kog upis mora da saceka kompakciju, ili prazan string
+func (e *Engine) writeStopReason() string {
+	if n := len(e.Manifest.LevelTables(0)); leveled() && n >= l0StopWritesTrigger() {
+		return fmt.Sprintf("zaustavljanje: %d tabela na L0", n)
+	}
+	if limit := config.Current.HardPendingCompactionBytes; limit > 0 {
+		if pending := sstable.PendingCompactionBytes(e.Manifest); pending >= limit {
+			return fmt.Sprintf("zaustavljanje: %d bajtova ceka kompakciju", pending)
+		}
+	}
+	return ""
+}
+
+// recordStall belezi jedno usporavanje ili zaustavljanje upisa
+func (e *Engine) recordStall(stop bool, reason string, waited time.Duration) {
+	e.stallMu.Lock()
+	defer e.stallMu.Unlock()
+	if stop {
+		e.stalls.Stops++
+		e.stalls.StopTime += waited
+	} else {
+		e.stalls.Slowdowns++
+		e.stalls.SlowdownTime += waited
+	}
+	e.stalls.LastReason = reason
+}
+
+// StallStats vraca statistiku usporavanja i zaustavljanja upisa
+func (e *Engine) StallStats() StallStats {
+	e.stallMu.Lock()
+	defer e.stallMu.Unlock()
+	return e.stalls
+}
+
+// makeRoomForWrite priprema RW Memtable za n novih zapisa, poziva se pod writeMu
+// ako kompakcija kasni upis se uspori ili saceka, a ako RW Memtable nema mesta, promovise je u RO i budi flusher
+// batch veci od kapaciteta ide ceo u praznu Memtable, jer se ne deli izmedju dve
+func (e *Engine) makeRoomForWrite(n int) error {
+	// usporavanje ide van e.mu, da citaoci ne bi cekali zajedno sa upisom
+	if reason := e.writeSlowdownReason(); reason != "" {
+		e.scheduleCompaction()
+		start := time.Now()
+		e.slowdown.Wait()
+		e.recordStall(false, reason, time.Since(start))
+	}
+
+	e.mu.Lock()
+	stopReason := ""
+	var stopStart time.Time
+	for {
+		if e.bgErr != nil {
+			err := e.bgErr
+			e.mu.Unlock()
+			return err
+		}
+
+		full := e.Memtables[0].Size() > 0 && e.Memtables[0].Size()+n > e.memCap
+		reason := ""
+		if full && len(e.Memtables) > config.Current.MemtableMaxTables {
+			reason = "zaustavljanje: flush kasni, previse RO Memtable"
+			e.scheduleFlush()
+		} else if reason = e.writeStopReason(); reason != "" {
+			e.scheduleCompaction()
+		}
+		if reason != "" {
+			if stopReason == "" {
+				fmt.Println(">> Write stall,", reason)
+				stopStart = time.Now()
+			}
+			stopReason = reason
+			e.roomCond.Wait()
+			continue
+		}
+		e.mu.Unlock()
+
+		if stopReason != "" {
+			e.recordStall(true, stopReason, time.Since(stopStart))
+		}
+		if full {
+			fmt.Println(">> Memtable pun - promocija u read-only i kreiranje nove")
+			e.switchMemtable()
+			e.WalWriter.Rotate() // zapisi nove Memtable idu u novi segment
+			e.scheduleFlush()
+		}
+		return nil
+	}
+}
+
+// Close zaustavlja flusher i radnike za kompakciju (ceka da zavrse zapoceti posao)
+// RO Memtable koje nisu upisane ostaju u memoriji, za njih se posle poziva FlushAllMemtables
+func (e *Engine) Close() {
+	e.closeOnce.Do(func() {
+		close(e.stopCh)
+		e.bgWG.Wait()
+		e.setBackgroundError(fmt.Errorf("baza je zatvorena"))
+	})
+}
@@ -0,0 +1,120 @@
+package kvengine
+
+import (
+	"fmt"
+	"napredni/wal"
+	"sync/atomic"
+	"time"
+)
+
+// WriteBatch je grupa upisa i brisanja koja se primenjuje atomicno (Engine.Write)
+// cela grupa ide u WAL kao jedan zapis, pa se posle pada vraca cela ili nikako,
+// a citaoci (Get, iteratori, snapshot-i) vide ili sve njene izmene ili nijednu
+type WriteBatch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// NewWriteBatch pravi praznu grupu upisa
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+// Put dodaje upis u grupu; kasniji upis istog kljuca u grupi pobedjuje
+func (b *WriteBatch) Put(key string, value []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+}
+
+// Delete dodaje brisanje u grupu
+func (b *WriteBatch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+}
+
+// Len vraca broj operacija u grupi
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Clear prazni grupu, da bi mogla ponovo da se koristi
+func (b *WriteBatch) Clear() {
+	b.ops = b.ops[:0]
+}
+
+// Write atomicno primenjuje sve operacije iz grupe
+// svaka operacija dobija svoj redni broj upisa (redom kao u grupi), a sve dele isto vreme upisa
+func (e *Engine) Write(batch *WriteBatch, opts ...WriteOptions) error {
+	if batch == nil || len(batch.ops) == 0 {
+		return nil
+	}
+	if !e.RateLimiter.Allow() {
+		return fmt.Errorf("previse zahteva!")
+	}
+
+	e.writeMu.Lock()
+	pos, err := e.writeLocked(batch.ops)
+	e.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return e.waitWAL(pos, opts)
+}
+
+// writeLocked upisuje grupu operacija, poziva se pod writeMu
+// koristi je i sve sto pre upisa proverava stanje baze pod istim writeMu (transakcije, uslovni upisi)
+// vraca poziciju zapisa u WAL-u; pozivalac posle pustanja writeMu ceka fsync preko waitWAL
+func (e *Engine) writeLocked(ops []batchOp) (uint64, error) {
+	// cela grupa mora da stane u istu RW Memtable
+	if err := e.makeRoomForWrite(len(ops)); err != nil {
+		return 0, err
+	}
+
+	// 1. Upis cele grupe u WAL kao jednog zapisa
+	n := uint64(len(ops))
+	first, ts := atomic.AddUint64(&e.lastSeq, n)-n+1, time.Now().UnixNano()
+	records := make([]wal.Record, len(ops))
+	for i, op := range ops {
+		records[i] = wal.Record{
+			Seq:       first + uint64(i),
+			Tombstone: op.delete,
+			Key:       []byte(op.key),
+			Value:     op.value,
+			Timestamp: ts,
+		}
+	}
+	// jedna operacija ide kao obican zapis
+	record := records[0]
+	if len(records) > 1 {
+		record = wal.NewBatchRecord(records)
+	}
+	pos, err := e.WalWriter.Append(record)
+	if err != nil {
+		return 0, fmt.Errorf("greška pri pisanju grupe u WAL: %v", err)
+	}
+
+	// 2. Upis u RW Memtable i 3. Cache, sve pod istim zakljucavanjem, da citalac ne vidi pola grupe
+	segmentPath := e.WalWriter.GetCurrentSegmentPath()
+	puts := 0
+	e.mu.Lock()
+	e.Memtables[0].AddSegmentPath(segmentPath)
+	for i, op := range ops {
+		if op.delete {
+			e.Memtables[0].Delete(op.key, records[i].Seq, ts)
+			e.Cache.Remove(op.key)
+		} else {
+			e.Memtables[0].Put(op.key, op.value, records[i].Seq, ts, 0)
+			e.Cache.Put(op.key, op.value)
+			puts++
+		}
+	}
+	e.applied++
+	e.visibleSeq = first + n - 1
+	e.mu.Unlock()
+
+	atomic.AddInt64(&e.PutCount, int64(puts))
+	return pos, nil
+}
@@ -0,0 +1,87 @@
+package kvengine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWriteBatchAppliesAllOps(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("stari", []byte("1"))
+
+	batch := NewWriteBatch()
+	batch.Put("a", []byte("1"))
+	batch.Put("b", []byte("1"))
+	batch.Delete("stari")
+	batch.Put("a", []byte("2"))
+	if err := e.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, e, "a", "2")
+	mustGet(t, e, "b", "1")
+	mustMiss(t, e, "stari")
+}
+
+// ako upis u WAL ne uspe, nijedna operacija iz grupe ne sme da se vidi
+func TestWriteBatchRollsBackOnWALFailure(t *testing.T) {
+	e, dir := openTestEngine(t, "", testConfig())
+	e.Put("a", []byte("stara"))
+	puts := atomic.LoadInt64(&e.PutCount)
+
+	// sledeci segment ne moze da se napravi
+	if err := os.RemoveAll(filepath.Join(dir, "wal")); err != nil {
+		t.Fatal(err)
+	}
+	e.WalWriter.Rotate()
+
+	batch := NewWriteBatch()
+	batch.Put("a", []byte("nova"))
+	batch.Put("b", []byte("nova"))
+	batch.Delete("c")
+	if err := e.Write(batch); err == nil {
+		t.Fatal("ocekivana greska pri upisu u WAL")
+	}
+	mustGet(t, e, "a", "stara")
+	mustMiss(t, e, "b")
+	if got := atomic.LoadInt64(&e.PutCount); got != puts {
+		t.Fatalf("PutCount se promenio posle neuspelog upisa: %d -> %d", puts, got)
+	}
+}
+
+// grupa presecena pri padu se ne vraca pri replay-u, ni delimicno
+func TestTornBatchDroppedOnReplay(t *testing.T) {
+	cfg := testConfig()
+	cfg.MemtableMaxEntries = 1000
+	e, dir := openTestEngine(t, "", cfg)
+	e.Put("pre", []byte("1"))
+
+	batch := NewWriteBatch()
+	for i := 0; i < 50; i++ {
+		batch.Put(fmt.Sprintf("b%02d", i), []byte("vrednost iz grupe"))
+	}
+	if err := e.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	segment := e.WalWriter.GetCurrentSegmentPath()
+	e.Close()
+
+	info, err := os.Stat(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(segment, info.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+
+	e = reopen(t, e, dir)
+	mustGet(t, e, "pre", "1")
+	for i := 0; i < 50; i++ {
+		mustMiss(t, e, fmt.Sprintf("b%02d", i))
+	}
+	if e.WALRecovery.Corruption == nil {
+		t.Fatal("replay nije prijavio presecen kraj WAL-a")
+	}
+}
@@ -0,0 +1,77 @@
+package kvengine
+
+import (
+	"fmt"
+	"napredni/config"
+	"napredni/sstable"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// na nivoima ispod L0 tabele ne smeju da se preklapaju
+func checkDisjointLevels(t *testing.T, m *sstable.Manifest) {
+	t.Helper()
+	for level := 1; level < config.Current.MaxSSTableLevels; level++ {
+		tables := m.LevelTables(level)
+		sort.Slice(tables, func(i, j int) bool { return tables[i].MinKey < tables[j].MinKey })
+		for i := 1; i < len(tables); i++ {
+			if tables[i-1].MaxKey >= tables[i].MinKey {
+				t.Fatalf("L%d: %s [%s, %s] se preklapa sa %s [%s, %s]", level,
+					tables[i-1].Name, tables[i-1].MinKey, tables[i-1].MaxKey, tables[i].Name, tables[i].MinKey, tables[i].MaxKey)
+			}
+		}
+	}
+}
+
+func TestLeveledCompactionKeepsLevelsDisjoint(t *testing.T) {
+	e, dir := openTestEngine(t, "", testConfig())
+
+	want := make(map[string][]byte)
+	for i := 0; i < 800; i++ {
+		key := fmt.Sprintf("key%03d", (i*37)%250)
+		if i%9 == 4 {
+			if err := e.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			delete(want, key)
+			continue
+		}
+		value := []byte(fmt.Sprintf("vrednost-%04d", i))
+		if err := e.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = value
+	}
+	flushAll(t, e)
+	if err := sstable.AutoCompact(e.Manifest, e.BlockManager); err != nil {
+		t.Fatal(err)
+	}
+
+	deeper := 0
+	for level := 1; level < config.Current.MaxSSTableLevels; level++ {
+		deeper += len(e.Manifest.LevelTables(level))
+	}
+	if deeper == 0 {
+		t.Fatal("kompakcija nije spustila nijednu tabelu ispod L0")
+	}
+	if sstable.NeedsCompaction(e.Manifest) {
+		t.Fatal("posle AutoCompact i dalje ima nivoa preko cilja")
+	}
+	checkDisjointLevels(t, e.Manifest)
+
+	check := func(e *Engine) {
+		t.Helper()
+		if got := e.PrefixScanAll("key"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("posle kompakcije %d kljuceva, ocekivano %d", len(got), len(want))
+		}
+		for key, value := range want {
+			mustGet(t, e, key, string(value))
+		}
+	}
+	check(e)
+
+	e = reopen(t, e, dir)
+	checkDisjointLevels(t, e.Manifest)
+	check(e)
+}
@@ -0,0 +1,213 @@
+package kvengine
+
+import (
+	"fmt"
+	"napredni/config"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pisci koji cekaju fsync dele isti fsync, umesto da se redom sinhronizuju pod writeMu
+func TestGroupCommitSharesFsync(t *testing.T) {
+	cfg := testConfig()
+	cfg.MemtableMaxEntries = 1000
+	cfg.WALSegmentBytes = 1 << 20
+	cfg.WALSyncMode = "group"
+	cfg.WALGroupCommitMs = 20
+	cfg.WALGroupCommitBytes = 1 << 20
+	e, _ := openTestEngine(t, "", cfg)
+
+	const writers, puts = 16, 10
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < puts; i++ {
+				if err := e.Put(fmt.Sprintf("g%02d-%02d", g, i), []byte("v")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	stats := e.WalWriter.SyncStats()
+	if stats.SyncedRecords != writers*puts {
+		t.Fatalf("fsync pokriva %d zapisa, ocekivano %d", stats.SyncedRecords, writers*puts)
+	}
+	if stats.Fsyncs >= writers*puts || stats.MaxGroup < 2 {
+		t.Fatalf("pisci ne dele fsync: %+v", stats)
+	}
+}
+
+// svaki upis sa sync-om ceka fsync, i kada se ceka van writeMu
+func TestSyncAlwaysCoversEveryWrite(t *testing.T) {
+	cfg := testConfig()
+	cfg.MemtableMaxEntries = 1000
+	cfg.WALSegmentBytes = 1 << 20
+	cfg.WALSyncMode = "always"
+	e, _ := openTestEngine(t, "", cfg)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := e.Put(fmt.Sprintf("g%d-%02d", g, i), []byte("v")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if stats := e.WalWriter.SyncStats(); stats.SyncedRecords != 160 || stats.Fsyncs > 160 {
+		t.Fatalf("neocekivana statistika fsync-a: %+v", stats)
+	}
+}
+
+// upisi i citanja iz vise gorutina dok flush i kompakcija rade u pozadini (pokretati i sa -race)
+func TestConcurrentOpsWithBackgroundWork(t *testing.T) {
+	for _, memtableType := range []string{"skiplist", "hashmap"} {
+		t.Run(memtableType, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.MemtableType = memtableType
+			testConcurrentOps(t, cfg)
+		})
+	}
+}
+
+func testConcurrentOps(t *testing.T, cfg config.Config) {
+	e, dir := openTestEngine(t, "", cfg)
+
+	const writers, ops, keys = 4, 300, 40
+	models := make([]map[string]string, writers)
+	var writersWG, othersWG sync.WaitGroup
+	done := make(chan struct{})
+
+	for g := 0; g < writers; g++ {
+		models[g] = make(map[string]string)
+		writersWG.Add(1)
+		go func(g int, model map[string]string) {
+			defer writersWG.Done()
+			for i := 0; i < ops; i++ {
+				key := fmt.Sprintf("w%d-k%02d", g, (i*7)%keys)
+				var err error
+				switch {
+				case i%7 == 3:
+					err = e.Delete(key)
+					delete(model, key)
+				case i%11 == 5:
+					batch := NewWriteBatch()
+					other := fmt.Sprintf("w%d-k%02d", g, (i*3)%keys)
+					batch.Put(key, []byte(fmt.Sprint(i)))
+					batch.Delete(other)
+					err = e.Write(batch)
+					model[key] = fmt.Sprint(i)
+					delete(model, other)
+				default:
+					err = e.Put(key, []byte(fmt.Sprint(i)))
+					model[key] = fmt.Sprint(i)
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g, models[g])
+	}
+
+	running := func() bool {
+		select {
+		case <-done:
+			return false
+		default:
+			return true
+		}
+	}
+
+	// citaoci: Get, skeniranje po prefiksu, iterator (kljucevi rastu) i snapshot (dva citanja daju isto)
+	for r := 0; r < 3; r++ {
+		othersWG.Add(1)
+		go func(r int) {
+			defer othersWG.Done()
+			for i := 0; running(); i++ {
+				e.Get(fmt.Sprintf("w%d-k%02d", i%writers, i%keys))
+				e.PrefixScanAll(fmt.Sprintf("w%d", r))
+
+				it := e.NewIterator()
+				prev := ""
+				for it.SeekToFirst(); it.Valid(); it.Next() {
+					if it.Key() <= prev {
+						t.Errorf("iterator nije sortiran: %q posle %q", it.Key(), prev)
+					}
+					prev = it.Key()
+				}
+				if err := it.Err(); err != nil {
+					t.Error(err)
+				}
+				it.Close()
+
+				snap := e.NewSnapshot()
+				first := e.RangeScan("w0", "w9", ReadOptions{Snapshot: snap})
+				second := e.PrefixScanAll("w", ReadOptions{Snapshot: snap})
+				snap.Release()
+				if !reflect.DeepEqual(first, second) {
+					t.Errorf("snapshot je video upise posle svog nastanka: %d i %d kljuceva", len(first), len(second))
+				}
+			}
+		}(r)
+	}
+
+	// eksplicitni flush i potpuna kompakcija, uz one koje pokrece pozadina
+	othersWG.Add(1)
+	go func() {
+		defer othersWG.Done()
+		for running() {
+			e.FlushAllMemtables()
+			compactAll(t, e)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	writersWG.Wait()
+	close(done)
+	othersWG.Wait()
+	if t.Failed() {
+		return
+	}
+
+	want := make(map[string][]byte)
+	for _, model := range models {
+		for key, value := range model {
+			want[key] = []byte(value)
+		}
+	}
+	check := func(e *Engine) {
+		t.Helper()
+		if got := e.PrefixScanAll("w"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("stanje baze se razlikuje od ocekivanog: %d kljuceva, ocekivano %d", len(got), len(want))
+		}
+		for g := 0; g < writers; g++ {
+			for k := 0; k < keys; k++ {
+				key := fmt.Sprintf("w%d-k%02d", g, k)
+				if value, ok := want[key]; ok {
+					mustGet(t, e, key, string(value))
+				} else {
+					mustMiss(t, e, key)
+				}
+			}
+		}
+	}
+	check(e)
+
+	// isto stanje i posle ponovnog otvaranja (replay WAL-a i manifest)
+	e = reopen(t, e, dir)
+	check(e)
+}
@@ -0,0 +1,88 @@
+package kvengine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Uslovni upisi
+// Uslov se proverava i upis radi pod istim writeMu, pa izmedju provere i upisa ne moze da se provuce drugi upis
+// Verzija kljuca je redni broj (seq) upisa koji je napravio trenutnu vrednost (GetWithVersion, History)
+
+// ErrKeyExists se vraca iz PutIfAbsent kada kljuc vec postoji
+var ErrKeyExists = errors.New("kljuc vec postoji")
+
+// ErrValueMismatch se vraca iz CompareAndSwap kada trenutna vrednost nije ocekivana
+var ErrValueMismatch = errors.New("trenutna vrednost kljuca nije ocekivana")
+
+// ErrVersionMismatch se vraca iz DeleteIfVersion kada trenutna verzija kljuca nije ocekivana
+var ErrVersionMismatch = errors.New("trenutna verzija kljuca nije ocekivana")
+
+// GetWithVersion vraca vrednost kljuca i njegovu verziju
+func (e *Engine) GetWithVersion(key string) ([]byte, uint64, bool) {
+	if !e.RateLimiter.Allow() {
+		fmt.Println("previse zahteva!")
+		return nil, 0, false
+	}
+
+	entry, found := e.versionAt(key, math.MaxUint64)
+	if !found || entry.Tombstone || entry.Expired(time.Now().UnixNano()) {
+		return nil, 0, false
+	}
+	return entry.Value, entry.Seq, true
+}
+
+// PutIfAbsent upisuje vrednost samo ako kljuc ne postoji (ili je obrisan ili istekao), inace vraca ErrKeyExists
+func (e *Engine) PutIfAbsent(key string, value []byte, opts ...WriteOptions) error {
+	return e.writeIf(batchOp{key: key, value: value}, opts, func(current []byte, _ uint64, found bool) error {
+		if found {
+			return ErrKeyExists
+		}
+		return nil
+	})
+}
+
+// CompareAndSwap upisuje novu vrednost samo ako je trenutna jednaka ocekivanoj, inace vraca ErrValueMismatch
+// expected nil znaci da kljuc ne sme da postoji
+func (e *Engine) CompareAndSwap(key string, expected, value []byte, opts ...WriteOptions) error {
+	return e.writeIf(batchOp{key: key, value: value}, opts, func(current []byte, _ uint64, found bool) error {
+		if expected == nil && found || expected != nil && (!found || !bytes.Equal(current, expected)) {
+			return ErrValueMismatch
+		}
+		return nil
+	})
+}
+
+// DeleteIfVersion brise kljuc samo ako je njegova trenutna verzija jednaka datoj, inace vraca ErrVersionMismatch
+func (e *Engine) DeleteIfVersion(key string, version uint64, opts ...WriteOptions) error {
+	return e.writeIf(batchOp{key: key, delete: true}, opts, func(_ []byte, seq uint64, found bool) error {
+		if !found || seq != version {
+			return ErrVersionMismatch
+		}
+		return nil
+	})
+}
+
+// writeIf upisuje op ako check za trenutnu vrednost i verziju kljuca ne vrati gresku
+func (e *Engine) writeIf(op batchOp, opts []WriteOptions, check func(current []byte, seq uint64, found bool) error) error {
+	if !e.RateLimiter.Allow() {
+		return fmt.Errorf("previse zahteva!")
+	}
+
+	e.writeMu.Lock()
+	entry, found := e.versionAt(op.key, math.MaxUint64)
+	found = found && !entry.Tombstone && !entry.Expired(time.Now().UnixNano())
+	if err := check(entry.Value, entry.Seq, found); err != nil {
+		e.writeMu.Unlock()
+		return err
+	}
+	pos, err := e.writeLocked([]batchOp{op})
+	e.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return e.waitWAL(pos, opts)
+}
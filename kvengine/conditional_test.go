@@ -0,0 +1,99 @@
+package kvengine
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPutIfAbsent(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.PutIfAbsent("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.PutIfAbsent("a", []byte("2")); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("ocekivan ErrKeyExists, dobijeno %v", err)
+	}
+	mustGet(t, e, "a", "1")
+
+	// obrisan kljuc se racuna kao da ne postoji
+	e.Delete("a")
+	if err := e.PutIfAbsent("a", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, e, "a", "3")
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.CompareAndSwap("a", nil, []byte("1")); err != nil {
+		t.Fatalf("CAS na nepostojecem kljucu: %v", err)
+	}
+	if err := e.CompareAndSwap("a", nil, []byte("x")); !errors.Is(err, ErrValueMismatch) {
+		t.Fatalf("ocekivan ErrValueMismatch, dobijeno %v", err)
+	}
+	if err := e.CompareAndSwap("a", []byte("pogresna"), []byte("x")); !errors.Is(err, ErrValueMismatch) {
+		t.Fatalf("ocekivan ErrValueMismatch, dobijeno %v", err)
+	}
+	if err := e.CompareAndSwap("a", []byte("1"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, e, "a", "2")
+
+	// vrednost iz SSTable-a se poredi isto kao iz Memtable
+	flushAll(t, e)
+	if err := e.CompareAndSwap("a", []byte("2"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, e, "a", "3")
+}
+
+func TestDeleteIfVersion(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("a", []byte("1"))
+	_, version, found := e.GetWithVersion("a")
+	if !found {
+		t.Fatal("kljuc ne postoji")
+	}
+
+	e.Put("a", []byte("2"))
+	if err := e.DeleteIfVersion("a", version); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("ocekivan ErrVersionMismatch, dobijeno %v", err)
+	}
+	mustGet(t, e, "a", "2")
+
+	_, version, _ = e.GetWithVersion("a")
+	if err := e.DeleteIfVersion("a", version); err != nil {
+		t.Fatal(err)
+	}
+	mustMiss(t, e, "a")
+	if err := e.DeleteIfVersion("a", version); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("brisanje vec obrisanog kljuca: %v", err)
+	}
+}
+
+// od vise istovremenih CAS-ova sa istom ocekivanom vrednoscu uspeva tacno jedan
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("a", []byte("0"))
+
+	var wins int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := e.CompareAndSwap("a", []byte("0"), []byte("1"))
+			if err == nil {
+				atomic.AddInt64(&wins, 1)
+			} else if !errors.Is(err, ErrValueMismatch) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins != 1 {
+		t.Fatalf("uspelo je %d CAS-ova, ocekivan tacno jedan", wins)
+	}
+}
@@ -0,0 +1,222 @@
+package kvengine
+
+import (
+	"fmt"
+	"napredni/config"
+	"napredni/ratelimiter"
+	"napredni/sstable"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testConfig su mala podesavanja, da bi flush i kompakcija radili vec posle nekoliko desetina upisa
+func testConfig() config.Config {
+	return config.Config{
+		MemtableType:         "skiplist",
+		MemtableMaxEntries:   16,
+		MemtableMaxTables:    2,
+		WALSegmentBytes:      4096,
+		WALSyncMode:          "none",
+		MaxSSTableLevels:     4,
+		SSTableFilesPerLevel: 2,
+		LevelBaseBytes:       8192,
+		LevelSizeMultiplier:  4,
+		CompactionWorkers:    1,
+		TargetFileSizeBytes:  2048,
+		BlockSizeKBK:         1,
+		CacheCapacity:        64,
+		SummaryKeyDistance:   3,
+	}
+}
+
+// openTestEngine otvara bazu u dir (prazan string - nov privremeni folder) sa datim podesavanjima
+// Engine trazi snapshot Memtable-a relativno u odnosu na radni folder, pa se test izvrsava u dir
+func openTestEngine(t *testing.T, dir string, cfg config.Config) (*Engine, string) {
+	t.Helper()
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	config.Current = cfg
+	e := NewEngine(cfg.MemtableMaxEntries, filepath.Join(dir, "wal"), filepath.Join(dir, "sstables"))
+	e.RateLimiter = ratelimiter.NewTokenBucket(1<<30, 1)
+	t.Cleanup(e.Close)
+	return e, dir
+}
+
+func newTestEngine(t *testing.T) *Engine {
+	e, _ := openTestEngine(t, "", testConfig())
+	return e
+}
+
+// reopen zatvara bazu i otvara je ponovo iz istog foldera (WAL replay i manifest)
+func reopen(t *testing.T, e *Engine, dir string) *Engine {
+	t.Helper()
+	e.Close()
+	reopened, _ := openTestEngine(t, dir, config.Current)
+	return reopened
+}
+
+func mustGet(t *testing.T, e *Engine, key, want string) {
+	t.Helper()
+	value, found := e.Get(key)
+	if !found || string(value) != want {
+		t.Fatalf("Get(%q) = %q, %v; ocekivano %q", key, value, found, want)
+	}
+}
+
+func mustMiss(t *testing.T, e *Engine, key string) {
+	t.Helper()
+	if value, found := e.Get(key); found {
+		t.Fatalf("Get(%q) = %q, ocekivano da kljuc ne postoji", key, value)
+	}
+}
+
+// flushAll upisuje sve Memtable-ove, i RW, u SSTable-ove
+func flushAll(t *testing.T, e *Engine) {
+	t.Helper()
+	e.writeMu.Lock()
+	if e.GetMemtable().Size() > 0 {
+		e.switchMemtable()
+		e.WalWriter.Rotate()
+	}
+	e.writeMu.Unlock()
+	e.FlushAllMemtables()
+}
+
+// compactAll spaja sve tabele u jednu (ili vise disjunktnih na poslednjem nivou)
+func compactAll(t *testing.T, e *Engine) {
+	t.Helper()
+	if err := sstable.CompactSSTables(e.Manifest, e.BlockManager); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// redni broj upisa se posle flush-a (WAL je obrisan) i ponovnog otvaranja nastavlja iz manifesta,
+// pa nova verzija kljuca ima veci broj od verzije u starijoj tabeli
+func TestSeqPersistsAcrossReopen(t *testing.T) {
+	e, dir := openTestEngine(t, "", testConfig())
+	for _, value := range []string{"v1", "v2", "v3"} {
+		if err := e.Put("k", []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flushAll(t, e)
+	before := e.lastSeq
+
+	e = reopen(t, e, dir)
+	if e.lastSeq != before {
+		t.Fatalf("posle ponovnog otvaranja lastSeq = %d, ocekivano %d", e.lastSeq, before)
+	}
+	if err := e.Put("k", []byte("v4")); err != nil {
+		t.Fatal(err)
+	}
+	if e.lastSeq != before+1 {
+		t.Fatalf("novi upis ima redni broj %d, ocekivano %d", e.lastSeq, before+1)
+	}
+	flushAll(t, e)
+
+	// kompakcija bira verziju sa vecim rednim brojem
+	compactAll(t, e)
+	e = reopen(t, e, dir)
+	mustGet(t, e, "k", "v4")
+}
+
+// flusher u pozadini prazni RO Memtable dok upisi idu dalje, ne ostaje vise RO Memtable nego sto je dozvoljeno
+func TestBackgroundFlushDrainsImmutableMemtables(t *testing.T) {
+	cfg := testConfig()
+	cfg.SSTableFilesPerLevel = 100 // bez kompakcije, svaki flush ostaje kao tabela na L0
+	cfg.L0StopWritesTrigger = 1000
+	e, dir := openTestEngine(t, "", cfg)
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		if err := e.Put(fmt.Sprintf("k%03d", i), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// upisi ne cekaju flush, pa se ceka da ga pozadina zavrsi
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.mu.RLock()
+		count := len(e.Memtables)
+		e.mu.RUnlock()
+		if count <= cfg.MemtableMaxTables {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("flusher nije ispraznio RO Memtable: %d Memtable-ova", count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// RW Memtable ima najvise memCap zapisa, a RO najvise MemtableMaxTables-1, ostalo je na L0
+	inMemory := cfg.MemtableMaxEntries * cfg.MemtableMaxTables
+	if tables := len(e.Manifest.LevelTables(0)); tables < (n-inMemory)/cfg.MemtableMaxEntries {
+		t.Fatalf("na L0 je %d tabela, ocekivano bar %d", tables, (n-inMemory)/cfg.MemtableMaxEntries)
+	}
+	for i := 0; i < n; i++ {
+		mustGet(t, e, fmt.Sprintf("k%03d", i), fmt.Sprint(i))
+	}
+
+	// WAL segmenti upisanih Memtable-ova su obrisani, ostaju samo segmenti onih u memoriji
+	segments, err := filepath.Glob(filepath.Join(dir, "wal", "wal_segment_*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) > cfg.MemtableMaxTables+1 {
+		t.Fatalf("posle flush-a je ostalo %d WAL segmenata", len(segments))
+	}
+
+	e = reopen(t, e, dir)
+	for i := 0; i < n; i++ {
+		mustGet(t, e, fmt.Sprintf("k%03d", i), fmt.Sprint(i))
+	}
+}
+
+// max_sstable_files ne zaustavlja upise: posle flush-a ima vise tabela nego sto kaze kljuc,
+// a kompakcija po nivoima ih i dalje drzi po nivoima umesto da sve spoji u jednu
+func TestMaxSSTableFilesDoesNotStallWrites(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxSSTableFiles = 2
+	e, _ := openTestEngine(t, "", cfg)
+
+	const n = 300
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := e.Put(fmt.Sprintf("k%03d", i), []byte(fmt.Sprint(i))); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("upisi stoje posle 10s, max_sstable_files ne sme da zaustavi upise")
+	}
+
+	flushAll(t, e)
+	if tables := len(e.Manifest.Tables()); tables <= cfg.MaxSSTableFiles {
+		t.Fatalf("u bazi je %d tabela, ocekivano vise od %d", tables, cfg.MaxSSTableFiles)
+	}
+	for i := 0; i < n; i++ {
+		mustGet(t, e, fmt.Sprintf("k%03d", i), fmt.Sprint(i))
+	}
+}
@@ -0,0 +1,133 @@
+package kvengine
+
+import (
+	"fmt"
+	"napredni/sstable"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Citanje starijih verzija kljuca
+// Memtable-ovi i tabele cuvaju vise verzija kljuca; kompakcija izbacuje stare verzije, osim onih koje
+// cuva version_retention iz konfiguracije (po prefiksu kljuca) ili zivi snapshot
+// Za trenutak pre najstarije sacuvane verzije kljuc se ne nalazi
+
+// Version je jedna sacuvana verzija kljuca
+type Version struct {
+	Seq     uint64    // redni broj upisa
+	Time    time.Time // vreme upisa, nulto za zapise iz starijih verzija baze
+	Value   []byte
+	Deleted bool      // verzija je brisanje kljuca
+	Expires time.Time // vreme isteka (PutWithTTL), nulto ako verzija ne istice
+}
+
+// ReadPoint je trenutak u istoriji baze, zadat rednim brojem upisa (AtSequence) ili vremenom (AtTime)
+type ReadPoint struct {
+	seq    uint64
+	time   time.Time
+	byTime bool
+}
+
+// AtSequence je stanje baze posle upisa sa rednim brojem seq
+func AtSequence(seq uint64) ReadPoint {
+	return ReadPoint{seq: seq}
+}
+
+// AtTime je stanje baze u trenutku t
+func AtTime(t time.Time) ReadPoint {
+	return ReadPoint{time: t, byTime: true}
+}
+
+func (p ReadPoint) String() string {
+	if p.byTime {
+		return p.time.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("seq %d", p.seq)
+}
+
+// GetAt vraca vrednost kljuca kakva je bila u trenutku at
+func (e *Engine) GetAt(key string, at ReadPoint) ([]byte, bool) {
+	if !e.RateLimiter.Allow() {
+		fmt.Println("previse zahteva!")
+		return nil, false
+	}
+
+	fmt.Printf(" GET_AT kljuc: %s (%s)\n", key, at)
+
+	if !at.byTime {
+		return e.getAt(key, at.seq)
+	}
+
+	// vreme upisa raste sa rednim brojem, pa je prva verzija upisana do trenutka at ona koja je tada vazila
+	// istekla vrednost se ne vidi, kao i u getAt
+	now := time.Now().UnixNano()
+	for _, v := range e.history(key) {
+		if v.Timestamp > at.time.UnixNano() {
+			continue
+		}
+		if v.Tombstone || v.Expired(now) {
+			return nil, false
+		}
+		atomic.AddInt64(&e.GetCount, 1)
+		return v.Value, true
+	}
+	return nil, false
+}
+
+// History vraca sve sacuvane verzije kljuca, od najnovije ka najstarijoj, ukljucujuci brisanja
+func (e *Engine) History(key string) ([]Version, error) {
+	if !e.RateLimiter.Allow() {
+		return nil, fmt.Errorf("previse zahteva!")
+	}
+
+	entries := e.history(key)
+	versions := make([]Version, 0, len(entries))
+	for _, entry := range entries {
+		v := Version{Seq: entry.Seq, Value: entry.Value, Deleted: entry.Tombstone}
+		if entry.Timestamp != 0 {
+			v.Time = time.Unix(0, entry.Timestamp)
+		}
+		if entry.ExpiresAt != 0 {
+			v.Expires = time.Unix(0, entry.ExpiresAt)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// history skuplja verzije kljuca iz Memtable-ova i tabela, po Seq opadajuce
+// Memtable koja se upravo flush-uje moze biti i u listi i u tabeli, pa se ista verzija (isti Seq) uzima jednom
+func (e *Engine) history(key string) []sstable.Entry {
+	// prvo Memtable-ovi pa tabele, kao u newIterator
+	memtables, _ := e.readView()
+	dels := e.rangeTombstones(memtables)
+	var all []sstable.Entry
+	for _, mt := range memtables {
+		all = append(all, mt.Versions(key)...)
+	}
+	all = append(all, sstable.VersionsFromSSTables(e.Manifest, key, e.BlockManager)...)
+
+	// brisanje opsega koje pokriva kljuc je u istoriji kao brisanje kljuca, ako je postojala starija verzija koju sakriva
+	for _, del := range dels {
+		if !del.Contains(key) {
+			continue
+		}
+		for _, v := range all {
+			if v.Seq < del.Seq && !v.Tombstone {
+				all = append(all, sstable.Entry{Key: key, Tombstone: true, Seq: del.Seq, Timestamp: del.Timestamp})
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Seq > all[j].Seq })
+	var versions []sstable.Entry
+	for _, v := range all {
+		if len(versions) > 0 && versions[len(versions)-1].Seq == v.Seq {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
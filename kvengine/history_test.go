@@ -0,0 +1,72 @@
+package kvengine
+
+import (
+	"napredni/config"
+	"testing"
+	"time"
+)
+
+func mustHistory(t *testing.T, e *Engine, key string) []Version {
+	t.Helper()
+	history, err := e.History(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return history
+}
+
+func TestGetAtAndHistory(t *testing.T) {
+	cfg := testConfig()
+	cfg.VersionRetention = []config.VersionRetention{{Prefix: "h", MaxVersions: 3}}
+	e, _ := openTestEngine(t, "", cfg)
+
+	for _, value := range []string{"1", "2"} {
+		e.Put("h", []byte(value))
+		e.Put("x", []byte(value))
+	}
+	e.Delete("h")
+	e.Put("h", []byte("4"))
+
+	history := mustHistory(t, e, "h")
+	if len(history) != 4 || string(history[0].Value) != "4" || !history[1].Deleted ||
+		string(history[2].Value) != "2" || string(history[3].Value) != "1" {
+		t.Fatalf("neocekivana istorija: %+v", history)
+	}
+	v2, deleted, v1 := history[2], history[1], history[3]
+
+	check := func(at ReadPoint, want string) {
+		t.Helper()
+		value, found := e.GetAt("h", at)
+		if want == "" {
+			if found {
+				t.Fatalf("GetAt(%s) = %q, ocekivano da kljuc ne postoji", at, value)
+			}
+			return
+		}
+		if !found || string(value) != want {
+			t.Fatalf("GetAt(%s) = %q, %v; ocekivano %q", at, value, found, want)
+		}
+	}
+	check(AtSequence(v2.Seq), "2")
+	check(AtSequence(deleted.Seq), "")
+	check(AtSequence(v1.Seq), "1")
+	check(AtSequence(v1.Seq-1), "")
+	check(AtTime(v2.Time), "2")
+	check(AtTime(v1.Time.Add(-time.Nanosecond)), "")
+	check(AtTime(time.Now()), "4")
+
+	// kompakcija cuva tri verzije za prefiks "h", a za ostale kljuceve samo najnoviju
+	flushAll(t, e)
+	e.Put("y", []byte("1"))
+	flushAll(t, e)
+	compactAll(t, e)
+
+	if history := mustHistory(t, e, "h"); len(history) != 3 || history[2].Seq != v2.Seq {
+		t.Fatalf("posle kompakcije ocekivane 3 verzije, dobijeno %+v", history)
+	}
+	check(AtSequence(v2.Seq), "2")
+	check(AtSequence(v1.Seq), "")
+	if history := mustHistory(t, e, "x"); len(history) != 1 || string(history[0].Value) != "2" {
+		t.Fatalf("kljuc bez pravila treba da ima samo najnoviju verziju: %+v", history)
+	}
+}
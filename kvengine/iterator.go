@@ -0,0 +1,149 @@
+package kvengine
+
+import (
+	"napredni/sstable"
+)
+
+// Iterator je iterator nad celom bazom (Memtable-ovi i SSTable-ovi), vidi sstable.Iterator
+// vraca samo zive kljuceve, sa najnovijom vrednoscu u trenutku pravljenja iteratora (ili snapshot-a iz ReadOptions),
+// kasniji upisi se ne vide; posle upotrebe mora da se pozove Close
+type Iterator = sstable.Iterator
+
+// engineIterator je MergingIterator ogranicen na opseg [lower, upper)
+// tabele koje cita su zakacene (PinTables), pa kompakcija za to vreme moze da radi, ali ne brise njihove fajlove
+type engineIterator struct {
+	sstable.Iterator
+	manifest *sstable.Manifest
+	tables   []sstable.TableMeta
+	snap     *Snapshot // snapshot koji je iterator sam napravio, nil ako ga je dao korisnik
+	lower    string    // najmanji dozvoljeni kljuc
+	upper    string    // prvi kljuc van opsega, "" - bez gornje granice
+	closed   bool
+}
+
+// NewIterator pravi iterator nad svim kljucevima u bazi
+func (e *Engine) NewIterator(opts ...ReadOptions) Iterator {
+	return e.newIterator("", "", opts)
+}
+
+// NewRangeIterator pravi iterator nad kljucevima iz opsega [from, to]
+func (e *Engine) NewRangeIterator(from, to string, opts ...ReadOptions) Iterator {
+	return e.newIterator(from, to+"\x00", opts)
+}
+
+// NewPrefixIterator pravi iterator nad kljucevima koji pocinju na dati prefix
+func (e *Engine) NewPrefixIterator(prefix string, opts ...ReadOptions) Iterator {
+	return e.newIterator(prefix, prefixEnd(prefix), opts)
+}
+
+// prefixEnd vraca najmanji kljuc veci od svih kljuceva sa datim prefiksom ("" ako takav ne postoji)
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+func (e *Engine) newIterator(lower, upper string, opts []ReadOptions) Iterator {
+	// bez snapshot-a iterator pravi svoj, na poslednjem vidljivom upisu, i pusta ga u Close;
+	// snapshot se belezi pre uzimanja Memtable-ova, pa kompakcija ne izbacuje verzije koje iterator vidi
+	// ni iz tabela u koje se te Memtable-ove u medjuvremenu flush-uju
+	snap := snapshotOf(opts)
+	var own *Snapshot
+	if snap == nil {
+		own = e.NewSnapshot()
+		snap = own
+	}
+	seq := snap.seq
+
+	// prvo Memtable-ovi pa tabele: ako se Memtable izmedju toga flush-uje, njeni zapisi su u oba, a ne ni u jednom
+	memtables, _ := e.readView()
+	tables := e.Manifest.PinTables()
+
+	// brisanja opsega iz zakacenih tabela, a ne iz manifesta, da odgovaraju verzijama koje iterator cita
+	children := make([]sstable.InternalIterator, 0, len(memtables)+len(tables))
+	var dels []sstable.RangeTombstone
+	for _, mt := range memtables {
+		children = append(children, mt.NewIterator())
+		dels = append(dels, mt.RangeTombstones()...)
+	}
+	dels = append(dels, sstable.RangeTombstonesOf(tables)...)
+	for _, t := range tables {
+		if t.Count == 0 || t.MaxKey < lower || (upper != "" && t.MinKey >= upper) {
+			continue
+		}
+		children = append(children, sstable.NewTableIterator(e.Manifest, t, e.BlockManager))
+	}
+
+	return &engineIterator{
+		Iterator: sstable.NewMergingIterator(children, seq, dels),
+		manifest: e.Manifest,
+		tables:   tables,
+		snap:     own,
+		lower:    lower,
+		upper:    upper,
+	}
+}
+
+func (it *engineIterator) Seek(key string) {
+	if key < it.lower {
+		key = it.lower
+	}
+	it.Iterator.Seek(key)
+}
+
+func (it *engineIterator) SeekToFirst() {
+	it.Iterator.Seek(it.lower)
+}
+
+func (it *engineIterator) SeekToLast() {
+	if it.upper == "" {
+		it.Iterator.SeekToLast()
+		return
+	}
+	// poslednji kljuc pre gornje granice
+	it.Iterator.Seek(it.upper)
+	if it.Iterator.Valid() {
+		it.Iterator.Prev()
+	} else if it.Iterator.Err() == nil {
+		it.Iterator.SeekToLast()
+	}
+}
+
+func (it *engineIterator) Valid() bool {
+	if it.closed || !it.Iterator.Valid() {
+		return false
+	}
+	key := it.Iterator.Key()
+	return key >= it.lower && (it.upper == "" || key < it.upper)
+}
+
+func (it *engineIterator) Next() {
+	if it.Valid() {
+		it.Iterator.Next()
+	}
+}
+
+func (it *engineIterator) Prev() {
+	if it.Valid() {
+		it.Iterator.Prev()
+	}
+}
+
+// Close zatvara iterator i pusta tabele (i svoj snapshot) koje je drzao
+func (it *engineIterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	err := it.Iterator.Close()
+	it.manifest.UnpinTables(it.tables)
+	if it.snap != nil {
+		it.snap.Release()
+	}
+	return err
+}
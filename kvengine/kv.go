@@ -2,6 +2,7 @@ package kvengine
 
 import (
 	"fmt"
+	"math"
 	"napredni/blockmanager"
 	"napredni/cache"
 	"napredni/config"
@@ -12,12 +13,24 @@ import (
 	"os"
 	"path/filepath"
 	"time"
-	"sort"
-	"strings"
+	"sync"
+	"sync/atomic"
 
 )
 
 // Engine predstavlja celu "bazicu" - cuva sve potrebne delove sistema
+//
+// Model konkurentnosti (Engine sme da se koristi iz vise gorutina istovremeno):
+//   - upisi (Put, Delete) su serijalizovani preko writeMu, u jednom trenutku upisuje samo jedna gorutina
+//   - fsync WAL-a se ceka tek posle pustanja writeMu (vidi waitWAL), pa pisci koji cekaju dele isti fsync;
+//     zapis je vidljiv citaocima cim je u Memtable, a Put/Delete vraca odgovor tek kada je fsync-ovan
+//   - flush i kompakcija rade u pozadini (vidi background.go), flush-ovi su medjusobno serijalizovani preko flushMu
+//   - mu cuva listu Memtables; lista se nikad ne menja u mestu nego se pravi nova (zamena Memtable je atomska),
+//     pa citalac pod RLock-om samo uzme trenutnu listu i dalje cita bez zakljucavanja Engine-a
+//   - RO Memtable se posle zamene vise ne menjaju; svaka Memtable ima svoj RWMutex, pa citaoci ne cekaju jedni druge
+//   - citanje SSTable-ova drzi Manifest.RLockFiles, da kompakcija ne bi obrisala fajlove usred citanja
+//   - Get upisuje u kes samo ako se za vreme citanja nije desio nijedan upis (applied), inace bi mogao da vrati staru vrednost u kes
+//   - PutCount, GetCount i lastSeq se menjaju atomski
 type Engine struct {
 	Memtables []memtable.MemtableInterface // aktivna Memtable u RAM-u
 	DataPath  string                       // putanja ka folderu sa SSTable-ovima
@@ -25,121 +38,38 @@ type Engine struct {
 	walDir    string                       // folder gde se nalaze WAL fajlovi
 	memCap    int                          // kapacitet Memtable
 	Cache     *cache.LRUCache              // kes
-	PutCount  int                          // za ispis informacija o bazi
-	GetCount  int                          // -||-
+	PutCount  int64                        // za ispis informacija o bazi
+	GetCount  int64                        // -||-
 
 	RateLimiter       *ratelimiter.TokenBucket   // rejt limiter
 	BlockManager      *blockmanager.BlockManager // block manager, za block cache
-	walSegmentCounter int
+	Manifest          *sstable.Manifest          // spisak zivih SSTable-ova, nivoa i opsega kljuceva
+	WALRecovery       wal.RecoveryReport         // kako je prosao replay WAL-a pri pokretanju
+	lastSeq           uint64                     // poslednji dodeljen redni broj upisa (dodeljuje se pod writeMu)
+	walSegmentCounter int                        // postavlja se samo u NewEngine
+
+	mu         sync.RWMutex // cuva listu Memtables, applied, visibleSeq i bgErr
+	writeMu    sync.Mutex   // serijalizuje upise
+	flushMu    sync.Mutex   // serijalizuje flush Memtable-ova (pozadina i FlushAllMemtables)
+	applied    uint64       // broj upisa primenjenih na Memtable, za proveru pri punjenju kesa
+	visibleSeq uint64       // redni broj poslednjeg upisa primenjenog na Memtable, do njega vide iteratori i snapshot-ovi
+
+	// pozadinski flush i kompakcija
+	roomCond  *sync.Cond // na njemu cekaju upisi u write stall-u, vezan za mu
+	bgErr     error      // greska iz pozadine, posle nje upisi ne prolaze
+	flushCh   chan struct{}
+	compactCh chan struct{}
+	stopCh    chan struct{}
+	bgWG      sync.WaitGroup
+	closeOnce sync.Once
+	slowdown  *ratelimiter.TokenBucket // usporava upise dok kompakcija kasni
+	stallMu   sync.Mutex
+	stalls    StallStats
 }
 
-// PrefixIterator je iterator za kljuceve koji pocinju na dati prefix
-type PrefixIterator struct {
-	keys   []string
-	values [][]byte
-	index  int // trenutna pozicija u listi
-}
-
-type RangeIterator struct {
-	keys   []string          // Lista ključeva sortirana
-	values map[string][]byte // Mapa: ključ -> vrednost
-	pos    int               // Trenutna pozicija iteratora
-}
-// NewPrefixIterator u sustini samo pravi novi PrefixIterator za zadati prefix
-func (e *Engine) NewPrefixIterator(prefix string) *PrefixIterator {
-	results := e.PrefixScanAll(prefix)
-
-	// sortira kljuceve
-	var keys []string
-	for k := range results {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	// pravi niz vrednost u istom redosledu kao kljucevi
-	var values [][]byte
-	for _, k := range keys {
-		values = append(values, results[k])
-	}
-
-	return &PrefixIterator{
-		keys:   keys,
-		values: values,
-		index:  0,
-	}
-
-}
-
-// Next vraca sledeci (key, value) par ili "" i nil ako nema vise
-func (it *PrefixIterator) Next() (string, []byte) {
-	if it.index >= len(it.keys) {
-		return "", nil
-	}
-
-	key := it.keys[it.index]
-	value := it.values[it.index]
-	it.index++
-	return key, value
-
-}
-
-// Stop resetuje iterator
-func (it *PrefixIterator) Stop() {
-	it.keys = nil
-	it.values = nil
-	it.index = 0
-
-}
-
-// NewRangeIterator pravi novi RangeIterator za dati opseg ključeva
-func (e *Engine) NewRangeIterator(from, to string) *RangeIterator {
-	all := e.RangeScan(from, to)
-	keys := make([]string, 0, len(all))
-
-	for k := range all {
-		keys = append(keys, k)
-	}
-
-	sort.Strings(keys)
-
-	return &RangeIterator{
-		keys:   keys,
-		values: all,
-		pos:    0,
-	}
-
-}
-
-// Next vraca sledeci (key, value) par ili "" i nil ako nema vise
-func (it *RangeIterator) Next() (string, []byte, bool) {
-	if it.pos >= len(it.keys) {
-		return "", nil, false
-	}
-	key := it.keys[it.pos]
-	val := it.values[key]
-	it.pos++
-	return key, val, true
-}
-
-// Stop resetuje iterator
-func (it *RangeIterator) Stop() {
-	it.keys = nil
-	it.values = nil
-	it.pos = 0
-}
-
-
 // NewEngine pravi novi Engine sa prosledjenim podacima
 func NewEngine(memCap int, walDir string, sstableDir string) *Engine {
-	var mt memtable.MemtableInterface
-	switch config.Current.MemtableType {
-	case "hashmap":
-		mt = memtable.NewHashMapMemtable(memCap)
-	case "skiplist":
-		mt = memtable.NewSkipListMemtable(16, 0.5)
-	default:
-		panic("nepoznat tip memtable")
-	}
+	mt := newMemtable(memCap)
 
 	bm := blockmanager.NewBlockManager(config.Current.BlockSizeKBK, config.Current.CacheCapacity)
 
@@ -156,32 +86,64 @@ func NewEngine(memCap int, walDir string, sstableDir string) *Engine {
 
 	/*walCounter := wal.FindMaxSegmentIndex(walDir) + 1
 	// 2. Inicijalizuj WAL wirter
-	w, err := wal.NewWriter(walDir, config.Current.WALSegmentSize, bm) // segment size moze biti hardkodiran za sada
+	w, err := wal.NewWriter(walDir, config.Current.WALSegmentBytes, bm, syncOptions) // segment size moze biti hardkodiran za sada
 	if err != nil {
 		panic(fmt.Sprintf("ne mogu da inicijalizujem WAl: %v", err))
 	}
 	w.SetCurrentIndex(walCounter)*/
 
-	// 2. Inicijalizuj WAL writer (on automatski nastavlja na nepopunjen segment)
-	w, err := wal.NewWriter(walDir, config.Current.WALSegmentSize, bm)
+	manifest, err := sstable.OpenManifest(sstableDir, bm)
 	if err != nil {
-		panic(fmt.Sprintf("ne mogu da inicijalizujem WAL: %v", err))
+		panic(fmt.Sprintf("ne mogu da ucitam manifest: %v", err))
 	}
 
-	// Preuzmi koji je index aktivnog segmenta
-	walCounter := w.GetCurrentIndex()
+	e := &Engine{
+		Memtables:    []memtable.MemtableInterface{mt}, // pravimo slice sa jednim aktivnim mt
+		DataPath:     sstableDir,
+		walDir:       walDir,
+		memCap:       memCap,
+		Cache:        cache.NewLRUCache(100),
+		BlockManager: bm,
+		Manifest:     manifest,
+		lastSeq:      manifest.LastSequence(), // replay WAL-a ga pomera na najveci broj iz WAL-a
+	}
+	e.roomCond = sync.NewCond(&e.mu)
 
 	// ako ne postoji snapshot - uradi replay wal
+	// replay ide pre WAL writer-a: on (prema wal_recovery_mode) odseca ostecen kraj WAL-a, pa writer nastavlja iza validnih zapisa
 	snapshotPath := filepath.Join("data", "memtable.snapshot")
 	if _, err := os.Stat(snapshotPath); os.IsNotExist(err) {
 		fmt.Println(" Snapshot nije pronadjen, pokrecem Replay WAL...")
-		if err := wal.ReplayWAL(bm, walDir, mt); err != nil {
-			fmt.Println(" Greska pri Replay WAL:", err)
+		e.WALRecovery, err = wal.ReplayWAL(bm, walDir, config.Current.WALRecoveryMode, e.replayRecord)
+		if err != nil {
+			panic(fmt.Sprintf("ne mogu da oporavim WAL: %v", err))
 		}
+		fmt.Println("", e.WALRecovery)
+		fmt.Printf(" Posle replay-a: %d Memtable (1 RW, %d RO)\n", len(e.Memtables), len(e.Memtables)-1)
 	} else {
-		fmt.Println(" Snapshot postoji, preskacem WAL")
+		// zapisi se ne vracaju, ali ostecenja u WAL-u se i dalje obradjuju prema wal_recovery_mode
+		fmt.Println(" Snapshot postoji, preskacem replay WAL-a")
+		e.WALRecovery, err = wal.ReplayWAL(bm, walDir, config.Current.WALRecoveryMode, nil)
+		if err != nil {
+			panic(fmt.Sprintf("ne mogu da oporavim WAL: %v", err))
+		}
+	}
+
+	// 2. Inicijalizuj WAL writer (on automatski nastavlja na nepopunjen segment)
+	syncOptions := wal.SyncOptions{
+		Mode:          config.Current.WALSyncMode,
+		GroupInterval: time.Duration(config.Current.WALGroupCommitMs) * time.Millisecond,
+		GroupBytes:    int64(config.Current.WALGroupCommitBytes),
+	}
+	w, err := wal.NewWriter(walDir, config.Current.WALSegmentBytes, bm, syncOptions)
+	if err != nil {
+		panic(fmt.Sprintf("ne mogu da inicijalizujem WAL: %v", err))
 	}
 
+	// Preuzmi koji je index aktivnog segmenta
+	walCounter := w.GetCurrentIndex()
+
+
 	// Ucitaj stanje token bucket-a
 	rateLimiterPath := filepath.Join(sstableDir, "..", "ratelimit.bucket")
 	var rl *ratelimiter.TokenBucket
@@ -204,119 +166,206 @@ func NewEngine(memCap int, walDir string, sstableDir string) *Engine {
 		}
 	}
 
-	return &Engine{
-		Memtables:         []memtable.MemtableInterface{mt}, // pravimo slice sa jednim aktivnim mt
-		DataPath:          sstableDir,
-		WalWriter:         w,
-		walDir:            walDir,
-		memCap:            memCap,
-		Cache:             cache.NewLRUCache(100),
-		RateLimiter:       rl,
-		PutCount:          0,
-		GetCount:          0,
-		BlockManager:      bm,
-		walSegmentCounter: walCounter,
-	}
+	e.WalWriter = w
+	e.RateLimiter = rl
+	e.walSegmentCounter = walCounter
+	e.visibleSeq = e.lastSeq
+	e.startBackground()
+	return e
 }
 
-// E sad ovde isto ne radimo mi nikad valjda sa samo jednim Memtable-om, u interface.go mi imamo zapravo []memtable-a
-// Zasto? Ne znam! Uglavnom samo jedan Memtable moze biti aktivan i u njega se upisuje i iz njega se cita, cim broj podataka u memtable bude prevelik desava se flush i taj memtable valjda postaje READ-ONLY
-// I mi imamo samo jedan aktivan write-read memtable, dok je ostalih n-1 samo read.
-// Zato u funkcijama imamo Memtables[0], a ne obican Memtable
-
-func (e *Engine) Put(key string, value []byte) error {
-	if !e.RateLimiter.Allow() {
-		return fmt.Errorf("previse zahteva!")
+// replayRecord vraca jedan zapis iz WAL-a u Memtable
+// Memtable se pune i promovisu isto kao pri Put/Delete, pa se dobija ista lista RW i RO Memtable kao pre gasenja
+func (e *Engine) replayRecord(segmentPath string, rec wal.Record) error {
+	// batch ide ceo u istu Memtable, kao i pri upisu (makeRoomForWrite)
+	n := 1
+	if len(rec.Batch) > 0 {
+		n = len(rec.Batch)
 	}
+	if e.Memtables[0].Size() > 0 && e.Memtables[0].Size()+n > e.memCap {
+		e.switchMemtable()
+	}
+	// segment se vezuje za Memtable pre eventualnog flush-a, da ga flush ne bi obrisao dok jos ima zapisa za replay
+	e.Memtables[0].AddSegmentPath(segmentPath)
 
-	fmt.Printf(" Trenutna veličina Memtable pre unosa '%s': %d\n", key, e.Memtables[0].Size())
+	if len(e.Memtables) > config.Current.MemtableMaxTables {
+		fmt.Println(">> Previse memtable-ova pri replay-u, flushujemo najstariji!")
+		if err := e.flushOldest(); err != nil {
+			return err
+		}
+	}
 
-	// Ako RW Memtable pun
-	if e.Memtables[0].Size()+1 > e.memCap {
-		fmt.Println(">> Memtable pun - promocija u read-only i kreiranje nove")
+	if len(rec.Batch) == 0 {
+		e.applyRecord(rec)
+		return nil
+	}
+	for _, r := range rec.Batch {
+		e.applyRecord(r)
+	}
+	return nil
+}
 
-		oldMemtable := e.Memtables[0]
-		currentSegment := e.WalWriter.GetCurrentSegmentPath()
-		oldMemtable.SetSegmentPath(currentSegment)
+// applyRecord unosi jedan zapis iz WAL-a u RW Memtable
+func (e *Engine) applyRecord(rec wal.Record) {
+	if rec.Seq > e.lastSeq {
+		e.lastSeq = rec.Seq
+	}
+	if rec.RangeDelete {
+		// kraj opsega je u vrednosti zapisa
+		e.Memtables[0].DeleteRange(string(rec.Key), string(rec.Value), rec.Seq, rec.Timestamp)
+	} else if rec.Tombstone {
+		e.Memtables[0].Delete(string(rec.Key), rec.Seq, rec.Timestamp)
+	} else {
+		// u Memtable unosimo kljuc i vrednost iz wal segmenata po ponovnom pokretanju baze
+		e.Memtables[0].Put(string(rec.Key), rec.Value, rec.Seq, rec.Timestamp, rec.ExpiresAt)
+	}
+	// Debug info:
+	fmt.Printf(" WAL unet u memtable: %s → %s\n", rec.Key, rec.Value)
+}
 
-		fmt.Printf(" Promovisem Memtable u RO — segmentPath: %s\n", currentSegment)
+func newMemtable(memCap int) memtable.MemtableInterface {
+	switch config.Current.MemtableType {
+	case "hashmap":
+		return memtable.NewHashMapMemtable(memCap)
+	case "skiplist":
+		return memtable.NewSkipListMemtable(16, 0.5)
+	default:
+		panic("Nepoznat tip Memtable!")
+	}
+}
 
-		e.Memtables = append(e.Memtables, oldMemtable) // Promoviši u read-only
+// switchMemtable promovise RW Memtable u read-only (na kraj liste, posle starijih RO) i pravi novu praznu RW Memtable
+// pravi se nova lista, pa citaoci vide ili staru ili novu, nikad polovicnu
+func (e *Engine) switchMemtable() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	fmt.Printf(" Promovisem Memtable u RO — segmenti: %v\n", e.Memtables[0].SegmentPaths())
+	memtables := make([]memtable.MemtableInterface, 0, len(e.Memtables)+1)
+	memtables = append(memtables, newMemtable(e.memCap))
+	memtables = append(memtables, e.Memtables[1:]...)
+	memtables = append(memtables, e.Memtables[0])
+	e.Memtables = memtables
+}
 
-		// Napravi novi prazan RW Memtable
-		var newMemtable memtable.MemtableInterface
-		switch config.Current.MemtableType {
-		case "hashmap":
-			newMemtable = memtable.NewHashMapMemtable(e.memCap)
-		case "skiplist":
-			newMemtable = memtable.NewSkipListMemtable(16, 0.5)
-		default:
-			panic("Nepoznat tip Memtable!")
-		}
-		e.Memtables[0] = newMemtable
+// vraca Memtable od najnovije ka najstarijoj: RW, pa RO od poslednje promovisane
+func newestFirst(list []memtable.MemtableInterface) []memtable.MemtableInterface {
+	result := []memtable.MemtableInterface{list[0]}
+	for i := len(list) - 1; i >= 1; i-- {
+		result = append(result, list[i])
 	}
+	return result
+}
 
-	// Ako imamo previse Memtable-ova, FLUSH
-	if len(e.Memtables) > config.Current.MemtableMaxTables {
-		fmt.Println(">> Previse memtable-ova, flushujemo najstariji!")
-		toFlush := e.Memtables[1] // bilo len(e.Memtables)-1
-
-		timestamp := time.Now().UnixNano()
-		sstableDir := filepath.Join(e.DataPath, fmt.Sprintf("sstable_L%d_%d", 0, timestamp))
+// E sad ovde isto ne radimo mi nikad valjda sa samo jednim Memtable-om, u interface.go mi imamo zapravo []memtable-a
+// Zasto? Ne znam! Uglavnom samo jedan Memtable moze biti aktivan i u njega se upisuje i iz njega se cita, cim broj podataka u memtable bude prevelik desava se flush i taj memtable valjda postaje READ-ONLY
+// I mi imamo samo jedan aktivan write-read memtable, dok je ostalih n-1 samo read.
+// Zato u funkcijama imamo Memtables[0], a ne obican Memtable
 
-		err := os.MkdirAll(sstableDir, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("greška pri pravljenju SSTable foldera: %v", err)
-		}
+// WriteOptions su opcije jednog upisa
+type WriteOptions struct {
+	Sync bool // fsync WAL zapisa pre povratka, bez obzira na wal_sync_mode
+}
 
-		err = toFlush.FlushToSSTable(sstableDir, e.BlockManager)
-		if err != nil {
-			return fmt.Errorf("greška pri flush-u Memtable u SSTable: %v", err)
-		}
+// opts je opciono, bez njega vazi wal_sync_mode iz konfiguracije
+func (e *Engine) Put(key string, value []byte, opts ...WriteOptions) error {
+	return e.put(key, value, 0, opts)
+}
 
-		segmentPath := toFlush.GetSegmentPath()
-		fmt.Printf(" Brisem WAL segment: %s\n", segmentPath)
+// PutWithTTL upisuje vrednost koja istice posle ttl; istekao kljuc se ne vidi, a kompakcija ga izbacuje
+// vreme isteka se racuna od upisa i cuva se uz zapis (WAL, Memtable, SSTable), pa vazi i posle restarta
+func (e *Engine) PutWithTTL(key string, value []byte, ttl time.Duration, opts ...WriteOptions) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl mora biti veci od 0")
+	}
+	return e.put(key, value, ttl, opts)
+}
 
-		if err := os.Remove(segmentPath); err != nil {
-			fmt.Printf(" Greska pri brisanju WAL segmenta %s: %v\n", segmentPath, err)
-		}
+// put je zajednicki deo Put i PutWithTTL, ttl 0 - kljuc ne istice
+func (e *Engine) put(key string, value []byte, ttl time.Duration, opts []WriteOptions) error {
+	if !e.RateLimiter.Allow() {
+		return fmt.Errorf("previse zahteva!")
+	}
 
-		// Smanji listu Memtables
-		//e.Memtables = e.Memtables[:len(e.Memtables)-1]
+	e.writeMu.Lock()
 
-		e.Memtables = append(e.Memtables[:1], e.Memtables[2:]...)
+	fmt.Printf(" Trenutna veličina Memtable pre unosa '%s': %d\n", key, e.GetMemtable().Size())
 
-		// Opcionalno: pokreni AutoCompact
-		err = sstable.AutoCompact(e.DataPath, e.BlockManager)
-		if err != nil {
-			return err
-		}
+	// Ako je RW Memtable pun, postaje RO i flush ide u pozadini
+	if err := e.makeRoomForWrite(1); err != nil {
+		e.writeMu.Unlock()
+		return err
 	}
 
 	// 1. Upis u WAL
+	seq, ts := e.nextSeq(), time.Now().UnixNano()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = ts + int64(ttl)
+	}
 	record := wal.Record{
-		Timestamp: uint64(time.Now().UnixNano()),
+		Seq:       seq,
 		Tombstone: false,
 		Key:       []byte(key),
 		Value:     value,
+		Timestamp: ts,
+		ExpiresAt: expiresAt,
 	}
-	err := e.WalWriter.Write(record)
+	pos, err := e.WalWriter.Append(record)
 	if err != nil {
+		e.writeMu.Unlock()
 		return fmt.Errorf("greška pri pisanju u WAL: %v", err)
 	}
 
-	// 2. Upis u RW Memtable
-	e.Memtables[0].Put(key, value)
+	// 2. Upis u RW Memtable i 3. upis u Cache, zajedno da citalac ne bi izmedju upisao staru vrednost u kes
+	segmentPath := e.WalWriter.GetCurrentSegmentPath()
+	e.mu.Lock()
+	e.Memtables[0].AddSegmentPath(segmentPath)
+	e.Memtables[0].Put(key, value, seq, ts, expiresAt)
+	if expiresAt == 0 {
+		e.Cache.Put(key, value)
+	} else {
+		e.Cache.Remove(key) // kes ne zna za istek, pa vrednost sa ttl u njega ne ide
+	}
+	e.applied++
+	e.visibleSeq = seq
+	e.mu.Unlock()
+	e.writeMu.Unlock()
 
-	// 3. Upis u Cache
-	e.Cache.Put(key, value)
+	atomic.AddInt64(&e.PutCount, 1)
+	return e.waitWAL(pos, opts)
+}
 
-	e.PutCount++
+// nextSeq dodeljuje sledeci globalni redni broj upisa
+// redni broj odredjuje koja verzija kljuca je novija (u Memtable, SSTable i kompakciji), a ne sat
+func (e *Engine) nextSeq() uint64 {
+	return atomic.AddUint64(&e.lastSeq, 1)
+}
+
+// waitWAL ceka fsync WAL zapisa na poziciji pos (prema wal_sync_mode), poziva se posle pustanja writeMu,
+// da bi pisci koji su u medjuvremenu dopisali svoje zapise delili isti fsync (vidi wal/sync.go)
+// zapis je tada vec u Memtable, pa posle neuspelog fsync-a ne prolazi vise nijedan upis, kao posle greske u pozadini
+func (e *Engine) waitWAL(pos uint64, opts []WriteOptions) error {
+	if err := e.WalWriter.WaitSynced(pos, forceSync(opts)); err != nil {
+		err = fmt.Errorf("greska pri fsync-u WAL-a: %v", err)
+		e.setBackgroundError(err)
+		return err
+	}
 	return nil
 }
 
+func forceSync(opts []WriteOptions) bool {
+	for _, o := range opts {
+		if o.Sync {
+			return true
+		}
+	}
+	return false
+}
+
 // Get pokusava da pronadje kljuc - prvo u Memtable, pa u SSTable
-func (e *Engine) Get(key string) ([]byte, bool) {
+// sa snapshot-om u opts vraca vrednost kakva je bila kada je snapshot napravljen
+func (e *Engine) Get(key string, opts ...ReadOptions) ([]byte, bool) {
 	if !e.RateLimiter.Allow() {
 		fmt.Println("previse zahteva!")
 		return nil, false
@@ -324,307 +373,273 @@ func (e *Engine) Get(key string) ([]byte, bool) {
 
 	fmt.Printf(" GET kljuc: %s\n", key)
 
+	if snap := snapshotOf(opts); snap != nil {
+		return e.getAt(key, snap.seq)
+	}
+
 	val, found := e.Cache.Get(key)
 	if found {
 		fmt.Println("Kes pogodak za:", key)
 		return val, true
 	}
 
-	// trazenje kroz sve memtable
-	for _, mt := range e.Memtables {
-		value, found := mt.Get(key)
+	memtables, applied := e.readView()
+	dels := e.rangeTombstones(memtables)
+
+	// trazenje kroz sve memtable, od najnovije ka najstarijoj
+	for _, mt := range memtables {
+		entry, found := mt.GetVersion(key, math.MaxUint64)
 		if found {
-			if value == nil {
-				//tombstone
+			if entry.Tombstone || entry.Expired(time.Now().UnixNano()) || rangeDeleted(dels, entry) {
+				//tombstone, istekao ili obrisan opsegom
 				return nil, false
 			}
 			// nasli smo ga
-			e.Cache.Put(key, value)
-			e.GetCount++
-			return value, true
+			e.fillCache(entry, applied)
+			atomic.AddInt64(&e.GetCount, 1)
+			return entry.Value, true
 		}
 	}
 
-	value, found := sstable.FastGetFromSSTablesWithBlocks(e.DataPath, key, e.BlockManager) // ➔ nova funkcija
-	if found {
-		e.GetCount++
-		e.Cache.Put(key, value)
+	entry, found := sstable.FastGetEntryFromSSTables(e.Manifest, key, e.BlockManager)
+	if !found || entry.Tombstone || entry.Expired(time.Now().UnixNano()) || rangeDeleted(dels, entry) {
+		return nil, false
+	}
+	atomic.AddInt64(&e.GetCount, 1)
+	e.fillCache(entry, applied)
+	return entry.Value, true
+}
+
+// readView vraca trenutne Memtable (od najnovije ka najstarijoj) i broj do sada primenjenih upisa
+func (e *Engine) readView() ([]memtable.MemtableInterface, uint64) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return newestFirst(e.Memtables), e.applied
+}
+
+// fillCache upisuje procitanu vrednost u kes, osim ako je u medjuvremenu bilo upisa
+// (tada je procitana vrednost mozda vec zastarela, a upis je sam azurirao kes)
+// vrednost sa ttl ne ide u kes, jer kes ne zna kada istice
+func (e *Engine) fillCache(entry sstable.Entry, applied uint64) {
+	if entry.ExpiresAt != 0 {
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.applied == applied {
+		e.Cache.Put(entry.Key, entry.Value)
 	}
-	return value, found
 }
 
-func (e *Engine) Delete(key string) error {
+func (e *Engine) Delete(key string, opts ...WriteOptions) error {
 	if !e.RateLimiter.Allow() {
 		return fmt.Errorf("previse zahteva")
 	}
 
-	// 4. Provera da li Memtable treba da se zameni
-	if e.Memtables[0].Size()+1 > e.memCap {
-		fmt.Println(">> Memtable pun - promovisem u read-only pravim novu (delete)!")
-
-		oldMemtable := e.Memtables[0]
-		currentSegment := e.WalWriter.GetCurrentSegmentPath()
-		oldMemtable.SetSegmentPath(currentSegment)
-
-		fmt.Printf(" Promovisem Memtable u RO — segmentPath: %s\n", currentSegment)
-
-		e.Memtables = append(e.Memtables, oldMemtable)
+	e.writeMu.Lock()
 
-		// Napravi novi RW Memtable
-		var newMemtable memtable.MemtableInterface
-		switch config.Current.MemtableType {
-		case "hashmap":
-			newMemtable = memtable.NewHashMapMemtable(e.memCap)
-		case "skiplist":
-			newMemtable = memtable.NewSkipListMemtable(16, 0.5)
-		default:
-			panic("Nepoznat tip Memtable!")
-		}
-		e.Memtables[0] = newMemtable
+	// 4. Provera da li Memtable treba da se zameni (flush ide u pozadini)
+	if err := e.makeRoomForWrite(1); err != nil {
+		e.writeMu.Unlock()
+		return err
 	}
 
 	// 1. Upis tombstone zapisa u WAL
+	seq, ts := e.nextSeq(), time.Now().UnixNano()
 	record := wal.Record{
-		Timestamp: uint64(time.Now().UnixNano()),
+		Seq:       seq,
 		Tombstone: true,
 		Key:       []byte(key),
 		Value:     nil,
+		Timestamp: ts,
 	}
 
-	err := e.WalWriter.Write(record)
+	pos, err := e.WalWriter.Append(record)
 	if err != nil {
+		e.writeMu.Unlock()
 		return fmt.Errorf("greska pri pisanju u WAL (delete): %v", err)
 	}
 
-	// 2. Upis tombstone u aktivni Memtable
-	e.Memtables[0].Delete(key)
-
-	// 3. Ukloni iz Cache
+	// 2. Upis tombstone u aktivni Memtable i 3. uklanjanje iz Cache
+	segmentPath := e.WalWriter.GetCurrentSegmentPath()
+	e.mu.Lock()
+	e.Memtables[0].AddSegmentPath(segmentPath)
+	e.Memtables[0].Delete(key, seq, ts)
 	e.Cache.Remove(key)
+	e.applied++
+	e.visibleSeq = seq
+	e.mu.Unlock()
 
-	// 5. Provera da li ima previse Memtables → Flush
-	if len(e.Memtables) > config.Current.MemtableMaxTables {
-		fmt.Println(">> Previse memtable-ova, flushujem poslednju (delete)")
-
-		toFlush := e.Memtables[len(e.Memtables)-1]
+	e.writeMu.Unlock()
 
-		timestamp := time.Now().UnixNano()
-		sstableDir := filepath.Join(e.DataPath, fmt.Sprintf("sstable_L%d_%d", 0, timestamp))
-
-		err := os.MkdirAll(sstableDir, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("greška pri kreiranju SSTable foldera: %v", err)
-		}
-
-		err = toFlush.FlushToSSTable(sstableDir, e.BlockManager)
-		if err != nil {
-			return fmt.Errorf("greška pri flush-u Memtable (Delete): %v", err)
-		}
+	return e.waitWAL(pos, opts)
+}
 
-		segmentPath := toFlush.GetSegmentPath()
-		fmt.Printf(" Brisem WAL segment: %s\n", segmentPath)
+// flushOldest upisuje najstariju read-only Memtable u SSTable i odmah pokrece kompakciju
+// koristi se samo pri replay-u WAL-a, dok pozadina jos nije pokrenuta
+func (e *Engine) flushOldest() error {
+	if err := e.flushImmutable(e.Memtables[1]); err != nil {
+		return err
+	}
+	return sstable.AutoCompact(e.Manifest, e.BlockManager)
+}
 
-		if err := os.Remove(segmentPath); err != nil {
-			fmt.Printf(" Greska pri brisanju WAL segmenta %s: %v\n", segmentPath, err)
-		}
+// flushImmutable upisuje RO Memtable u SSTable i izbacuje je iz liste
+// ako je Memtable u medjuvremenu vec upisana (nije vise u listi), ne radi nista
+func (e *Engine) flushImmutable(toFlush memtable.MemtableInterface) error {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
 
-		// Smanji slice
-		//e.Memtables = e.Memtables[:len(e.Memtables)-1]
-		e.Memtables = append(e.Memtables[:1], e.Memtables[2:]...)
+	if !e.hasMemtable(toFlush) {
+		return nil
+	}
+	if err := e.flushMemtable(toFlush); err != nil {
+		return err
+	}
 
-		// Opcionalno pokreni kompakciju
-		err = sstable.AutoCompact(e.DataPath, e.BlockManager)
-		if err != nil {
-			return err
+	// Smanji listu Memtables (nova lista, citaoci mozda jos koriste staru)
+	e.mu.Lock()
+	memtables := make([]memtable.MemtableInterface, 0, len(e.Memtables)-1)
+	for _, mt := range e.Memtables {
+		if mt != toFlush {
+			memtables = append(memtables, mt)
 		}
 	}
-
+	e.Memtables = memtables
+	e.roomCond.Broadcast()
+	e.mu.Unlock()
 	return nil
 }
 
-func (e *Engine) GetMemtable() memtable.MemtableInterface {
-	return e.Memtables[0]
-}
-
-func (e *Engine) FlushAllMemtables() {
-	fmt.Println(" Izvrsavam Flush svih Memtable-ova pri EXIT...")
-
-	// preskacemo RW memtable jer nije read-only jos
-	for i := 1; i < len(e.Memtables); i++ {
-		toFlush := e.Memtables[i]
-		segmentPath := toFlush.GetSegmentPath()
-
-		// napravi sstable direktorijum
-		timestamp := time.Now().UnixNano()
-		sstablePath := filepath.Join("data", "sstables", fmt.Sprintf("sstable_L0_%d", timestamp))
-
-		// flush memtable na disk
-		fmt.Printf("Flushing RO memtable u sstable: %s\n", sstablePath)
-
-		err := toFlush.FlushToSSTable(sstablePath, e.BlockManager)
-		if err != nil {
-			fmt.Printf("greska pri flushovanju memtable: %v\n", err)
-			continue
-		}
-
-		// obrisi odgovarajuci WAL segment
-		if segmentPath != "" {
-			fmt.Printf("brisem pripadajuci WAL segment: %s\n", segmentPath)
-			err := os.Remove(segmentPath)
-			if err != nil {
-				fmt.Printf("greska pri brisanju  WAL segmenta: %v\n", err)
-			}
+func (e *Engine) hasMemtable(target memtable.MemtableInterface) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, mt := range e.Memtables {
+		if mt == target {
+			return true
 		}
 	}
-
-	// ocistimo sve osim RW memtable
-	if len(e.Memtables) > 1 {
-		e.Memtables = e.Memtables[:1]
-	}
-
+	return false
 }
 
-func (e *Engine) RangeScan(from, to string) map[string][]byte {
-	result := make(map[string][]byte)
+// flushMemtable upisuje Memtable u novu L0 tabelu, registruje je u manifestu i brise njen WAL segment
+func (e *Engine) flushMemtable(toFlush memtable.MemtableInterface) error {
+	name, seq := e.Manifest.NewTableName(0)
+	tmpDir := e.Manifest.TempTablePath(name)
+	sstableDir := e.Manifest.TablePath(name)
 
-	// 1. Prolaz kroz sve Memtables
-	for _, mt := range e.Memtables {
-		memData := mt.RangeScan(from, to)
-		for k, v := range memData {
-			result[k] = v
-		}
+	err := os.MkdirAll(tmpDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("greška pri pravljenju SSTable foldera: %v", err)
 	}
 
-	// 2. Prolaz kroz SSTables
-	files, err := os.ReadDir(e.DataPath)
+	// tabela se pravi u privremenom folderu i tek posle fsync-a dobija konacno ime
+	err = toFlush.FlushToSSTable(tmpDir, e.BlockManager)
 	if err != nil {
-		return result
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("greška pri flush-u Memtable u SSTable: %v", err)
 	}
 
-	for _, f := range files {
-		if f.IsDir() && strings.HasPrefix(f.Name(), "sstable_") {
-			metaPath := filepath.Join(e.DataPath, f.Name(), "meta")
-			count, err := sstable.LoadMeta(metaPath)
-			if err != nil {
-				continue
-			}
-
-			dataPath := filepath.Join(e.DataPath, f.Name(), "data")
-			entries, err := sstable.ReadDataFileWithBlocks(dataPath, int(count), e.BlockManager)
-			if err != nil {
-				continue
-			}
-
-			for _, entry := range entries {
-				if entry.Key >= from && entry.Key <= to && !entry.Tombstone {
-					if _, exists := result[entry.Key]; !exists {
-						result[entry.Key] = entry.Value
-					}
-				}
-			}
-		}
+	if err := sstable.InstallTable(tmpDir, sstableDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
 	}
 
-	return result
-}
-
-func (e *Engine) RangeScanPaginated(from, to string, pageNum, pageSize int) map[string]string {
-	all := e.RangeScan(from, to)
-
-	keys := make([]string, 0, len(all))
-	for k := range all {
-		keys = append(keys, k)
+	meta, err := sstable.ReadTableInfo(sstableDir, e.BlockManager)
+	if err != nil {
+		return fmt.Errorf("greška pri citanju upisanog SSTable-a: %v", err)
 	}
-	sort.Strings(keys)
+	meta.Name = name
+	meta.Level = 0
+	meta.CreatedSeq = seq
 
-	start := pageNum * pageSize
-	if start >= len(keys) {
-		return map[string]string{}
+	// tek kada je tabela u manifestu WAL segment vise nije potreban
+	// uz tabelu se pamti i poslednji redni broj upisa, jer posle brisanja WAL-a on vise nije nigde drugde zapisan
+	edit := sstable.VersionEdit{Added: []sstable.TableMeta{meta}, LastSequence: atomic.LoadUint64(&e.lastSeq)}
+	if err := e.Manifest.Apply(edit); err != nil {
+		return fmt.Errorf("greška pri upisu u manifest: %v", err)
 	}
 
-	end := start + pageSize
-	if end > len(keys) {
-		end = len(keys)
+	// segment se brise samo ako u njemu nema zapisa neke druge Memtable
+	// (moze da se desi kada se Memtable zameni usred segmenta, npr. pri replay-u sa drugacijim memtable_max_entries)
+	inUse := make(map[string]bool)
+	memtables, _ := e.readView()
+	for _, mt := range memtables {
+		if mt == toFlush {
+			continue
+		}
+		for _, path := range mt.SegmentPaths() {
+			inUse[path] = true
+		}
 	}
-
-	paged := make(map[string]string)
-	for _, k := range keys[start:end] {
-		paged[k] = string(all[k])
+	for _, segmentPath := range toFlush.SegmentPaths() {
+		if inUse[segmentPath] {
+			continue
+		}
+		fmt.Printf(" Brisem WAL segment: %s\n", segmentPath)
+		if err := os.Remove(segmentPath); err != nil {
+			fmt.Printf(" Greska pri brisanju WAL segmenta %s: %v\n", segmentPath, err)
+		}
 	}
+	return nil
+}
 
-	return paged
+func (e *Engine) GetMemtable() memtable.MemtableInterface {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.Memtables[0]
 }
 
-func (e *Engine) PrefixScanAll(prefix string) map[string][]byte {
-	result := make(map[string][]byte)
+func (e *Engine) FlushAllMemtables() {
+	fmt.Println(" Izvrsavam Flush svih Memtable-ova pri EXIT...")
 
-	// 1. Prolaz kroz sve Memtables
-	for _, mt := range e.Memtables {
-		memData := mt.RangeScan(prefix, prefix+"~")
-		for k, v := range memData {
-			if strings.HasPrefix(k, prefix) {
-				result[k] = v
-			}
-		}
-	}
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
 
-	// 2. Prolaz kroz SSTables
-	files, err := os.ReadDir(e.DataPath)
-	if err != nil {
-		return result
+	// preskacemo RW memtable jer nije read-only jos
+	// (ako ih flusher u pozadini vec upisuje, flushImmutable ih preskace)
+	e.mu.RLock()
+	readOnly := append([]memtable.MemtableInterface(nil), e.Memtables[1:]...)
+	e.mu.RUnlock()
+	for _, mt := range readOnly {
+		fmt.Println("Flushing RO memtable u sstable")
+
+		err := e.flushImmutable(mt)
+		if err != nil {
+			fmt.Printf("greska pri flushovanju memtable: %v\n", err)
+			continue
+		}
 	}
+}
 
-	for _, f := range files {
-		if f.IsDir() && strings.HasPrefix(f.Name(), "sstable_") {
-			metaPath := filepath.Join(e.DataPath, f.Name(), "meta")
-			count, err := sstable.LoadMeta(metaPath)
-			if err != nil {
-				continue
-			}
-
-			dataPath := filepath.Join(e.DataPath, f.Name(), "data")
-			entries, err := sstable.ReadDataFileWithBlocks(dataPath, int(count), e.BlockManager)
-			if err != nil {
-				continue
-			}
+func (e *Engine) RangeScan(from, to string, opts ...ReadOptions) map[string][]byte {
+	result := make(map[string][]byte)
 
-			for _, entry := range entries {
-				if strings.HasPrefix(entry.Key, prefix) && !entry.Tombstone {
-					if _, exists := result[entry.Key]; !exists {
-						result[entry.Key] = entry.Value
-					}
-				}
-			}
-		}
+	// iterator spaja Memtable-ove i SSTable-ove i vraca samo najnoviju zivu verziju svakog kljuca
+	it := e.NewRangeIterator(from, to, opts...)
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		result[it.Key()] = it.Value()
+	}
+	if err := it.Err(); err != nil {
+		fmt.Printf("greska pri skeniranju: %v\n", err)
 	}
 
 	return result
 }
 
-func (e *Engine) PrefixScanPagination(prefix string, pageNum, pageSize int) map[string]string {
-	all := e.PrefixScanAll(prefix)
-
-	keys := make([]string, 0, len(all))
-	for k := range all {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	start := pageNum * pageSize
-	if start >= len(keys) {
-		return map[string]string{}
-	}
+func (e *Engine) PrefixScanAll(prefix string, opts ...ReadOptions) map[string][]byte {
+	result := make(map[string][]byte)
 
-	end := start + pageSize
-	if end > len(keys) {
-		end = len(keys)
+	it := e.NewPrefixIterator(prefix, opts...)
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		result[it.Key()] = it.Value()
 	}
-
-	paged := make(map[string]string)
-	for _, k := range keys[start:end] {
-		paged[k] = string(all[k])
+	if err := it.Err(); err != nil {
+		fmt.Printf("greska pri skeniranju: %v\n", err)
 	}
 
-	return paged
+	return result
 }
 
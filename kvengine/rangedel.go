@@ -0,0 +1,92 @@
+package kvengine
+
+import (
+	"fmt"
+	"math"
+	"napredni/memtable"
+	"napredni/sstable"
+	"napredni/wal"
+	"time"
+)
+
+// Brisanje opsega kljuceva
+// Umesto tombstone-a za svaki kljuc upisuje se jedan zapis (sstable.RangeTombstone) koji sakriva sve starije verzije
+// kljuceva iz opsega, bez obzira da li su u Memtable-ovima ili tabelama; kljucevi upisani posle njega se vide normalno
+// Kompakcija izbacuje pokrivene verzije, a zapis kada vise nema sta da sakrije (vidi sstable/rangedel.go)
+
+// DeleteRange brise sve kljuceve iz opsega [from, to]
+func (e *Engine) DeleteRange(from, to string, opts ...WriteOptions) error {
+	if from > to {
+		return fmt.Errorf("pocetak opsega %q je posle kraja %q", from, to)
+	}
+	return e.deleteRange(from, to+"\x00", opts)
+}
+
+// DeletePrefix brise sve kljuceve koji pocinju na dati prefix
+func (e *Engine) DeletePrefix(prefix string, opts ...WriteOptions) error {
+	return e.deleteRange(prefix, prefixEnd(prefix), opts)
+}
+
+// deleteRange upisuje brisanje opsega [start, end), end "" - bez gornje granice
+func (e *Engine) deleteRange(start, end string, opts []WriteOptions) error {
+	if !e.RateLimiter.Allow() {
+		return fmt.Errorf("previse zahteva!")
+	}
+
+	e.writeMu.Lock()
+
+	if err := e.makeRoomForWrite(1); err != nil {
+		e.writeMu.Unlock()
+		return err
+	}
+
+	// 1. Upis u WAL, kraj opsega ide kao vrednost
+	seq, ts := e.nextSeq(), time.Now().UnixNano()
+	record := wal.Record{
+		Seq:         seq,
+		RangeDelete: true,
+		Key:         []byte(start),
+		Value:       []byte(end),
+		Timestamp:   ts,
+	}
+	pos, err := e.WalWriter.Append(record)
+	if err != nil {
+		e.writeMu.Unlock()
+		return fmt.Errorf("greska pri pisanju u WAL (delete range): %v", err)
+	}
+
+	// 2. Upis u RW Memtable i 3. izbacivanje kljuceva iz opsega iz Cache
+	del := sstable.RangeTombstone{Start: start, End: end, Seq: seq, Timestamp: ts}
+	segmentPath := e.WalWriter.GetCurrentSegmentPath()
+	e.mu.Lock()
+	e.Memtables[0].AddSegmentPath(segmentPath)
+	e.Memtables[0].DeleteRange(start, end, seq, ts)
+	for key := range e.Cache.Items() {
+		if del.Contains(key) {
+			e.Cache.Remove(key)
+		}
+	}
+	e.applied++
+	e.visibleSeq = seq
+	e.mu.Unlock()
+	e.writeMu.Unlock()
+
+	return e.waitWAL(pos, opts)
+}
+
+// rangeTombstones vraca brisanja opsega iz datih Memtable-ova i svih tabela
+// citaju se pre verzija kljuca: kompakcija izbacuje brisanje zajedno sa verzijama koje pokriva,
+// pa citalac koji je nasao pokrivenu verziju sigurno ima i brisanje
+func (e *Engine) rangeTombstones(memtables []memtable.MemtableInterface) []sstable.RangeTombstone {
+	var dels []sstable.RangeTombstone
+	for _, mt := range memtables {
+		dels = append(dels, mt.RangeTombstones()...)
+	}
+	return append(dels, e.Manifest.RangeTombstones()...)
+}
+
+// rangeDeleted kaze da li najnoviju verziju kljuca sakriva neko brisanje opsega
+func rangeDeleted(dels []sstable.RangeTombstone, entry sstable.Entry) bool {
+	_, covered := sstable.CoveringTombstone(dels, entry.Key, entry.Seq, math.MaxUint64)
+	return covered
+}
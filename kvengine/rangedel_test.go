@@ -0,0 +1,98 @@
+package kvengine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func putRange(t *testing.T, e *Engine, prefix string, n int, value string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := e.Put(fmt.Sprintf("%s%02d", prefix, i), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkRangeDeleted(t *testing.T, e *Engine) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		switch {
+		case i == 4:
+			mustGet(t, e, key, "") // upisan posle brisanja opsega
+		case i >= 3 && i <= 6:
+			mustMiss(t, e, key)
+		default:
+			mustGet(t, e, key, "1")
+		}
+	}
+	for i := 0; i < 5; i++ {
+		mustMiss(t, e, fmt.Sprintf("p%02d", i))
+	}
+	mustGet(t, e, "q", "1")
+
+	want := map[string][]byte{"k00": []byte("1"), "k01": []byte("1"), "k02": []byte("1"), "k04": []byte(""),
+		"k07": []byte("1"), "k08": []byte("1"), "k09": []byte("1")}
+	if got := e.PrefixScanAll("k"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("skeniranje posle brisanja opsega: %q", got)
+	}
+}
+
+// brisanje opsega sakriva starije verzije iz Memtable-ova i tabela, i ostaje kroz flush, kompakciju i ponovno otvaranje
+func TestDeleteRangeSurvivesFlushAndCompaction(t *testing.T) {
+	e, dir := openTestEngine(t, "", testConfig())
+	putRange(t, e, "k", 5, "1")
+	flushAll(t, e) // deo kljuceva iz opsega je vec u tabeli
+	putRange(t, e, "k", 10, "1")
+	putRange(t, e, "p", 5, "1")
+	e.Put("q", []byte("1"))
+
+	if err := e.DeleteRange("k03", "k06"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.DeletePrefix("p"); err != nil {
+		t.Fatal(err)
+	}
+	e.Put("k04", []byte(""))
+	checkRangeDeleted(t, e)
+
+	// pre flush-a, brisanja opsega se vracaju iz WAL-a
+	e = reopen(t, e, dir)
+	checkRangeDeleted(t, e)
+
+	flushAll(t, e)
+	checkRangeDeleted(t, e)
+
+	compactAll(t, e)
+	checkRangeDeleted(t, e)
+
+	e = reopen(t, e, dir)
+	checkRangeDeleted(t, e)
+}
+
+// kompakcija izbacuje verzije koje brisanje opsega pokriva
+func TestDeleteRangeDropsCoveredVersions(t *testing.T) {
+	e := newTestEngine(t)
+	putRange(t, e, "k", 10, "1")
+	flushAll(t, e)
+	e.DeleteRange("k00", "k09")
+	e.Put("k05", []byte("2"))
+	flushAll(t, e)
+	compactAll(t, e)
+
+	for _, key := range []string{"k00", "k05"} {
+		history, err := e.History(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range history {
+			if !v.Deleted && string(v.Value) == "1" {
+				t.Fatalf("%s: posle kompakcije ostala je verzija koju brisanje opsega pokriva: %+v", key, history)
+			}
+		}
+	}
+	mustGet(t, e, "k05", "2")
+	mustMiss(t, e, "k00")
+}
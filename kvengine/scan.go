@@ -0,0 +1,125 @@
+package kvengine
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Skeniranje po stranicama
+// Stranica je sortiran niz parova kljuc-vrednost i token za sledecu stranicu
+// Token je neproziran za korisnika: u njemu su poslednji vraceni kljuc i redni broj upisa (seq) u trenutku prve stranice,
+// pa sledeca stranica pocinje Seek-om iza tog kljuca, bez ponovnog prolaska kroz sve pre njega
+// Sve stranice se citaju na seq iz tokena, pa upisi izmedju dva poziva ne menjaju stranice koje slede;
+// stanje na tom seq se cuva samo dok se stranica cita, pa ako je kompakcija u medjuvremenu mozda izbacila
+// verzije koje ono vidi, vraca se ErrInvalidToken i skeniranje treba poceti ispocetka
+// Za garantovano skeniranje do kraja prosledjuje se snapshot (ReadOptions), a token napravljen sa jednim snapshot-om
+// ne moze da se koristi sa drugim
+//
+// token na disku: VERZIJA(1)|SEQ(uvarint)|POSLEDNJI_KLJUC, kodiran kao base64 (URL varijanta, bez '=')
+
+// ErrInvalidToken se vraca kada token za nastavak skeniranja nije ispravan
+var ErrInvalidToken = errors.New("neispravan token za nastavak skeniranja")
+
+const scanTokenVersion = 1
+
+// KV je jedan par kljuc-vrednost u rezultatu skeniranja
+type KV struct {
+	Key   string
+	Value []byte
+}
+
+type scanToken struct {
+	seq     uint64 // poslednji redni broj upisa kada je skeniranje pocelo
+	lastKey string // poslednji kljuc vracen na prethodnoj stranici
+}
+
+func encodeScanToken(t scanToken) string {
+	buf := []byte{scanTokenVersion}
+	buf = binary.AppendUvarint(buf, t.seq)
+	buf = append(buf, t.lastKey...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeScanToken(token string) (scanToken, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(buf) < 1 || buf[0] != scanTokenVersion {
+		return scanToken{}, ErrInvalidToken
+	}
+	seq, n := binary.Uvarint(buf[1:])
+	if n <= 0 {
+		return scanToken{}, ErrInvalidToken
+	}
+	return scanToken{seq: seq, lastKey: string(buf[1+n:])}, nil
+}
+
+// RangeScanPage vraca do pageSize kljuceva iz opsega [from, to], sortiranih, i token za sledecu stranicu
+// prazan token pocinje od prvog kljuca; vraceni token je prazan kada stranica sadrzi poslednji kljuc opsega
+func (e *Engine) RangeScanPage(from, to string, pageSize int, token string, opts ...ReadOptions) ([]KV, string, error) {
+	newIterator := func(opts ReadOptions) Iterator { return e.NewRangeIterator(from, to, opts) }
+	return e.scanPage(newIterator, pageSize, token, snapshotOf(opts))
+}
+
+// PrefixScanPage je isto sto i RangeScanPage, za kljuceve koji pocinju na dati prefix
+func (e *Engine) PrefixScanPage(prefix string, pageSize int, token string, opts ...ReadOptions) ([]KV, string, error) {
+	newIterator := func(opts ReadOptions) Iterator { return e.NewPrefixIterator(prefix, opts) }
+	return e.scanPage(newIterator, pageSize, token, snapshotOf(opts))
+}
+
+func (e *Engine) scanPage(newIterator func(ReadOptions) Iterator, pageSize int, token string, snap *Snapshot) ([]KV, string, error) {
+	if pageSize <= 0 {
+		return nil, "", fmt.Errorf("velicina stranice mora biti veca od 0")
+	}
+
+	var start scanToken
+	if token != "" {
+		t, err := decodeScanToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+		start = t
+	}
+
+	// stranica se cita na seq iz tokena; bez snapshot-a korisnika, snapshot na tom seq postoji samo dok se stranica cita
+	switch {
+	case snap != nil:
+		if token != "" && start.seq != snap.seq {
+			return nil, "", ErrInvalidToken
+		}
+	case token == "":
+		snap = e.NewSnapshot()
+		defer snap.Release()
+	default:
+		if snap = e.snapshotAt(start.seq); snap == nil {
+			return nil, "", ErrInvalidToken
+		}
+		defer snap.Release()
+	}
+	start.seq = snap.seq
+
+	it := newIterator(ReadOptions{Snapshot: snap})
+	defer it.Close()
+	if token != "" {
+		it.Seek(start.lastKey)
+		if it.Valid() && it.Key() == start.lastKey {
+			it.Next()
+		}
+	} else {
+		it.SeekToFirst()
+	}
+
+	var page []KV
+	for ; it.Valid() && len(page) < pageSize; it.Next() {
+		page = append(page, KV{Key: it.Key(), Value: it.Value()})
+	}
+	if err := it.Err(); err != nil {
+		return nil, "", fmt.Errorf("greska pri skeniranju: %v", err)
+	}
+
+	next := ""
+	if it.Valid() {
+		next = encodeScanToken(scanToken{seq: start.seq, lastKey: page[len(page)-1].Key})
+	}
+	return page, next, nil
+}
@@ -0,0 +1,159 @@
+package kvengine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func putKeys(t *testing.T, e *Engine, n int, value string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := e.Put(fmt.Sprintf("k%02d", i), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// stranice nastavljaju iza poslednjeg vracenog kljuca, pa kljuc dodat ispred njega ne pomera sledece stranice
+func TestScanPagesContinueAfterLastKey(t *testing.T) {
+	e := newTestEngine(t)
+	putKeys(t, e, 10, "v")
+	flushAll(t, e)
+
+	page, token, err := e.PrefixScanPage("k", 4, "")
+	if err != nil || len(page) != 4 || token == "" {
+		t.Fatalf("prva stranica: %v, token %q, greska %v", page, token, err)
+	}
+	e.Put("k015", []byte("v"))
+
+	var rest []KV
+	for token != "" {
+		page, token, err = e.PrefixScanPage("k", 4, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest = append(rest, page...)
+	}
+	if len(rest) != 6 {
+		t.Fatalf("ocekivano 6 kljuceva posle prve stranice, dobijeno %v", rest)
+	}
+	for i, kv := range rest {
+		if kv.Key != fmt.Sprintf("k%02d", i+4) {
+			t.Fatalf("kljuc %d posle prve stranice je %s, ocekivano k%02d", i, kv.Key, i+4)
+		}
+	}
+
+	// opseg [from, to] ukljucuje oba kraja
+	page, token, err = e.RangeScanPage("k03", "k05", 10, "")
+	if err != nil || len(page) != 3 || token != "" {
+		t.Fatalf("RangeScanPage: %v, token %q, greska %v", page, token, err)
+	}
+}
+
+func TestScanRejectsInvalidToken(t *testing.T) {
+	e := newTestEngine(t)
+	putKeys(t, e, 3, "v")
+
+	for _, token := range []string{"nije-base64!", "AA", encodeScanToken(scanToken{seq: 1})[1:]} {
+		if _, _, err := e.PrefixScanPage("k", 2, token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("token %q: ocekivana greska ErrInvalidToken, dobijeno %v", token, err)
+		}
+	}
+}
+
+// sve stranice se citaju na seq iz tokena, pa upisi izmedju stranica ne menjaju rezultat
+func TestScanPagesReadAtTokenSeq(t *testing.T) {
+	e := newTestEngine(t)
+	putKeys(t, e, 10, "stara")
+
+	page, token, err := e.PrefixScanPage("k", 4, "")
+	if err != nil || len(page) != 4 || token == "" {
+		t.Fatalf("prva stranica: %v, token %q, greska %v", page, token, err)
+	}
+
+	e.Put("k05", []byte("nova"))
+	e.Put("k055", []byte("nova"))
+	e.Delete("k07")
+
+	var rest []KV
+	for token != "" {
+		page, token, err = e.PrefixScanPage("k", 4, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest = append(rest, page...)
+	}
+	if len(rest) != 6 {
+		t.Fatalf("ocekivano 6 kljuceva posle prve stranice, dobijeno %v", rest)
+	}
+	for i, kv := range rest {
+		if kv.Key != fmt.Sprintf("k%02d", i+4) || string(kv.Value) != "stara" {
+			t.Fatalf("stranica vidi upis posle pocetka skeniranja: %s=%s", kv.Key, kv.Value)
+		}
+	}
+}
+
+// posle kompakcije koja je mozda izbacila verzije sa seq iz tokena, token vise ne vazi
+func TestScanTokenInvalidAfterCompaction(t *testing.T) {
+	e := newTestEngine(t)
+	putKeys(t, e, 10, "stara")
+	flushAll(t, e)
+
+	_, token, err := e.PrefixScanPage("k", 4, "")
+	if err != nil || token == "" {
+		t.Fatalf("prva stranica: token %q, greska %v", token, err)
+	}
+
+	putKeys(t, e, 10, "nova")
+	flushAll(t, e)
+	compactAll(t, e)
+
+	if _, _, err := e.PrefixScanPage("k", 4, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ocekivana greska ErrInvalidToken, dobijeno %v", err)
+	}
+}
+
+// sa snapshot-om skeniranje moze da se zavrsi i posle kompakcije
+func TestScanWithSnapshotSurvivesCompaction(t *testing.T) {
+	e := newTestEngine(t)
+	putKeys(t, e, 10, "stara")
+	flushAll(t, e)
+
+	snap := e.NewSnapshot()
+	defer snap.Release()
+	opts := ReadOptions{Snapshot: snap}
+	page, token, err := e.PrefixScanPage("k", 4, "", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putKeys(t, e, 10, "nova")
+	flushAll(t, e)
+	compactAll(t, e)
+
+	all := page
+	for token != "" {
+		page, token, err = e.PrefixScanPage("k", 4, token, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page...)
+	}
+	if len(all) != 10 {
+		t.Fatalf("ocekivano 10 kljuceva, dobijeno %d", len(all))
+	}
+	for _, kv := range all {
+		if string(kv.Value) != "stara" {
+			t.Fatalf("snapshot vidi kasniji upis: %s=%s", kv.Key, kv.Value)
+		}
+	}
+
+	// token iz jednog snapshot-a ne vazi sa drugim
+	_, token, _ = e.PrefixScanPage("k", 4, "", opts)
+	other := e.NewSnapshot()
+	defer other.Release()
+	if _, _, err := e.PrefixScanPage("k", 4, token, ReadOptions{Snapshot: other}); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token je prihvacen sa drugim snapshot-om: %v", err)
+	}
+}
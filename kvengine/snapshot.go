@@ -0,0 +1,103 @@
+package kvengine
+
+import (
+	"napredni/memtable"
+	"napredni/sstable"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot je pogled na bazu u trenutku pravljenja: citanja sa njim ne vide upise i brisanja koji su dosli posle
+// snapshot je samo redni broj upisa (seq); Memtable-ovi i tabele cuvaju vise verzija kljuca, a kompakcija ne izbacuje
+// verzije koje neki zivi snapshot vidi (Manifest.AcquireSnapshot), pa posle upotrebe mora da se pozove Release
+type Snapshot struct {
+	engine *Engine
+	seq    uint64
+	once   sync.Once
+}
+
+// ReadOptions su opcije jednog citanja (Get, skeniranja, iteratori)
+type ReadOptions struct {
+	Snapshot *Snapshot // nil - cita se trenutno stanje baze
+}
+
+// NewSnapshot pravi snapshot na poslednjem upisu koji je vidljiv citaocima
+func (e *Engine) NewSnapshot() *Snapshot {
+	// pod mu, da se visibleSeq ne pomeri izmedju citanja i belezenja
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	e.Manifest.AcquireSnapshot(e.visibleSeq)
+	return &Snapshot{engine: e, seq: e.visibleSeq}
+}
+
+// snapshotAt pravi snapshot na ranijem rednom broju upisa (npr. iz tokena skeniranja)
+// vraca nil ako je kompakcija mozda vec izbacila verzije koje on vidi, ili ako seq jos nije vidljiv
+func (e *Engine) snapshotAt(seq uint64) *Snapshot {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if seq > e.visibleSeq || !e.Manifest.AcquireSnapshotAt(seq) {
+		return nil
+	}
+	return &Snapshot{engine: e, seq: seq}
+}
+
+// Sequence vraca redni broj poslednjeg upisa koji snapshot vidi
+func (s *Snapshot) Sequence() uint64 {
+	return s.seq
+}
+
+// Release pusta snapshot, posle toga kompakcija moze da izbaci verzije koje je on drzao
+// snapshot posle Release vise ne sme da se koristi; visestruki poziv ne radi nista
+func (s *Snapshot) Release() {
+	s.once.Do(func() {
+		s.engine.Manifest.ReleaseSnapshot(s.seq)
+	})
+}
+
+// snapshotOf vraca snapshot iz opcija citanja, nil ako ga nema
+func snapshotOf(opts []ReadOptions) *Snapshot {
+	for _, o := range opts {
+		if o.Snapshot != nil {
+			return o.Snapshot
+		}
+	}
+	return nil
+}
+
+// getAt vraca vrednost kljuca kakva je bila posle upisa seq; istekla vrednost se ne vidi ni u starom stanju
+// kes cuva samo najnovije vrednosti, pa se ovde ne koristi
+func (e *Engine) getAt(key string, seq uint64) ([]byte, bool) {
+	entry, found := e.versionAt(key, seq)
+	if !found || entry.Tombstone || entry.Expired(time.Now().UnixNano()) {
+		return nil, false
+	}
+	atomic.AddInt64(&e.GetCount, 1)
+	return entry.Value, true
+}
+
+// versionAt vraca najnoviju verziju kljuca sa Seq <= seq, ukljucujuci brisanje
+// verzija koju sakriva brisanje opsega vraca se kao brisanje kljuca sa rednim brojem tog brisanja
+func (e *Engine) versionAt(key string, seq uint64) (sstable.Entry, bool) {
+	memtables, _ := e.readView()
+	dels := e.rangeTombstones(memtables)
+
+	entry, found := e.newestVersion(memtables, key, seq)
+	if !found {
+		return entry, false
+	}
+	if del, covered := sstable.CoveringTombstone(dels, key, entry.Seq, seq); covered {
+		return sstable.Entry{Key: key, Tombstone: true, Seq: del.Seq, Timestamp: del.Timestamp}, true
+	}
+	return entry, true
+}
+
+func (e *Engine) newestVersion(memtables []memtable.MemtableInterface, key string, seq uint64) (sstable.Entry, bool) {
+	// prva pronadjena verzija je i najnovija: Memtable-ovi od najnovije, pa tabele redom iz manifesta
+	for _, mt := range memtables {
+		if entry, found := mt.GetVersion(key, seq); found {
+			return entry, true
+		}
+	}
+	return sstable.GetFromSSTablesAt(e.Manifest, key, seq, e.BlockManager)
+}
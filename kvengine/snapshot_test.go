@@ -0,0 +1,119 @@
+package kvengine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustGetAt(t *testing.T, e *Engine, snap *Snapshot, key, want string) {
+	t.Helper()
+	value, found := e.Get(key, ReadOptions{Snapshot: snap})
+	if !found || string(value) != want {
+		t.Fatalf("Get(%q) sa snapshot-om = %q, %v; ocekivano %q", key, value, found, want)
+	}
+}
+
+// snapshot vidi stanje iz trenutka pravljenja, i kroz flush i kompakciju
+func TestSnapshotSurvivesFlushAndCompaction(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("a", []byte("1"))
+	e.Put("b", []byte("1"))
+	flushAll(t, e)
+
+	snap := e.NewSnapshot()
+	e.Put("a", []byte("2"))
+	e.Delete("b")
+	e.Put("c", []byte("1"))
+
+	check := func() {
+		t.Helper()
+		mustGetAt(t, e, snap, "a", "1")
+		mustGetAt(t, e, snap, "b", "1")
+		if _, found := e.Get("c", ReadOptions{Snapshot: snap}); found {
+			t.Fatal("snapshot vidi kljuc upisan posle njega")
+		}
+		want := map[string][]byte{"a": []byte("1"), "b": []byte("1")}
+		if got := e.RangeScan("a", "z", ReadOptions{Snapshot: snap}); !reflect.DeepEqual(got, want) {
+			t.Fatalf("skeniranje sa snapshot-om: %v", got)
+		}
+		mustGet(t, e, "a", "2")
+		mustMiss(t, e, "b")
+	}
+	check()
+
+	flushAll(t, e)
+	compactAll(t, e)
+	check()
+
+	// posle Release kompakcija izbacuje verzije koje je snapshot drzao
+	snap.Release()
+	e.Put("d", []byte("1"))
+	flushAll(t, e)
+	compactAll(t, e)
+	history, err := e.History("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || string(history[0].Value) != "2" {
+		t.Fatalf("posle Release ostale su stare verzije: %+v", history)
+	}
+}
+
+// iterator sa snapshot-om ne vidi kasnije upise
+func TestSnapshotIterator(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("k1", []byte("1"))
+	e.Put("k2", []byte("1"))
+	snap := e.NewSnapshot()
+	defer snap.Release()
+	e.Put("k3", []byte("1"))
+	e.Delete("k1")
+
+	it := e.NewIterator(ReadOptions{Snapshot: snap})
+	defer it.Close()
+	var keys []string
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	if !reflect.DeepEqual(keys, []string{"k1", "k2"}) {
+		t.Fatalf("iterator sa snapshot-om: %v", keys)
+	}
+}
+
+// iterator bez snapshot-a drzi svoj snapshot dok se ne zatvori, pa kompakcija ne izbacuje verzije koje on vidi
+func TestIteratorHoldsSnapshotUntilClose(t *testing.T) {
+	e := newTestEngine(t)
+	putKeys(t, e, 10, "stara")
+	flushAll(t, e)
+
+	it := e.NewIterator()
+	putKeys(t, e, 10, "nova")
+	flushAll(t, e)
+	compactAll(t, e)
+
+	var count int
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if string(it.Value()) != "stara" {
+			t.Fatalf("iterator vidi upis posle pravljenja: %s=%s", it.Key(), it.Value())
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 {
+		t.Fatalf("iterator je video %d kljuceva, ocekivano 10", count)
+	}
+	if versions := mustHistory(t, e, "k00"); len(versions) != 2 {
+		t.Fatalf("dok je iterator otvoren kompakcija je ostavila %d verzija, ocekivano 2", len(versions))
+	}
+
+	// posle Close snapshot iteratora je pusten
+	it.Close()
+	e.Put("z", []byte("1"))
+	flushAll(t, e)
+	compactAll(t, e)
+	if versions := mustHistory(t, e, "k00"); len(versions) != 1 {
+		t.Fatalf("posle Close ostalo je %d verzija, ocekivano 1", len(versions))
+	}
+}
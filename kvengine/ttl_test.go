@@ -0,0 +1,68 @@
+package kvengine
+
+import (
+	"testing"
+	"time"
+)
+
+const testTTL = 50 * time.Millisecond
+
+func TestTTLExpiresInReads(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.PutWithTTL("t", []byte("privremena"), testTTL); err != nil {
+		t.Fatal(err)
+	}
+	e.Put("trajan", []byte("1"))
+	mustGet(t, e, "t", "privremena")
+
+	time.Sleep(2 * testTTL)
+	mustMiss(t, e, "t")
+	mustGet(t, e, "trajan", "1")
+	if got := e.PrefixScanAll("t"); len(got) != 1 {
+		t.Fatalf("skeniranje vidi istekao kljuc: %v", got)
+	}
+	if _, _, found := e.GetWithVersion("t"); found {
+		t.Fatal("GetWithVersion vidi istekao kljuc")
+	}
+	if err := e.PutIfAbsent("t", []byte("nova")); err != nil {
+		t.Fatalf("istekao kljuc se racuna kao da postoji: %v", err)
+	}
+	mustGet(t, e, "t", "nova")
+}
+
+// istek vazi i za vrednost koja je vec u SSTable-u, a obican Put uklanja ttl
+func TestTTLExpiresInSSTable(t *testing.T) {
+	e := newTestEngine(t)
+	e.PutWithTTL("t", []byte("privremena"), testTTL)
+	e.PutWithTTL("u", []byte("privremena"), testTTL)
+	e.Put("u", []byte("trajna"))
+	flushAll(t, e)
+	mustGet(t, e, "t", "privremena")
+
+	time.Sleep(2 * testTTL)
+	mustMiss(t, e, "t")
+	mustGet(t, e, "u", "trajna")
+}
+
+// kompakcija izbacuje istekle vrednosti, i ne vraca stariju verziju ispod njih
+func TestTTLDroppedByCompaction(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("t", []byte("stara"))
+	flushAll(t, e)
+	e.PutWithTTL("t", []byte("privremena"), testTTL)
+	flushAll(t, e)
+
+	time.Sleep(2 * testTTL)
+	compactAll(t, e)
+	mustMiss(t, e, "t")
+
+	history, err := e.History("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range history {
+		if !v.Deleted {
+			t.Fatalf("posle kompakcije ostala je verzija sa vrednoscu: %+v", history)
+		}
+	}
+}
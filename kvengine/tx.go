@@ -0,0 +1,136 @@
+package kvengine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Optimisticke transakcije
+// Transakcija cita iz snapshot-a napravljenog na pocetku, a upise cuva kod sebe do Commit-a
+// Za svaki procitan kljuc pamti redni broj (seq) verzije koju je videla; Commit pod writeMu proverava da kljuc
+// od tada nije menjan i tek onda upisuje sve kao jednu grupu (WriteBatch), pa nema zakljucavanja dok transakcija traje
+// Proveravaju se samo procitani kljucevi: dve transakcije koje samo upisuju isti kljuc ne smetaju jedna drugoj
+
+// ErrConflict se vraca iz Commit kada je neki kljuc koji je transakcija procitala u medjuvremenu promenjen
+var ErrConflict = errors.New("konflikt: procitani kljuc je promenjen posle pocetka transakcije")
+
+// ErrTxDone se vraca kada se transakcija koristi posle Commit ili Rollback
+var ErrTxDone = errors.New("transakcija je vec zavrsena")
+
+// Tx je jedna optimisticka transakcija, nije bezbedna za istovremeno koriscenje iz vise gorutina
+type Tx struct {
+	engine  *Engine
+	snap    *Snapshot
+	reads   map[string]uint64 // procitani kljucevi i seq verzije koja je procitana, 0 - kljuc nije postojao
+	batch   WriteBatch
+	pending map[string]int // poslednja operacija u batch-u za kljuc
+	done    bool
+}
+
+// BeginTx pocinje transakciju nad trenutnim stanjem baze
+func (e *Engine) BeginTx() *Tx {
+	return &Tx{
+		engine:  e,
+		snap:    e.NewSnapshot(),
+		reads:   make(map[string]uint64),
+		pending: make(map[string]int),
+	}
+}
+
+// Get vraca vrednost kljuca: sopstveni upis transakcije ako postoji, inace vrednost iz snapshot-a
+func (tx *Tx) Get(key string) ([]byte, bool, error) {
+	if tx.done {
+		return nil, false, ErrTxDone
+	}
+	if i, ok := tx.pending[key]; ok {
+		op := tx.batch.ops[i]
+		return op.value, !op.delete, nil
+	}
+	if !tx.engine.RateLimiter.Allow() {
+		return nil, false, fmt.Errorf("previse zahteva!")
+	}
+
+	entry, found := tx.engine.versionAt(key, tx.snap.seq)
+	if _, seen := tx.reads[key]; !seen {
+		tx.reads[key] = 0
+		if found {
+			tx.reads[key] = entry.Seq
+		}
+	}
+	if !found || entry.Tombstone || entry.Expired(time.Now().UnixNano()) {
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// Put pamti upis, u bazu ide tek sa Commit
+func (tx *Tx) Put(key string, value []byte) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.pending[key] = tx.batch.Len()
+	tx.batch.Put(key, value)
+	return nil
+}
+
+// Delete pamti brisanje, u bazu ide tek sa Commit
+func (tx *Tx) Delete(key string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.pending[key] = tx.batch.Len()
+	tx.batch.Delete(key)
+	return nil
+}
+
+// Commit upisuje sve izmene transakcije atomicno, ili vraca ErrConflict ako je neki procitani kljuc promenjen
+// transakcija je posle Commit zavrsena u oba slucaja; posle konflikta se ponavlja sa novim BeginTx
+func (tx *Tx) Commit(opts ...WriteOptions) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+
+	e := tx.engine
+	if !e.RateLimiter.Allow() {
+		return fmt.Errorf("previse zahteva!")
+	}
+
+	// provera i upis pod istim writeMu, da se izmedju njih ne provuce tudji upis
+	e.writeMu.Lock()
+	pos, err := tx.commitLocked()
+	e.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return e.waitWAL(pos, opts)
+}
+
+// commitLocked proverava konflikte i upisuje izmene, poziva se pod writeMu
+func (tx *Tx) commitLocked() (uint64, error) {
+	e := tx.engine
+	for key, seq := range tx.reads {
+		// najnovija verzija, ukljucujuci brisanje; ako je nema, kompakcija je izbacila brisanje koje je i procitano
+		if current, found := e.versionAt(key, math.MaxUint64); found && current.Seq != seq {
+			return 0, ErrConflict
+		}
+	}
+	if tx.batch.Len() == 0 {
+		return 0, nil
+	}
+	return e.writeLocked(tx.batch.ops)
+}
+
+// Rollback odbacuje izmene transakcije; poziv posle Commit ne radi nista
+func (tx *Tx) Rollback() {
+	if !tx.done {
+		tx.finish()
+	}
+}
+
+func (tx *Tx) finish() {
+	tx.done = true
+	tx.snap.Release()
+}
@@ -0,0 +1,124 @@
+package kvengine
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestTxConflictOnReadKey(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("a", []byte("1"))
+
+	tx := e.BeginTx()
+	if value, found, err := tx.Get("a"); err != nil || !found || string(value) != "1" {
+		t.Fatalf("tx.Get = %q, %v, %v", value, found, err)
+	}
+	e.Put("a", []byte("2"))
+	tx.Put("b", []byte("iz transakcije"))
+	if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("ocekivan ErrConflict, dobijeno %v", err)
+	}
+	mustMiss(t, e, "b")
+	mustGet(t, e, "a", "2")
+
+	if err := tx.Put("c", nil); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("transakcija posle Commit: %v", err)
+	}
+}
+
+// kljuc koji nije postojao pri citanju, a drugi ga je u medjuvremenu upisao, je takodje konflikt
+func TestTxConflictOnCreatedKey(t *testing.T) {
+	e := newTestEngine(t)
+	tx := e.BeginTx()
+	if _, found, _ := tx.Get("novi"); found {
+		t.Fatal("kljuc ne postoji")
+	}
+	e.Put("novi", []byte("1"))
+	tx.Put("novi", []byte("2"))
+	if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("ocekivan ErrConflict, dobijeno %v", err)
+	}
+	mustGet(t, e, "novi", "1")
+}
+
+// upisi bez citanja se ne proveravaju, a transakcija vidi svoje upise
+func TestTxBlindWritesAndOwnReads(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("a", []byte("1"))
+
+	tx := e.BeginTx()
+	tx.Put("a", []byte("tx"))
+	tx.Delete("b")
+	if value, found, _ := tx.Get("a"); !found || string(value) != "tx" {
+		t.Fatalf("transakcija ne vidi svoj upis: %q, %v", value, found)
+	}
+	if _, found, _ := tx.Get("b"); found {
+		t.Fatal("transakcija ne vidi svoje brisanje")
+	}
+	e.Put("a", []byte("drugi"))
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, e, "a", "tx")
+
+	rolledBack := e.BeginTx()
+	rolledBack.Put("a", []byte("rollback"))
+	rolledBack.Rollback()
+	mustGet(t, e, "a", "tx")
+}
+
+// procitana verzija se proverava i kada je u medjuvremenu prosla kroz flush i kompakciju
+func TestTxNoConflictAfterCompaction(t *testing.T) {
+	e := newTestEngine(t)
+	e.Put("a", []byte("1"))
+	flushAll(t, e)
+
+	tx := e.BeginTx()
+	tx.Get("a")
+	e.Put("z", []byte("1"))
+	flushAll(t, e)
+	compactAll(t, e)
+
+	tx.Put("a", []byte("2"))
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("neocekivan konflikt: %v", err)
+	}
+	mustGet(t, e, "a", "2")
+}
+
+// brojac koji vise gorutina uvecava transakcijama (uz ponavljanje posle konflikta) ne gubi nijedno uvecanje
+func TestTxConcurrentIncrements(t *testing.T) {
+	e := newTestEngine(t)
+	const workers, increments = 4, 25
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; {
+				tx := e.BeginTx()
+				value, _, err := tx.Get("brojac")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n, _ := strconv.Atoi(string(value))
+				tx.Put("brojac", []byte(strconv.Itoa(n+1)))
+				err = tx.Commit()
+				if errors.Is(err, ErrConflict) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+	mustGet(t, e, "brojac", strconv.Itoa(workers*increments))
+}
@@ -3,6 +3,7 @@ package memtable
 import (
 	"encoding/gob"
 	"fmt"
+	"napredni/sstable"
 	"os"
 )
 
@@ -22,14 +23,26 @@ func (m *HashMapMemtable) SaveSnapshot(path string) error {
 
 	encoder := gob.NewEncoder(file)
 
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	// Napravis slice svih unosa iz mape koje zelimo da sacuvamo
 	var entries []SnapshotEntry
-	for k, v := range m.data {
-		entries = append(entries, SnapshotEntry{
-			Key:       k,
-			Value:     v.Value,
-			Tombstone: v.Tombstone,
-		})
+	for k, versions := range m.data {
+		for _, v := range versions {
+			entries = append(entries, SnapshotEntry{
+				Key:       k,
+				Value:     v.Value,
+				Tombstone: v.Tombstone,
+				Seq:       v.Seq,
+				Timestamp: v.Timestamp,
+				ExpiresAt: v.ExpiresAt,
+			})
+		}
+	}
+	// brisanja opsega idu kao posebni zapisi
+	for _, t := range m.rangeDels {
+		entries = append(entries, SnapshotEntry{Key: t.Start, RangeEnd: t.End, RangeDelete: true, Seq: t.Seq, Timestamp: t.Timestamp})
 	}
 
 	// Snimi slice u fajl
@@ -55,12 +68,24 @@ func (m *HashMapMemtable) LoadSnapshot(path string) error {
 	}
 
 	// ocistimo trenutnu mapu i napunimo iz fajla
-	m.data = make(map[string]Entry)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = make(map[string][]Entry)
+	m.rangeDels = nil
+	m.count = 0
 	for _, e := range entries {
-		m.data[e.Key] = Entry{
+		if e.RangeDelete {
+			m.rangeDels = append(m.rangeDels, sstable.RangeTombstone{Start: e.Key, End: e.RangeEnd, Seq: e.Seq, Timestamp: e.Timestamp})
+			m.count++
+			continue
+		}
+		m.insert(e.Key, Entry{
 			Value:     e.Value,
 			Tombstone: e.Tombstone,
-		}
+			Seq:       e.Seq,
+			Timestamp: e.Timestamp,
+			ExpiresAt: e.ExpiresAt,
+		})
 	}
 	return nil
 
@@ -1,22 +1,49 @@
 package memtable
 
-import "napredni/blockmanager"
+import (
+	"napredni/blockmanager"
+	"napredni/sstable"
+)
 
 // MemtableInterface opisuje ponasanje od bilo koje Memtable strukture
 // To je isto ponasanje kao u C++ znaci imamo .h i .cpp fajlove, u .h se upisuju samo potpisi funkcija, 
 // a u .cpp se implementira telo funkcije tako je i sa ovim interface-om
 // ovo napravljeno jer podrzavamo dve razlicite implementacije memtable strukture
 type MemtableInterface interface {
-	Put(key string, value []byte)                                    // ubacivanje vrednosti
+	Put(key string, value []byte, seq uint64, ts, expiresAt int64)   // ubacivanje vrednosti, seq je redni broj upisa, ts vreme upisa, expiresAt vreme isteka (0 - ne istice)
 	Get(key string) ([]byte, bool)                                   // dobavljanje vrednosti
-	Delete(key string)                                               // logicko brisanje
+	GetVersion(key string, seq uint64) (sstable.Entry, bool)         // najnovija verzija kljuca sa seq <= datog (za snapshot)
+	Versions(key string) []sstable.Entry                             // sve verzije kljuca, od najnovije
+	Delete(key string, seq uint64, ts int64)                         // logicko brisanje
+	DeleteRange(start, end string, seq uint64, ts int64)             // brisanje opsega [start, end), end "" - bez gornje granice
+	RangeTombstones() []sstable.RangeTombstone                       // sva brisanja opsega u ovoj Memtable
 	FlushToSSTable(path string, bm *blockmanager.BlockManager) error // prebacivanje na disk
 	Size() int                                                       // trenutna velicina
 	RangeScan(from, to string) map[string][]byte
+	NewIterator() sstable.InternalIterator // iterator po kljucevima, sa tombstone-ima (vidi iterator.go)
 
-	GetSegmentPath() string
-	SetSegmentPath(path string)
+	SegmentPaths() []string     // WAL segmenti u kojima su zapisi ove Memtable
+	AddSegmentPath(path string) // pamti segment u koji je upisan zapis ove Memtable
 
 	SaveSnapshot(path string) error
 	LoadSnapshot(path string) error
 }
+
+// dodaje segment na kraj liste ako vec nije poslednji
+// zapisi jedne Memtable idu u WAL redom, pa je dovoljno porediti sa poslednjim segmentom
+func addSegmentPath(paths []string, path string) []string {
+	if len(paths) > 0 && paths[len(paths)-1] == path {
+		return paths
+	}
+	return append(paths, path)
+}
+
+// dodaje brisanje opsega u listu; isto brisanje (isti seq) se ne dodaje dva puta, kao ni verzija kljuca
+func addRangeTombstone(dels []sstable.RangeTombstone, t sstable.RangeTombstone) ([]sstable.RangeTombstone, bool) {
+	for _, d := range dels {
+		if d.Seq == t.Seq {
+			return dels, false
+		}
+	}
+	return append(dels, t), true
+}
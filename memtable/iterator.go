@@ -0,0 +1,128 @@
+package memtable
+
+import (
+	"napredni/sstable"
+	"sort"
+)
+
+// Iteratori nad Memtable-ovima (sstable.InternalIterator), vide i tombstone-e
+// - hashmap nema redosled, pa iterator pravi sortiranu kopiju zapisa (Memtable je ogranicena kapacitetom)
+// - skip lista je vec sortirana, iterator ide po cvorovima; cvorovi se nikad ne brisu (brisanje je tombstone),
+//   pa je pokazivac na cvor uvek ispravan, a svaki korak iteratora drzi RLock liste
+// oba vracaju sve verzije kljuca, od najnovije ka najstarijoj
+
+// NewIterator vraca iterator nad kopijom trenutnog sadrzaja Memtable
+func (m *HashMapMemtable) NewIterator() sstable.InternalIterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]sstable.Entry, 0, m.count)
+	for key, versions := range m.data {
+		for _, val := range versions {
+			entries = append(entries, val.toEntry(key))
+		}
+	}
+	// kljucevi rastuce, a verzije istog kljuca od najnovije
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		return entries[i].Seq > entries[j].Seq
+	})
+	return sstable.NewSliceIterator(entries)
+}
+
+type skipListIterator struct {
+	list *SkipListMemtable
+	node *SkipListNode // nil - iterator nije na zapisu
+	cur  sstable.Entry // kopija zapisa iz cvora, cvor moze da se promeni novim upisom
+}
+
+// NewIterator vraca iterator koji ide direktno kroz skip listu
+// upisi posle pravljenja iteratora su vidljivi ako iterator jos nije prosao kroz njihov kljuc
+func (s *SkipListMemtable) NewIterator() sstable.InternalIterator {
+	return &skipListIterator{list: s}
+}
+
+// setNode pamti cvor i kopira njegov zapis, pozivalac drzi RLock liste
+func (it *skipListIterator) setNode(node *SkipListNode) {
+	it.node = node
+	if node != nil {
+		it.cur = node.entry()
+	}
+}
+
+// findLessThan vraca poslednji cvor sa kljucem < key (ili head), pozivalac drzi RLock liste
+func (s *SkipListMemtable) findLessThan(key string) *SkipListNode {
+	current := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for current.next[i] != nil && current.next[i].key < key {
+			current = current.next[i]
+		}
+	}
+	return current
+}
+
+func (it *skipListIterator) Seek(key string) {
+	it.list.mu.RLock()
+	defer it.list.mu.RUnlock()
+	it.setNode(it.list.findLessThan(key).next[0])
+}
+
+func (it *skipListIterator) SeekToFirst() {
+	it.list.mu.RLock()
+	defer it.list.mu.RUnlock()
+	it.setNode(it.list.head.next[0])
+}
+
+func (it *skipListIterator) SeekToLast() {
+	it.list.mu.RLock()
+	defer it.list.mu.RUnlock()
+
+	current := it.list.head
+	for i := it.list.level - 1; i >= 0; i-- {
+		for current.next[i] != nil {
+			current = current.next[i]
+		}
+	}
+	if current == it.list.head {
+		current = nil
+	}
+	it.setNode(current)
+}
+
+func (it *skipListIterator) Next() {
+	if it.node == nil {
+		return
+	}
+	it.list.mu.RLock()
+	defer it.list.mu.RUnlock()
+	it.setNode(it.node.next[0])
+}
+
+// Prev trazi prethodnik od vrha liste, jer cvorovi nemaju pokazivac unazad
+func (it *skipListIterator) Prev() {
+	if it.node == nil {
+		return
+	}
+	it.list.mu.RLock()
+	defer it.list.mu.RUnlock()
+
+	prev := it.list.head
+	for i := it.list.level - 1; i >= 0; i-- {
+		for prev.next[i] != nil && prev.next[i].less(it.node.key, it.node.seq) {
+			prev = prev.next[i]
+		}
+	}
+	if prev == it.list.head {
+		prev = nil
+	}
+	it.setNode(prev)
+}
+
+func (it *skipListIterator) Valid() bool          { return it.node != nil }
+func (it *skipListIterator) Key() string          { return it.cur.Key }
+func (it *skipListIterator) Value() []byte        { return it.cur.Value }
+func (it *skipListIterator) Entry() sstable.Entry { return it.cur }
+func (it *skipListIterator) Err() error           { return nil }
+func (it *skipListIterator) Close() error         { return nil }
@@ -14,26 +14,31 @@ import (
 type Entry struct {
 	Value     []byte // vrednost kao niz bajtova
 	Tombstone bool   // true ako je obriasn (logicko brisanje)
+	Seq       uint64 // redni broj upisa koji je napravio ovu verziju
+	Timestamp int64  // vreme upisa (UnixNano)
+	ExpiresAt int64  // vreme isteka (UnixNano), 0 - ne istice
 }
 
 // Glavna struktura za Memtable
 type HashMapMemtable struct {
-	data        map[string]Entry // mapa: kljuc -> Entry
-	mu          sync.RWMutex     // bezbedan rad sa vise niti
-	Cap         int              // kapacitet
-	segmentPath string
+	data         map[string][]Entry       // mapa: kljuc -> verzije kljuca, od najnovije ka najstarijoj
+	rangeDels    []sstable.RangeTombstone // brisanja opsega, vaze za kljuceve iz svih Memtable-ova i tabela
+	count        int                      // ukupan broj verzija u mapi i brisanja opsega
+	mu           sync.RWMutex             // bezbedan rad sa vise niti
+	Cap          int                      // kapacitet
+	segmentPaths []string                 // WAL segmenti sa zapisima ove Memtable
 }
 
 // Konstruktor: pravi novu praznu memtable sa zadatim kapacitetom
 func NewHashMapMemtable(capacity int) *HashMapMemtable {
 	return &HashMapMemtable{
-		data: make(map[string]Entry),
+		data: make(map[string][]Entry),
 		Cap:  capacity,
 	}
 }
 
 // Ubacuje (ili menja) zapis u Memtable
-func (m *HashMapMemtable) Put(key string, value []byte) {
+func (m *HashMapMemtable) Put(key string, value []byte, seq uint64, ts int64, expiresAt int64) {
 	m.mu.Lock() //zakljucamo mapu da bi izbegli konkurentni pristup
 	defer m.mu.Unlock()
 
@@ -43,18 +48,34 @@ func (m *HashMapMemtable) Put(key string, value []byte) {
 	}*/
 
 	if value == nil {
-		m.data[key] = Entry{Tombstone: true} // ako je value nil, postavljamo Tombstone na true (logicko brisanje)
+		m.insert(key, Entry{Tombstone: true, Seq: seq, Timestamp: ts}) // ako je value nil, postavljamo Tombstone na true (logicko brisanje)
 	} else {
-		m.data[key] = Entry{Value: value, Tombstone: false} // postavljamo vrednost, Tombstone na false
+		m.insert(key, Entry{Value: value, Tombstone: false, Seq: seq, Timestamp: ts, ExpiresAt: expiresAt}) // postavljamo vrednost, Tombstone na false
 	}
 }
 
+// insert dodaje novu verziju kljuca, starije verzije ostaju (potrebne su snapshot-ovima)
+// verzija sa istim seq se samo menja, pa ponovljeni replay WAL-a ne pravi duplikate
+func (m *HashMapMemtable) insert(key string, entry Entry) {
+	versions := m.data[key]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].Seq <= entry.Seq })
+	if i < len(versions) && versions[i].Seq == entry.Seq {
+		versions[i] = entry
+		return
+	}
+	versions = append(versions, Entry{})
+	copy(versions[i+1:], versions[i:])
+	versions[i] = entry
+	m.data[key] = versions
+	m.count++
+}
+
 // Vraca vrednost ako postoji i nije obrisana
 func (m *HashMapMemtable) Get(key string) ([]byte, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	entry, exists := m.data[key]
+	versions, exists := m.data[key]
 	/*if !exists || entry.Tombstone {
 		return nil, false
 	}
@@ -64,42 +85,103 @@ func (m *HashMapMemtable) Get(key string) ([]byte, bool) {
 	if !exists {
 		return nil, false // kljuc ne postoji
 	}
-	if entry.Tombstone {
-		return nil, true // kljuc postoji ali je logicki obrisan
+	entry := versions[0] // najnovija verzija
+	if entry.Tombstone || entry.expired(time.Now().UnixNano()) {
+		return nil, true // kljuc postoji ali je logicki obrisan ili je istekao
 	}
 	return entry.Value, true // kljuc postoji i nije obrisan, vracamo njegovu vrednost
 }
 
 // Brise zapis logicki (tombstone = true)
-func (m *HashMapMemtable) Delete(key string) {
+func (m *HashMapMemtable) Delete(key string, seq uint64, ts int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.data[key] = Entry{
+	m.insert(key, Entry{
 		Tombstone: true,
+		Seq:       seq,
+		Timestamp: ts,
+	})
+}
+
+// DeleteRange pamti brisanje opsega kljuceva [start, end)
+// verzije u mapi ostaju, brisanje ih sakriva pri citanju (vidi sstable/rangedel.go)
+func (m *HashMapMemtable) DeleteRange(start, end string, seq uint64, ts int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var added bool
+	m.rangeDels, added = addRangeTombstone(m.rangeDels, sstable.RangeTombstone{Start: start, End: end, Seq: seq, Timestamp: ts})
+	if added {
+		m.count++
 	}
 }
 
-func (m *HashMapMemtable) SetSegmentPath(path string) {
-	m.segmentPath = path
+// RangeTombstones vraca sva brisanja opsega iz Memtable
+func (m *HashMapMemtable) RangeTombstones() []sstable.RangeTombstone {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]sstable.RangeTombstone(nil), m.rangeDels...)
 }
 
-func (m *HashMapMemtable) GetSegmentPath() string {
-	return m.segmentPath
+// GetVersion vraca najnoviju verziju kljuca sa seq <= datog (i tombstone)
+func (m *HashMapMemtable) GetVersion(key string, seq uint64) (sstable.Entry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, v := range m.data[key] {
+		if v.Seq <= seq {
+			return v.toEntry(key), true
+		}
+	}
+	return sstable.Entry{}, false
 }
 
-// vraca broj zapisa u tabeli
+// Versions vraca sve verzije kljuca, od najnovije ka najstarijoj
+func (m *HashMapMemtable) Versions(key string) []sstable.Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var versions []sstable.Entry
+	for _, v := range m.data[key] {
+		versions = append(versions, v.toEntry(key))
+	}
+	return versions
+}
+
+// expired kaze da li je verzija istekla u trenutku now (vidi sstable.Entry.Expired)
+func (v Entry) expired(now int64) bool {
+	return v.ExpiresAt != 0 && v.ExpiresAt <= now
+}
+
+func (v Entry) toEntry(key string) sstable.Entry {
+	return sstable.Entry{Key: key, Value: v.Value, Tombstone: v.Tombstone, Seq: v.Seq, Timestamp: v.Timestamp, ExpiresAt: v.ExpiresAt}
+}
+
+func (m *HashMapMemtable) AddSegmentPath(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.segmentPaths = addSegmentPath(m.segmentPaths, path)
+}
+
+func (m *HashMapMemtable) SegmentPaths() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.segmentPaths...)
+}
+
+// vraca broj zapisa u tabeli (svaka verzija kljuca je poseban zapis)
 func (m *HashMapMemtable) Size() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.data)
+	return m.count
 }
 
 // obicna provera da li je popunjen kapacitet
 func (m *HashMapMemtable) IsFull() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.data) >= m.Cap
+	return m.count >= m.Cap
 }
 
 // pretvara trenutni sadrzaj Memtable u slice i zapisuje na disk
@@ -114,16 +196,13 @@ func (m *HashMapMemtable) FlushToSSTable(dirPath string, bm *blockmanager.BlockM
 
 	var entries []sstable.Entry
 
-	for key, val := range m.data {
-		entries = append(entries, sstable.Entry{
-			Key:       key,
-			Value:     val.Value,
-			Tombstone: val.Tombstone,
-			Timestamp: uint64(time.Now().UnixNano()),
-		})
+	for key, versions := range m.data {
+		for _, val := range versions {
+			entries = append(entries, val.toEntry(key))
+		}
 	}
 
-	err = sstable.WriteAllFilesWithBlocks(dirPath, entries, bm)
+	err = sstable.WriteTableWithRangeDels(dirPath, entries, m.rangeDels, bm)
 	fmt.Printf("Flush Memtable to SSTable: %s\n", dirPath)
 	for _, entry := range entries {
 		fmt.Printf("Flush: %s → %s\n", entry.Key, entry.Value)
@@ -132,6 +211,10 @@ func (m *HashMapMemtable) FlushToSSTable(dirPath string, bm *blockmanager.BlockM
 }
 
 func (h *HashMapMemtable) RangeScan(from, to string) map[string][]byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	now := time.Now().UnixNano()
 	var allKeys []string // slice stringova u koji ubacujemo kljuceve
 	for k := range h.data {
 		allKeys = append(allKeys, k)
@@ -143,8 +226,8 @@ func (h *HashMapMemtable) RangeScan(from, to string) map[string][]byte {
 	results := make(map[string][]byte)
 	for _, k := range allKeys {
 		if k >= from && k <= to {
-			entry := h.data[k]
-			if !entry.Tombstone {
+			entry := h.data[k][0]
+			if !entry.Tombstone && !entry.expired(now) {
 				results[k] = entry.Value
 			}
 		}
@@ -6,6 +6,7 @@ import (
 	"napredni/sstable"
 	"math/rand"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -14,6 +15,9 @@ type SkipListNode struct {
 	key       string          // kljuc
 	value     []byte          // vrednost u bajtima
 	tombstone bool            // da li je obrisan
+	seq       uint64          // redni broj upisa ove verzije
+	timestamp int64           // vreme upisa (UnixNano)
+	expiresAt int64           // vreme isteka (UnixNano), 0 - ne istice
 	next      []*SkipListNode // pokazivaci na sledeci cvor po svakom nivou
 }
 
@@ -25,20 +29,29 @@ Nivo 1: head -> node1 -> node3 -> node4 -> node5 -> node7
 
 // Definicija skipliste
 type SkipListMemtable struct {
-	head        *SkipListNode // pocetni dummy cvor koji nema podatke
-	level       int
-	maxLevel    int // maksimalni broj nivoa koje skip lista moze imati
-	size        int
-	prob        float64 // verovatnoca za kreiranje viseg nivoa
-	segmentPath string
+	head         *SkipListNode // pocetni dummy cvor koji nema podatke
+	level        int
+	maxLevel     int // maksimalni broj nivoa koje skip lista moze imati
+	size         int
+	prob         float64                  // verovatnoca za kreiranje viseg nivoa
+	segmentPaths []string                 // WAL segmenti sa zapisima ove Memtable
+	rangeDels    []sstable.RangeTombstone // brisanja opsega, vaze za kljuceve iz svih Memtable-ova i tabela
+
+	// upis menja pokazivace na vise nivoa, pa citanje za to vreme ne sme da ide kroz listu
+	// vise citalaca moze istovremeno (RLock), upis je sam (Lock)
+	mu sync.RWMutex
 }
 
-func (s *SkipListMemtable) SetSegmentPath(path string) {
-	s.segmentPath = path
+func (s *SkipListMemtable) AddSegmentPath(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segmentPaths = addSegmentPath(s.segmentPaths, path)
 }
 
-func (s *SkipListMemtable) GetSegmentPath() string {
-	return s.segmentPath
+func (s *SkipListMemtable) SegmentPaths() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.segmentPaths...)
 }
 
 func (s *SkipListMemtable) randomLevel() int {
@@ -114,13 +127,32 @@ head-apple-banana Pronasli!
 iduci po nivoima od najviseg ka najnizem kada nadjemo 'apple' iskljucimo ga na svim nivoima
 */
 
-func (s *SkipListMemtable) Put(key string, value []byte) {
+func (s *SkipListMemtable) Put(key string, value []byte, seq uint64, ts int64, expiresAt int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key, value, seq, ts, expiresAt)
+}
+
+func (s *SkipListMemtable) put(key string, value []byte, seq uint64, ts int64, expiresAt int64) {
+	s.insert(sstable.Entry{Key: key, Value: value, Seq: seq, Timestamp: ts, ExpiresAt: expiresAt})
+}
+
+// less kaze da li cvor ide pre verzije (key, seq) u listi
+// kljucevi su rastuce, a verzije istog kljuca od najnovije ka najstarijoj
+func (n *SkipListNode) less(key string, seq uint64) bool {
+	return n.key < key || (n.key == key && n.seq > seq)
+}
+
+// insert dodaje novu verziju kljuca kao poseban cvor, starije verzije ostaju (potrebne su snapshot-ovima)
+// cvor sa istim kljucem i seq se samo menja, pa ponovljeni replay WAL-a ne pravi duplikate
+func (s *SkipListMemtable) insert(e sstable.Entry) {
+	key, seq := e.Key, e.Seq
 	update := make([]*SkipListNode, s.maxLevel)
 	current := s.head
 
 	// Krecemo od najviseg sloja i silazimo
 	for i := s.level - 1; i >= 0; i-- {
-		for current.next[i] != nil && current.next[i].key < key {
+		for current.next[i] != nil && current.next[i].less(key, seq) {
 			current = current.next[i]
 		}
 		update[i] = current
@@ -129,9 +161,12 @@ func (s *SkipListMemtable) Put(key string, value []byte) {
 	// Sada smo na dnu (nivo 0)
 	current = current.next[0]
 
-	// Ako cvor postoji - azuriramo vrednost
-	if current != nil && current.key == key {
-		current.value = value
+	// Ako ista verzija postoji - azuriramo vrednost
+	if current != nil && current.key == key && current.seq == seq {
+		current.value = e.Value
+		current.tombstone = e.Tombstone
+		current.timestamp = e.Timestamp
+		current.expiresAt = e.ExpiresAt
 		return
 	}
 
@@ -145,9 +180,13 @@ func (s *SkipListMemtable) Put(key string, value []byte) {
 	}
 
 	newNode := &SkipListNode{
-		key:   key,
-		value: value,
-		next:  make([]*SkipListNode, newLevel),
+		key:       key,
+		value:     e.Value,
+		tombstone: e.Tombstone,
+		seq:       seq,
+		timestamp: e.Timestamp,
+		expiresAt: e.ExpiresAt,
+		next:      make([]*SkipListNode, newLevel),
 	}
 
 	// Povezemo novi cvor na svim nivoima
@@ -160,6 +199,9 @@ func (s *SkipListMemtable) Put(key string, value []byte) {
 }
 
 func (s *SkipListMemtable) Get(key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	current := s.head
 
 	// Krecemo od najvise nivoa i silazimo
@@ -169,7 +211,7 @@ func (s *SkipListMemtable) Get(key string) ([]byte, bool) {
 		}
 	}
 
-	// Sada smo na nivou 0 - sledeci cvor bi mogao biti bas nas
+	// Sada smo na nivou 0 - sledeci cvor bi mogao biti bas nas (najnovija verzija kljuca)
 	current = current.next[0]
 
 	/*if current != nil && current.key == key {
@@ -179,7 +221,7 @@ func (s *SkipListMemtable) Get(key string) ([]byte, bool) {
 	return nil, false*/
 
 	if current != nil && current.key == key {
-		if current.tombstone {
+		if current.tombstone || current.entry().Expired(time.Now().UnixNano()) {
 			return nil, true
 		}
 		return current.value, true
@@ -187,57 +229,85 @@ func (s *SkipListMemtable) Get(key string) ([]byte, bool) {
 	return nil, false
 }
 
-func (s *SkipListMemtable) Delete(key string) {
+func (s *SkipListMemtable) Delete(key string, seq uint64, ts int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(key, seq, ts)
+}
+
+func (s *SkipListMemtable) delete(key string, seq uint64, ts int64) {
+	s.insert(sstable.Entry{Key: key, Tombstone: true, Seq: seq, Timestamp: ts})
+}
+
+// DeleteRange pamti brisanje opsega kljuceva [start, end)
+// cvorovi ostaju u listi, brisanje ih sakriva pri citanju (vidi sstable/rangedel.go)
+func (s *SkipListMemtable) DeleteRange(start, end string, seq uint64, ts int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteRange(start, end, seq, ts)
+}
+
+func (s *SkipListMemtable) deleteRange(start, end string, seq uint64, ts int64) {
+	var added bool
+	s.rangeDels, added = addRangeTombstone(s.rangeDels, sstable.RangeTombstone{Start: start, End: end, Seq: seq, Timestamp: ts})
+	if added {
+		s.size++
+	}
+}
+
+// RangeTombstones vraca sva brisanja opsega iz Memtable
+func (s *SkipListMemtable) RangeTombstones() []sstable.RangeTombstone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]sstable.RangeTombstone(nil), s.rangeDels...)
+}
+
+// entry vraca zapis cvora kao sstable.Entry
+func (n *SkipListNode) entry() sstable.Entry {
+	return sstable.Entry{Key: n.key, Value: n.value, Tombstone: n.tombstone, Seq: n.seq, Timestamp: n.timestamp, ExpiresAt: n.expiresAt}
+}
+
+// GetVersion vraca najnoviju verziju kljuca sa seq <= datog (i tombstone)
+func (s *SkipListMemtable) GetVersion(key string, seq uint64) (sstable.Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	current := s.head
 	for i := s.level - 1; i >= 0; i-- {
-		for current.next[i] != nil && current.next[i].key < key {
+		for current.next[i] != nil && current.next[i].less(key, seq) {
 			current = current.next[i]
 		}
 	}
 
 	current = current.next[0]
 	if current != nil && current.key == key {
-		current.tombstone = true
-	} else {
-		// Ako kljuc NE postoji → dodaj novi tombstone čvor
-		level := s.randomLevel()
-		newNode := &SkipListNode{
-			key:       key,
-			value:     nil,
-			tombstone: true,
-			next:      make([]*SkipListNode, level),
-		}
-
-		update := make([]*SkipListNode, s.maxLevel)
-		current = s.head
-		for i := s.level - 1; i >= 0; i-- {
-			for current.next[i] != nil && current.next[i].key < key {
-				current = current.next[i]
-			}
-			update[i] = current
-		}
-
-		if level > s.level {
-			for i := s.level; i < level; i++ {
-				update[i] = s.head
-			}
-			s.level = level
-		}
+		return current.entry(), true
+	}
+	return sstable.Entry{}, false
+}
 
-		for i := 0; i < level; i++ {
-			newNode.next[i] = update[i].next[i]
-			update[i].next[i] = newNode
-		}
+// Versions vraca sve verzije kljuca, od najnovije ka najstarijoj
+func (s *SkipListMemtable) Versions(key string) []sstable.Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-		s.size++
+	var versions []sstable.Entry
+	for current := s.findLessThan(key).next[0]; current != nil && current.key == key; current = current.next[0] {
+		versions = append(versions, current.entry())
 	}
+	return versions
 }
 
 func (s *SkipListMemtable) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.size
 }
 
 func (s *SkipListMemtable) FlushToSSTable(dirPath string, bm *blockmanager.BlockManager) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	err := os.MkdirAll(dirPath, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("ne mogu da napravim SSTable folder: %v", err)
@@ -247,19 +317,17 @@ func (s *SkipListMemtable) FlushToSSTable(dirPath string, bm *blockmanager.Block
 	current := s.head.next[0]
 
 	for current != nil {
-		entries = append(entries, sstable.Entry{
-			Key:       current.key,
-			Value:     current.value,
-			Tombstone: current.tombstone,
-			Timestamp: uint64(time.Now().UnixNano()),
-		})
+		entries = append(entries, current.entry())
 		current = current.next[0]
 	}
 
-	return sstable.WriteAllFilesWithBlocks(dirPath, entries, bm)
+	return sstable.WriteTableWithRangeDels(dirPath, entries, s.rangeDels, bm)
 }
 
 func (s *SkipListMemtable) RangeScan(from, to string) map[string][]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	results := make(map[string][]byte)
 
 	current := s.head.next[0]
@@ -269,9 +337,15 @@ func (s *SkipListMemtable) RangeScan(from, to string) map[string][]byte {
 		current = current.next[0]
 	}
 
-	// Prikupljaj dokle god smo <= to
+	// Prikupljaj dokle god smo <= to, samo najnovija verzija svakog kljuca; istekla je kao tombstone (nil)
+	now := time.Now().UnixNano()
 	for current != nil && current.key <= to {
-		results[current.key] = current.value
+		if _, seen := results[current.key]; !seen {
+			results[current.key] = current.value
+			if current.entry().Expired(now) {
+				results[current.key] = nil
+			}
+		}
 		current = current.next[0]
 	}
 
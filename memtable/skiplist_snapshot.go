@@ -16,6 +16,9 @@ func (s *SkipListMemtable) SaveSnapshot(path string) error {
 
 	encoder := gob.NewEncoder(file)
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	// Prolazimo kroz sve čvorove skip liste (level 0 je najniži nivo – pun)
 	var entries []SnapshotEntry
 	current := s.head.next[0] // prvi čvor posle head-a
@@ -24,9 +27,16 @@ func (s *SkipListMemtable) SaveSnapshot(path string) error {
 			Key:       current.key,
 			Value:     current.value,
 			Tombstone: current.tombstone,
+			Seq:       current.seq,
+			Timestamp: current.timestamp,
+			ExpiresAt: current.expiresAt,
 		})
 		current = current.next[0]
 	}
+	// brisanja opsega idu kao posebni zapisi
+	for _, t := range s.rangeDels {
+		entries = append(entries, SnapshotEntry{Key: t.Start, RangeEnd: t.End, RangeDelete: true, Seq: t.Seq, Timestamp: t.Timestamp})
+	}
 
 	if err := encoder.Encode(entries); err != nil {
 		return fmt.Errorf("ne mogu da serijalizujem snapshot: %v", err)
@@ -51,14 +61,20 @@ func (s *SkipListMemtable) LoadSnapshot(path string) error {
 	}
 
 	// Očisti listu i ubaci sve nove
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.head = NewSkipListNode("", nil, false, s.maxLevel)
 	s.level = 1
 	s.size = 0
+	s.rangeDels = nil
 
 	for _, e := range entries {
-		s.Put(e.Key, e.Value)
-		if e.Tombstone {
-			s.Delete(e.Key)
+		if e.RangeDelete {
+			s.deleteRange(e.Key, e.RangeEnd, e.Seq, e.Timestamp)
+		} else if e.Tombstone {
+			s.delete(e.Key, e.Seq, e.Timestamp)
+		} else {
+			s.put(e.Key, e.Value, e.Seq, e.Timestamp, e.ExpiresAt)
 		}
 	}
 
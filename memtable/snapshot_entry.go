@@ -4,4 +4,11 @@ type SnapshotEntry struct {
 	Key       string
 	Value     []byte
 	Tombstone bool
+	Seq       uint64
+	Timestamp int64
+	ExpiresAt int64
+
+	// brisanje opsega [Key, RangeEnd), vidi DeleteRange
+	RangeDelete bool
+	RangeEnd    string
 }
@@ -58,6 +58,20 @@ func (tb *TokenBucket) Allow() bool {
 	return false
 }
 
+// Wait ceka dok token ne postane dostupan i onda ga uzima
+// koristi se kada zahtev ne treba odbiti nego samo odloziti (npr. usporavanje upisa dok kompakcija kasni)
+func (tb *TokenBucket) Wait() {
+	for !tb.Allow() {
+		tb.lock.Lock()
+		wait := tb.RefillRate - time.Since(tb.LastRefill)
+		tb.lock.Unlock()
+		if wait <= 0 {
+			wait = time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -0,0 +1,304 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"napredni/blockmanager"
+)
+
+// Format bloka koji koriste data, index i summary fajl
+// U jedan blok staje vise zapisa, zapisi su sortirani po kljucu
+// Blok se na disk upisuje preko BlockManager.WriteFragmented, pa ispred sadrzaja stoji zaglavlje fragmenta
+// Ako jedan zapis ne staje u ceo blok, on dobija svoj blok koji se prostire kroz vise uzastopnih blokova na disku
+//
+// | ZAPIS | ZAPIS | ... | RESTART_0(4) | ... | RESTART_n-1(4) | N(4) |
+//
+// ZAPIS - SHARED | UNSHARED | VALUELEN | KEY_SUFFIX | VALUE
+//   SHARED, UNSHARED i VALUELEN su uvarint
+//   SHARED je duzina zajednickog prefiksa sa prethodnim kljucem u bloku, KEY_SUFFIX je ostatak kljuca
+// RESTART - pozicija zapisa (u odnosu na pocetak bloka) koji ima ceo kljuc (SHARED = 0)
+//   restart tacka je na svakih blockRestartInterval zapisa, od nje moze da se krene sa dekodiranjem
+
+const blockRestartInterval = 16
+
+// EntryPos je pozicija zapisa: broj (prvog) bloka u fajlu i pozicija zapisa unutar bloka
+type EntryPos struct {
+	Block  int64
+	Offset int
+}
+
+type blockBuilder struct {
+	buf      []byte   // zapisi
+	restarts []uint32 // pozicije restart tacaka
+	counter  int      // broj zapisa od poslednje restart tacke
+	lastKey  string
+	entries  int
+}
+
+// vraca koliko bi blok zauzimao kada bi se dodao jos jedan zapis
+// (gornja granica, racuna se kao da zapis nema zajednicki prefiks i da pocinje restart tacku)
+func (b *blockBuilder) sizeWith(key string, value []byte) int {
+	entrySize := 3*binary.MaxVarintLen32 + len(key) + len(value)
+	return len(b.buf) + entrySize + 4*(len(b.restarts)+1) + 4
+}
+
+func (b *blockBuilder) add(key string, value []byte) int {
+	shared := 0
+	if b.counter < blockRestartInterval && b.entries > 0 {
+		for shared < len(key) && shared < len(b.lastKey) && key[shared] == b.lastKey[shared] {
+			shared++
+		}
+	} else {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+		b.counter = 0
+	}
+
+	offset := len(b.buf)
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(value)))
+	b.buf = append(b.buf, key[shared:]...)
+	b.buf = append(b.buf, value...)
+
+	b.lastKey = key
+	b.counter++
+	b.entries++
+	return offset
+}
+
+// finish vraca sadrzaj bloka spreman za upis
+func (b *blockBuilder) finish() []byte {
+	out := make([]byte, 0, len(b.buf)+4*len(b.restarts)+4)
+	out = append(out, b.buf...)
+	for _, r := range b.restarts {
+		out = binary.LittleEndian.AppendUint32(out, r)
+	}
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(b.restarts)))
+	return out
+}
+
+func (b *blockBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.restarts = b.restarts[:0]
+	b.counter = 0
+	b.lastKey = ""
+	b.entries = 0
+}
+
+// blockFileWriter pakuje zapise u blokove i upisuje ih preko BlockManager-a
+type blockFileWriter struct {
+	bm       *blockmanager.BlockManager
+	path     string
+	blockNum int64
+	builder  blockBuilder
+}
+
+func newBlockFileWriter(bm *blockmanager.BlockManager, path string) *blockFileWriter {
+	return &blockFileWriter{bm: bm, path: path}
+}
+
+// add dodaje zapis i vraca njegovu poziciju u fajlu
+// ako zapis ne staje u trenutni blok, blok se upisuje i zapis ide u sledeci
+// zapis koji je sam veci od bloka odmah se upisuje u svoj blok preko vise blokova na disku
+func (w *blockFileWriter) add(key string, value []byte) (EntryPos, error) {
+	capacity := w.bm.FragmentCapacity()
+	if w.builder.entries > 0 && w.builder.sizeWith(key, value) > capacity {
+		if err := w.flush(); err != nil {
+			return EntryPos{}, err
+		}
+	}
+
+	offset := w.builder.add(key, value)
+	pos := EntryPos{Block: w.blockNum, Offset: offset}
+
+	if w.builder.entries == 1 && len(w.builder.finish()) > capacity {
+		if err := w.flush(); err != nil {
+			return EntryPos{}, err
+		}
+	}
+	return pos, nil
+}
+
+func (w *blockFileWriter) flush() error {
+	blocks, err := w.bm.WriteFragmented(w.path, w.blockNum, w.builder.finish())
+	if err != nil {
+		return err
+	}
+	w.blockNum += blocks
+	w.builder.reset()
+	return nil
+}
+
+// close upisuje poslednji, nepun blok
+func (w *blockFileWriter) close() error {
+	if w.builder.entries == 0 {
+		return nil
+	}
+	return w.flush()
+}
+
+// size vraca broj bajtova upisanih do sada, zajedno sa trenutnim (jos neupisanim) blokom
+func (w *blockFileWriter) size() int64 {
+	return w.blockNum*int64(w.bm.BlockSize()) + int64(len(w.builder.buf))
+}
+
+// readBlock cita blok koji pocinje na blockNum, zajedno sa svim njegovim fragmentima
+// vraca sadrzaj bloka i broj sledeceg bloka u fajlu
+func readBlock(bm *blockmanager.BlockManager, path string, blockNum int64) ([]byte, int64, error) {
+	data, blocks, err := bm.ReadFragmented(path, blockNum)
+	if err != nil {
+		return nil, blockNum + blocks, err
+	}
+	return data, blockNum + blocks, nil
+}
+
+// prevBlockStart vraca prvi blok (mozda fragmentisanog) bloka koji se zavrsava pre bloka blockNum
+// ide unazad preko zaglavlja fragmenata dok ne naidje na FULL ili FIRST
+func prevBlockStart(bm *blockmanager.BlockManager, path string, blockNum int64) (int64, error) {
+	for b := blockNum - 1; b >= 0; b-- {
+		data, err := bm.ReadBlock(blockmanager.BlockID{Path: path, Num: b})
+		if err != nil {
+			return 0, fmt.Errorf("ne mogu da procitam blok %d iz %s: %v", b, path, err)
+		}
+		if len(data) < blockmanager.FragmentHeaderSize {
+			return 0, fmt.Errorf("blok %d u %s je premali za zaglavlje fragmenta", b, path)
+		}
+		switch data[0] {
+		case blockmanager.FragmentFull, blockmanager.FragmentFirst:
+			return b, nil
+		case blockmanager.FragmentMiddle, blockmanager.FragmentLast:
+			continue
+		default:
+			return 0, fmt.Errorf("neocekivan tip fragmenta %d u bloku %d u %s", data[0], b, path)
+		}
+	}
+	return 0, fmt.Errorf("nema pocetka bloka pre bloka %d u %s", blockNum, path)
+}
+
+type blockEntry struct {
+	key    string
+	value  []byte
+	offset int
+}
+
+// deli blok na deo sa zapisima i restart tacke
+func splitBlock(data []byte) ([]byte, []uint32, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("blok je premali")
+	}
+
+	n := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	restartsStart := len(data) - 4 - 4*n
+	if n < 0 || restartsStart < 0 {
+		return nil, nil, fmt.Errorf("neispravan broj restart tacaka: %d", n)
+	}
+	restarts := make([]uint32, n)
+	for i := range restarts {
+		restarts[i] = binary.LittleEndian.Uint32(data[restartsStart+4*i:])
+	}
+	return data[:restartsStart], restarts, nil
+}
+
+// dekodira jedan zapis na poziciji pos, prevKey je kljuc prethodnog zapisa
+func decodeEntry(entries []byte, pos int, prevKey string) (blockEntry, int, error) {
+	start := pos
+	shared, n := binary.Uvarint(entries[pos:])
+	if n <= 0 {
+		return blockEntry{}, 0, fmt.Errorf("ostecen zapis u bloku na poziciji %d", start)
+	}
+	pos += n
+	unshared, n := binary.Uvarint(entries[pos:])
+	if n <= 0 {
+		return blockEntry{}, 0, fmt.Errorf("ostecen zapis u bloku na poziciji %d", start)
+	}
+	pos += n
+	valueLen, n := binary.Uvarint(entries[pos:])
+	if n <= 0 {
+		return blockEntry{}, 0, fmt.Errorf("ostecen zapis u bloku na poziciji %d", start)
+	}
+	pos += n
+
+	if shared > uint64(len(prevKey)) || uint64(len(entries)-pos) < unshared+valueLen {
+		return blockEntry{}, 0, fmt.Errorf("ostecen zapis u bloku na poziciji %d", start)
+	}
+
+	key := prevKey[:shared] + string(entries[pos:pos+int(unshared)])
+	pos += int(unshared)
+	value := entries[pos : pos+int(valueLen)]
+	pos += int(valueLen)
+
+	return blockEntry{key: key, value: value, offset: start}, pos, nil
+}
+
+// decodeBlock vraca sve zapise iz bloka redom
+func decodeBlock(data []byte) ([]blockEntry, error) {
+	entries, _, err := splitBlock(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []blockEntry
+	prevKey := ""
+	for pos := 0; pos < len(entries); {
+		e, next, err := decodeEntry(entries, pos, prevKey)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+		prevKey = e.key
+		pos = next
+	}
+	return result, nil
+}
+
+// decodeEntryAt dekodira zapis na datoj poziciji u bloku
+// krece od najblize restart tacke pre pozicije, jer samo tamo kljuc nije skracen
+func decodeEntryAt(data []byte, offset int) (blockEntry, error) {
+	entries, restarts, err := splitBlock(data)
+	if err != nil {
+		return blockEntry{}, err
+	}
+
+	pos := 0
+	for _, r := range restarts {
+		if int(r) > offset {
+			break
+		}
+		pos = int(r)
+	}
+
+	prevKey := ""
+	for pos < len(entries) {
+		e, next, err := decodeEntry(entries, pos, prevKey)
+		if err != nil {
+			return blockEntry{}, err
+		}
+		if e.offset == offset {
+			return e, nil
+		}
+		if e.offset > offset {
+			break
+		}
+		prevKey = e.key
+		pos = next
+	}
+	return blockEntry{}, fmt.Errorf("nema zapisa na poziciji %d u bloku", offset)
+}
+
+// kodira poziciju zapisa kao vrednost u index i summary fajlu: BLOCK|OFFSET (uvarint)
+func encodeEntryPos(p EntryPos) []byte {
+	buf := binary.AppendUvarint(nil, uint64(p.Block))
+	return binary.AppendUvarint(buf, uint64(p.Offset))
+}
+
+func decodeEntryPos(data []byte) (EntryPos, error) {
+	block, n := binary.Uvarint(data)
+	if n <= 0 {
+		return EntryPos{}, fmt.Errorf("neispravna pozicija zapisa")
+	}
+	offset, m := binary.Uvarint(data[n:])
+	if m <= 0 {
+		return EntryPos{}, fmt.Errorf("neispravna pozicija zapisa")
+	}
+	return EntryPos{Block: int64(block), Offset: int(offset)}, nil
+}
@@ -0,0 +1,403 @@
+package sstable
+
+import (
+	"encoding/hex"
+	"fmt"
+	"napredni/blockmanager"
+	"napredni/bloomfilter"
+	"napredni/config"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tableBuilder pise jednu SSTable zapis po zapis, zapisi moraju da stizu sortirani po kljucu
+// data, index i summary se pisu istovremeno, blok po blok; u memoriji su samo trenutni blokovi,
+// bloom filter (velicina mu se zadaje unapred) i O(log n) hash-eva za merkle stablo
+type tableBuilder struct {
+	dir      string
+	bm       *blockmanager.BlockManager
+	data     *blockFileWriter
+	index    *blockFileWriter
+	summary  *blockFileWriter
+	bloom    *bloomfilter.BloomFilter
+	merkle   merkleBuilder
+	sampling int
+	count    int64
+	minKey   string
+	maxKey   string
+
+	rangeDels []RangeTombstone // brisanja opsega, idu u rangedel fajl
+}
+
+// newTableBuilder pravi builder za tabelu u folderu dir, expected je procena broja zapisa (za bloom filter)
+func newTableBuilder(dir string, expected int, bm *blockmanager.BlockManager) *tableBuilder {
+	if expected < 1 {
+		expected = 1
+	}
+	sampling := config.Current.SummaryKeyDistance
+	if sampling <= 0 {
+		sampling = 1
+	}
+	return &tableBuilder{
+		dir:      dir,
+		bm:       bm,
+		data:     newBlockFileWriter(bm, filepath.Join(dir, "data")),
+		index:    newBlockFileWriter(bm, filepath.Join(dir, "index")),
+		summary:  newBlockFileWriter(bm, filepath.Join(dir, "summary")),
+		bloom:    bloomfilter.NewBloomFilter(expected, 0.01),
+		sampling: sampling,
+	}
+}
+
+func (b *tableBuilder) add(entry Entry) error {
+	dataPos, err := b.data.add(entry.Key, encodeDataValue(entry))
+	if err != nil {
+		return fmt.Errorf("ne mogu da upisem data fajl: %v", err)
+	}
+	indexPos, err := b.index.add(entry.Key, encodeEntryPos(dataPos))
+	if err != nil {
+		return fmt.Errorf("ne mogu da upisem index fajl: %v", err)
+	}
+	// summary sadrzi svaki sampling-ti kljuc iz index fajla
+	if b.count%int64(b.sampling) == 0 {
+		if _, err := b.summary.add(entry.Key, encodeEntryPos(indexPos)); err != nil {
+			return fmt.Errorf("ne mogu da upisem summary fajl: %v", err)
+		}
+	}
+
+	// i tombstone kljucevi idu u filter, inace bi pretraga preskocila tabelu sa brisanjem
+	// i nasla staru vrednost u starijoj tabeli
+	b.bloom.Add(entry.Key)
+	b.merkle.add(merkleLeaf(entry))
+
+	if b.count == 0 {
+		b.minKey = entry.Key
+	}
+	b.maxKey = entry.Key
+	b.count++
+	return nil
+}
+
+// size vraca priblizan broj do sada upisanih bajtova data fajla
+func (b *tableBuilder) size() int64 {
+	return b.data.size()
+}
+
+// finish upisuje poslednje blokove i ostale fajlove tabele (meta, bloom, merkle)
+func (b *tableBuilder) finish() error {
+	for _, w := range []*blockFileWriter{b.data, b.index, b.summary} {
+		if err := w.close(); err != nil {
+			return fmt.Errorf("ne mogu da upisem %s: %v", w.path, err)
+		}
+	}
+
+	if len(b.rangeDels) > 0 {
+		if err := writeRangeDelFile(b.dir, b.rangeDels, b.bm); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(b.dir, "meta"), encodeMeta(b.count, b.minKey, b.maxKey, len(b.rangeDels)), 0644); err != nil {
+		return fmt.Errorf("ne mogu da upisem meta fajl: %v", err)
+	}
+
+	if err := b.bloom.SaveToFile(filepath.Join(b.dir, "bloom")); err != nil {
+		return fmt.Errorf("ne mogu da upisem bloom filter: %v", err)
+	}
+
+	root := b.merkle.root()
+	if err := os.WriteFile(filepath.Join(b.dir, "merkle"), []byte(hex.EncodeToString(root)), 0644); err != nil {
+		return fmt.Errorf("ne mogu da upisem merkle root: %v", err)
+	}
+	return nil
+}
+
+// merkleBuilder racuna isti koren kao GenerateMerkleRoot, ali bez pamcenja svih listova:
+// cuva samo korene punih podstabala (najvise jedan po visini), kao brojac u binarnom sistemu
+type merkleBuilder struct {
+	hashes  [][]byte
+	heights []int
+}
+
+func (mb *merkleBuilder) add(leaf []byte) {
+	mb.hashes = append(mb.hashes, leaf)
+	mb.heights = append(mb.heights, 0)
+	for n := len(mb.hashes); n >= 2 && mb.heights[n-1] == mb.heights[n-2]; n = len(mb.hashes) {
+		combined := merkleParent(mb.hashes[n-2], mb.hashes[n-1])
+		mb.hashes = append(mb.hashes[:n-2], combined)
+		mb.heights = append(mb.heights[:n-2], mb.heights[n-2]+1)
+	}
+}
+
+// root spaja preostala podstabla zdesna nalevo; cvor bez para se samo prenosi nivo vise,
+// pa je rezultat isti kao kod GenerateMerkleRoot
+func (mb *merkleBuilder) root() []byte {
+	if len(mb.hashes) == 0 {
+		return nil
+	}
+	root := mb.hashes[len(mb.hashes)-1]
+	for i := len(mb.hashes) - 2; i >= 0; i-- {
+		root = merkleParent(mb.hashes[i], root)
+	}
+	return root
+}
+
+// compactionOutput pise rezultat kompakcije u jednu ili vise novih tabela na datom nivou
+// nova tabela se zapocinje kada trenutna predje targetSize bajtova (0 - bez ogranicenja), ali samo na granici kljuca:
+// zapisi stizu sortirani i sve verzije jednog kljuca ostaju u istoj tabeli, pa su izlazne tabele disjunktne
+// tabele se instaliraju na disk, a registruje ih pozivalac (replaceTables)
+type compactionOutput struct {
+	m          *Manifest
+	bm         *blockmanager.BlockManager
+	level      int
+	targetSize int64
+	expected   int // procena broja zapisa po tabeli, za bloom filter
+
+	builder *tableBuilder
+	name    string
+	seq     uint64
+	tmpPath string
+	lastKey string // poslednji upisani kljuc u trenutnu tabelu
+	tables  []TableMeta
+
+	rangeDels []RangeTombstone // brisanja opsega koja jos nisu upisana, idu u prvu izlaznu tabelu
+}
+
+// newCompactionOutput pravi izlaz kompakcije za ulazne tabele inputs
+func newCompactionOutput(m *Manifest, level int, targetSize int64, inputs []TableMeta, bm *blockmanager.BlockManager) *compactionOutput {
+	var count int64
+	for _, t := range inputs {
+		count += t.Count
+	}
+	expected := count
+	// kada se izlaz deli na vise tabela, svaka dobija deo zapisa srazmeran velicini
+	if size := totalSize(inputs); targetSize > 0 && size > targetSize {
+		expected = count*targetSize/size + 1
+	}
+	return &compactionOutput{m: m, bm: bm, level: level, targetSize: targetSize, expected: int(expected)}
+}
+
+func (o *compactionOutput) add(entry Entry) error {
+	if o.builder != nil && o.targetSize > 0 && o.builder.size() >= o.targetSize && entry.Key != o.lastKey {
+		if err := o.finishTable(); err != nil {
+			return err
+		}
+	}
+	if o.builder == nil {
+		if err := o.startTable(); err != nil {
+			return err
+		}
+	}
+	o.lastKey = entry.Key
+	return o.builder.add(entry)
+}
+
+// startTable zapocinje novu izlaznu tabelu
+func (o *compactionOutput) startTable() error {
+	o.name, o.seq = o.m.NewTableName(o.level)
+	o.tmpPath = o.m.TempTablePath(o.name)
+	if err := os.MkdirAll(o.tmpPath, os.ModePerm); err != nil {
+		return fmt.Errorf("ne mogu da napravim novi SSTable folder: %v", err)
+	}
+	o.builder = newTableBuilder(o.tmpPath, o.expected, o.bm)
+	o.builder.rangeDels, o.rangeDels = o.rangeDels, nil
+	return nil
+}
+
+// finishTable zavrsava trenutnu tabelu i daje joj konacno ime
+func (o *compactionOutput) finishTable() error {
+	if err := o.builder.finish(); err != nil {
+		return fmt.Errorf("ne mogu da upisem novi SSTable: %v", err)
+	}
+	dirPath := o.m.TablePath(o.name)
+	if err := InstallTable(o.tmpPath, dirPath); err != nil {
+		return err
+	}
+	o.builder = nil
+
+	meta, err := ReadTableInfo(dirPath, o.bm)
+	if err != nil {
+		return err
+	}
+	meta.Name = o.name
+	meta.Level = o.level
+	meta.CreatedSeq = o.seq
+	o.tables = append(o.tables, meta)
+	return nil
+}
+
+// finish zavrsava poslednju tabelu i vraca sve napravljene tabele
+// ako su sve verzije izbacene, a ostalo je brisanje opsega, ono dobija tabelu bez zapisa
+func (o *compactionOutput) finish() ([]TableMeta, error) {
+	if o.builder == nil && len(o.rangeDels) > 0 {
+		if err := o.startTable(); err != nil {
+			return nil, err
+		}
+	}
+	if o.builder != nil {
+		if err := o.finishTable(); err != nil {
+			return nil, err
+		}
+	}
+	return o.tables, nil
+}
+
+// abort brise sve sto je kompakcija do sada napisala (tabele jos nisu u manifestu)
+func (o *compactionOutput) abort() {
+	if o.builder != nil {
+		os.RemoveAll(o.tmpPath)
+	}
+	for _, t := range o.tables {
+		fullPath := o.m.TablePath(t.Name)
+		ForgetFilter(fullPath)
+		os.RemoveAll(fullPath)
+	}
+}
+
+// mergeInto spaja ulazne tabele u izlaz kompakcije, zapis po zapis
+// starija verzija kljuca ostaje ako je potrebna zivom snapshot-u (novija verzija ima Seq veci od najstarijeg snapshot-a)
+// ili ako je cuva pravilo version_retention za taj kljuc; bez snapshot-ova i pravila ostaje samo najnovija
+// najnoviji tombstone se izbacuje kada ga ne vidi nijedan snapshot kao novu promenu, dropTombstone to dozvoli
+// i nijedna starija verzija tog kljuca ne ostaje (inace bi ona ozivela)
+// istekao zapis (TTL) se upisuje kao tombstone bez vrednosti, pa dalje ide istim putem
+// verzija koju pokriva brisanje opsega (iz bilo koje tabele) izbacuje se cim ga vide svi snapshot-ovi;
+// brisanja opsega iz ulaznih tabela prelaze u izlaz, osim kada van kompakcije nema tabele koju bi sakrivala
+// vraca broj upisanih zapisa i broj izbacenih tombstone-a
+func mergeInto(m *Manifest, inputs []TableMeta, out *compactionOutput, dropTombstone func(key string) bool, bm *blockmanager.BlockManager) (int, int, error) {
+	// snapshot napravljen posle ovoga vidi najnovije verzije, a one uvek ostaju
+	oldest := m.oldestSnapshot()
+	now := time.Now().UnixNano()
+
+	dels := m.RangeTombstones()
+	kept, droppedRanges := keptRangeTombstones(m, inputs, oldest)
+	out.rangeDels = kept
+
+	it := mergeTables(m, inputs, bm)
+	written, dropped := 0, 0
+	first := true
+	var lastKey string
+	var rank int       // redni broj verzije kljuca u ovoj kompakciji, 0 - najnovija
+	var newer Entry    // prethodna (novija) verzija istog kljuca
+	var keep retention // pravilo cuvanja verzija za trenutni kljuc
+	var pending *Entry // tombstone koji se izbacuje ako kljuc nema starijih verzija koje ostaju
+	for it.next() {
+		entry := it.entry()
+		if entry.Expired(now) {
+			entry.Tombstone, entry.Value, entry.ExpiresAt = true, nil, 0
+		}
+		if first || entry.Key != lastKey {
+			if pending != nil {
+				dropped++
+				pending = nil
+			}
+			first = false
+			lastKey, rank, keep = entry.Key, 0, retentionFor(entry.Key, now)
+		} else {
+			rank++
+		}
+
+		if _, covered := CoveringTombstone(dels, entry.Key, entry.Seq, oldest); covered {
+			newer = entry
+			continue
+		}
+
+		drop := false
+		if rank > 0 {
+			drop = newer.Seq <= oldest && !keep.keeps(rank, newer.Timestamp)
+		} else if entry.Tombstone && entry.Seq <= oldest && dropTombstone(entry.Key) {
+			e := entry
+			pending = &e
+			drop = true
+		}
+		newer = entry
+		if drop {
+			continue
+		}
+
+		// starija verzija ostaje, pa ostaje i tombstone iznad nje
+		if pending != nil {
+			if err := out.add(*pending); err != nil {
+				return written, dropped, err
+			}
+			written++
+			pending = nil
+		}
+		if err := out.add(entry); err != nil {
+			return written, dropped, err
+		}
+		written++
+	}
+	if pending != nil {
+		dropped++
+	}
+	if err := it.error(); err != nil {
+		return written, dropped, fmt.Errorf("greska pri citanju ulaznih tabela: %v", err)
+	}
+	return written, dropped + droppedRanges, nil
+}
+
+// keptRangeTombstones vraca brisanja opsega iz ulaznih tabela koja ostaju posle kompakcije i broj izbacenih
+// brisanje se izbacuje kada ga vide svi snapshot-ovi i nijedna tabela van kompakcije nema kljuceve iz njegovog opsega
+// (tabele koje nastanu dok kompakcija traje imaju samo novije upise, pa ih ono ne sakriva)
+func keptRangeTombstones(m *Manifest, inputs []TableMeta, oldest uint64) ([]RangeTombstone, int) {
+	isInput := make(map[string]bool, len(inputs))
+	for _, t := range inputs {
+		isInput[t.Name] = true
+	}
+	var others []TableMeta
+	for _, t := range m.Tables() {
+		if !isInput[t.Name] && t.Count > 0 {
+			others = append(others, t)
+		}
+	}
+
+	var kept []RangeTombstone
+	dropped := 0
+	for _, del := range RangeTombstonesOf(inputs) {
+		needed := del.Seq > oldest
+		for _, t := range others {
+			if needed {
+				break
+			}
+			needed = del.Overlaps(t.MinKey, t.MaxKey)
+		}
+		if needed {
+			kept = append(kept, del)
+		} else {
+			dropped++
+		}
+	}
+	return kept, dropped
+}
+
+// retention odlucuje koje starije verzije jednog kljuca kompakcija zadrzava (vidi config.VersionRetention)
+type retention struct {
+	maxVersions int
+	cutoff      int64 // verzija koja je bila vazeca posle ovog trenutka (UnixNano) ostaje, 0 - bez vremenskog prozora
+}
+
+func retentionFor(key string, now int64) retention {
+	rule, ok := config.Current.RetentionFor(key)
+	if !ok {
+		return retention{maxVersions: 1}
+	}
+	r := retention{maxVersions: rule.MaxVersions}
+	if rule.RetentionSeconds > 0 {
+		r.cutoff = now - rule.RetentionSeconds*int64(time.Second)
+	}
+	return r
+}
+
+// keeps kaze da li ostaje verzija sa rednim brojem rank (0 - najnovija);
+// replacedAt je vreme upisa novije verzije, do tada je ova bila vazeca
+func (r retention) keeps(rank int, replacedAt int64) bool {
+	return rank < r.maxVersions || (r.cutoff > 0 && replacedAt > r.cutoff)
+}
+
+// targetFileSize vraca velicinu posle koje kompakcija zapocinje novu izlaznu tabelu
+func targetFileSize() int64 {
+	if config.Current.TargetFileSizeBytes > 0 {
+		return config.Current.TargetFileSizeBytes
+	}
+	return 64 * 1024
+}
@@ -0,0 +1,102 @@
+package sstable
+
+import (
+	"fmt"
+	"napredni/blockmanager"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeTestTable upisuje sortirane zapise u jednu novu tabelu na nivou level i dodaje je u manifest
+func writeTestTable(t *testing.T, m *Manifest, level int, entries []Entry, bm *blockmanager.BlockManager) TableMeta {
+	t.Helper()
+	out := newCompactionOutput(m, level, 0, nil, bm)
+	for _, entry := range entries {
+		if err := out.add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables, err := out.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 {
+		t.Fatalf("napravljeno %d tabela, ocekivana jedna", len(tables))
+	}
+	mustApply(t, m, VersionEdit{Added: tables})
+	return tables[0]
+}
+
+// k-way merge daje samo najnoviju verziju kljuca, a izlaz se deli na vise tabela kada trenutna predje ciljnu velicinu
+func TestMergeIntoRollsOutputTables(t *testing.T) {
+	bm := blockmanager.NewBlockManager(1, 16)
+	m := openTestManifest(t, t.TempDir())
+
+	// tri tabele sa preklapajucim kljucevima; svaka sledeca ima novije verzije
+	want := make(map[string]Entry)
+	var inputs []TableMeta
+	seq := uint64(0)
+	for round := 0; round < 3; round++ {
+		var entries []Entry
+		for i := round; i < 300; i += 1 + round {
+			seq++
+			entry := Entry{Key: fmt.Sprintf("key%04d", i), Value: []byte(fmt.Sprintf("v%d-%d", round, i)), Seq: seq}
+			if round == 2 && i%10 == 2 {
+				entry.Value, entry.Tombstone = nil, true
+			}
+			entries = append(entries, entry)
+			want[entry.Key] = entry
+		}
+		inputs = append(inputs, writeTestTable(t, m, 0, entries, bm))
+	}
+
+	const target = 2048
+	out := newCompactionOutput(m, 1, target, inputs, bm)
+	written, dropped, err := mergeInto(m, inputs, out, func(string) bool { return true }, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := out.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []Entry
+	tombstones := 0
+	for _, entry := range want {
+		if entry.Tombstone {
+			tombstones++
+			continue
+		}
+		expected = append(expected, entry)
+	}
+	sort.Slice(expected, func(i, j int) bool { return expected[i].Key < expected[j].Key })
+	if written != len(expected) || dropped != tombstones {
+		t.Fatalf("upisano %d, izbaceno %d; ocekivano %d i %d", written, dropped, len(expected), tombstones)
+	}
+	if len(tables) < 2 {
+		t.Fatalf("izlaz je %d tabela, ocekivano vise tabela od po %d bajtova", len(tables), target)
+	}
+
+	// izlazne tabele su disjunktne i redom po kljucu, zajedno sadrze tacno ocekivane zapise
+	var got []Entry
+	for i, table := range tables {
+		if table.Level != 1 {
+			t.Fatalf("tabela %s je na nivou %d", table.Name, table.Level)
+		}
+		if i > 0 && tables[i-1].MaxKey >= table.MinKey {
+			t.Fatalf("tabele %s i %s se preklapaju", tables[i-1].Name, table.Name)
+		}
+		it := newTableIterator(m, table, bm)
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			got = append(got, it.Entry())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("spojeni zapisi se razlikuju od ocekivanih: %d zapisa, ocekivano %d", len(got), len(expected))
+	}
+}
@@ -0,0 +1,317 @@
+package sstable
+
+import (
+	"fmt"
+	"napredni/blockmanager"
+	"napredni/config"
+	"sort"
+)
+
+// Leveled kompakcija:
+//   - L0 nastaje flush-om i tabele na njemu mogu da se preklapaju; kompaktira se kada ima vise od sstable_files_per_level tabela
+//   - na L1 i nizim nivoima tabele imaju disjunktne opsege kljuceva, pa je kljuc na jednom nivou u najvise jednoj tabeli
+//   - ciljna velicina L1 je level_base_bytes, a svaki sledeci nivo je level_size_multiplier puta veci
+//   - kompaktira se nivo sa najvecim odnosom velicine i cilja (score > 1); sa L0 se uzimaju sve tabele,
+//     a sa L1+ jedna tabela, redom po kljucevima od mesta gde je stala prethodna kompakcija tog nivoa
+//   - uz njih idu sve tabele sa sledeceg nivoa koje se preklapaju sa njima, pa je rezultat opet disjunktan sa ostatkom nivoa
+//   - od vise verzija kljuca ostaje najnovija (najveci Seq); tombstone se izbacuje samo kada ispod izlaznog nivoa
+//     nijedna tabela ne pokriva taj kljuc, inace bi ispod njega "oziveo" stariji zapis
+//   - poslednji nivo (max_levels-1) se ne kompaktira dalje
+//
+// Strategija se bira sa compaction_strategy (leveled ili size_tiered, vidi tiered.go)
+
+const (
+	StrategyLeveled    = "leveled"
+	StrategySizeTiered = "size_tiered"
+)
+
+// CompactionStrategy vraca strategiju kompakcije iz konfiguracije, podrazumevano je leveled
+func CompactionStrategy() string {
+	if config.Current.CompactionStrategy == StrategySizeTiered {
+		return StrategySizeTiered
+	}
+	return StrategyLeveled
+}
+
+const (
+	defaultLevelBaseBytes      = 256 * 1024
+	defaultLevelSizeMultiplier = 10
+)
+
+// poslednji nivo na koji kompakcija upisuje
+func bottomLevel() int {
+	if config.Current.MaxSSTableLevels > 0 {
+		return config.Current.MaxSSTableLevels - 1
+	}
+	return 0
+}
+
+// l0Trigger vraca broj tabela na L0 posle kog se L0 kompaktira
+func l0Trigger() int {
+	if config.Current.SSTableFilesPerLevel > 0 {
+		return config.Current.SSTableFilesPerLevel
+	}
+	return 1
+}
+
+// LevelTargetBytes vraca ciljnu velicinu nivoa (za L1 i nize)
+func LevelTargetBytes(level int) int64 {
+	target := config.Current.LevelBaseBytes
+	if target <= 0 {
+		target = defaultLevelBaseBytes
+	}
+	multiplier := int64(config.Current.LevelSizeMultiplier)
+	if multiplier <= 1 {
+		multiplier = defaultLevelSizeMultiplier
+	}
+	for l := 1; l < level; l++ {
+		target *= multiplier
+	}
+	return target
+}
+
+func totalSize(tables []TableMeta) int64 {
+	var size int64
+	for _, t := range tables {
+		size += t.Size
+	}
+	return size
+}
+
+// levelScore vraca koliko je nivo preko svog cilja, kompakcija je potrebna kada je score > 1
+func levelScore(m *Manifest, level int) float64 {
+	if level >= bottomLevel() {
+		return 0
+	}
+	tables := m.LevelTables(level)
+	if level == 0 {
+		return float64(len(tables)) / float64(l0Trigger())
+	}
+	return float64(totalSize(tables)) / float64(LevelTargetBytes(level))
+}
+
+// pickLevel bira nivo sa najvecim score-om koji niko drugi ne kompaktira i rezervise ga
+func pickLevel(m *Manifest) (int, bool) {
+	type candidate struct {
+		level int
+		score float64
+	}
+	var candidates []candidate
+	for level := 0; level < bottomLevel(); level++ {
+		if score := levelScore(m, level); score > 1 {
+			candidates = append(candidates, candidate{level, score})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	for _, c := range candidates {
+		if m.reserveLevels(c.level) {
+			return c.level, true
+		}
+	}
+	return 0, false
+}
+
+// pickInputs bira tabele za kompakciju nivoa: tabele sa tog nivoa i tabele sa sledeceg nivoa koje se preklapaju sa njima
+func pickInputs(m *Manifest, level int) (inputs []TableMeta, overlapping []TableMeta) {
+	tables := m.LevelTables(level)
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	if level == 0 {
+		inputs = tables
+	} else {
+		sort.Slice(tables, func(i, j int) bool { return tables[i].MinKey < tables[j].MinKey })
+		pointer := m.getCompactPointer(level)
+		picked := tables[0]
+		for _, t := range tables {
+			if t.MinKey > pointer {
+				picked = t
+				break
+			}
+		}
+		// u bazi iz vremena pre leveled kompakcije tabele na nivou mogu da se preklapaju,
+		// pa uzimamo i sve tabele istog nivoa koje se preklapaju sa izabranom
+		inputs = expandOverlapping([]TableMeta{picked}, tables)
+	}
+
+	minKey, maxKey := keyRange(inputs)
+	for _, t := range m.LevelTables(level + 1) {
+		if t.Overlaps(minKey, maxKey) {
+			overlapping = append(overlapping, t)
+		}
+	}
+	return inputs, overlapping
+}
+
+// expandOverlapping dodaje tabele iz candidates koje se preklapaju sa opsegom izabranih, dok god se opseg siri
+func expandOverlapping(picked []TableMeta, candidates []TableMeta) []TableMeta {
+	chosen := make(map[string]bool)
+	for _, t := range picked {
+		chosen[t.Name] = true
+	}
+	for grew := true; grew; {
+		grew = false
+		minKey, maxKey := keyRange(picked)
+		for _, t := range candidates {
+			if !chosen[t.Name] && t.Overlaps(minKey, maxKey) {
+				chosen[t.Name] = true
+				picked = append(picked, t)
+				grew = true
+			}
+		}
+	}
+	return picked
+}
+
+// tabela bez zapisa (samo sa brisanjima opsega) nema opseg kljuceva, pa se preskace
+func keyRange(tables []TableMeta) (string, string) {
+	var minKey, maxKey string
+	first := true
+	for _, t := range tables {
+		if t.Count == 0 {
+			continue
+		}
+		if first || t.MinKey < minKey {
+			minKey = t.MinKey
+		}
+		if first || t.MaxKey > maxKey {
+			maxKey = t.MaxKey
+		}
+		first = false
+	}
+	return minKey, maxKey
+}
+
+// coveredBelow javlja da li neka tabela ispod datog nivoa pokriva kljuc
+func coveredBelow(deeper []TableMeta, key string) bool {
+	for _, t := range deeper {
+		if t.Contains(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompactLevel kompaktira jedan nivo u sledeci, ako je nivo preko svog cilja
+// ako nivo ili sledeci nivo vec kompaktira neko drugi (druga gorutina), ne radi nista
+func CompactLevel(m *Manifest, level int, bm *blockmanager.BlockManager) error {
+	m.compactMu.RLock()
+	defer m.compactMu.RUnlock()
+
+	if levelScore(m, level) <= 1 || !m.reserveLevels(level) {
+		return nil
+	}
+	defer m.releaseLevels(level)
+	return compactLevel(m, level, bm)
+}
+
+// compactLevel radi kompakciju nivoa, pozivalac je vec rezervisao nivo i nivo ispod njega
+func compactLevel(m *Manifest, level int, bm *blockmanager.BlockManager) error {
+	inputs, overlapping := pickInputs(m, level)
+	if len(inputs) == 0 {
+		return nil
+	}
+	outLevel := level + 1
+	fmt.Printf(" Pokrećem kompakciju nivoa %d: %d tabela + %d sa nivoa %d\n", level, len(inputs), len(overlapping), outLevel)
+
+	all := append(append([]TableMeta{}, inputs...), overlapping...)
+	var deeper []TableMeta
+	for _, t := range m.Tables() {
+		if t.Level > outLevel {
+			deeper = append(deeper, t)
+		}
+	}
+
+	// izlaz se deli na tabele od po target_file_size_bytes, da bi sledeca kompakcija ovog nivoa
+	// mogla da uzme samo deo opsega
+	out := newCompactionOutput(m, outLevel, targetFileSize(), all, bm)
+	written, dropped, err := mergeInto(m, all, out, func(key string) bool {
+		return !coveredBelow(deeper, key)
+	}, bm)
+	if err != nil {
+		out.abort()
+		return err
+	}
+	added, err := out.finish()
+	if err != nil {
+		out.abort()
+		return err
+	}
+
+	if err := replaceTables(m, all, added); err != nil {
+		return err
+	}
+	if level > 0 {
+		_, maxKey := keyRange(inputs)
+		m.setCompactPointer(level, maxKey)
+	}
+
+	fmt.Printf("Kompaktiranje nivoa %d uspešno! %d zapisa u %d tabela na nivou %d, izbaceno %d tombstone-a.\n",
+		level, written, len(added), outLevel, dropped)
+	return nil
+}
+
+// AutoCompact radi kompakciju po strategiji iz konfiguracije dok god ima posla
+func AutoCompact(m *Manifest, bm *blockmanager.BlockManager) error {
+	if CompactionStrategy() == StrategySizeTiered {
+		return autoCompactTiered(m, bm)
+	}
+	return autoCompactLeveled(m, bm)
+}
+
+// autoCompactLeveled kompaktira nivoe dok god neki nivo ima score > 1 (a nije zauzet drugom kompakcijom)
+func autoCompactLeveled(m *Manifest, bm *blockmanager.BlockManager) error {
+	m.compactMu.RLock()
+	defer m.compactMu.RUnlock()
+
+	for {
+		level, ok := pickLevel(m)
+		if !ok {
+			return nil
+		}
+		err := compactLevel(m, level, bm)
+		m.releaseLevels(level)
+		if err != nil {
+			return fmt.Errorf("greska pri kompaktiranju nivoa %d: %v", level, err)
+		}
+	}
+}
+
+// PendingCompactionBytes procenjuje koliko bajtova ceka kompakciju:
+// cela velicina L0 kada je preko praga, i visak preko ciljne velicine na ostalim nivoima
+func PendingCompactionBytes(m *Manifest) int64 {
+	if CompactionStrategy() == StrategySizeTiered {
+		return pendingTieredBytes(m)
+	}
+
+	var pending int64
+	for level := 0; level < bottomLevel(); level++ {
+		tables := m.LevelTables(level)
+		if level == 0 {
+			if len(tables) > l0Trigger() {
+				pending += totalSize(tables)
+			}
+			continue
+		}
+		if excess := totalSize(tables) - LevelTargetBytes(level); excess > 0 {
+			pending += excess
+		}
+	}
+	return pending
+}
+
+// NeedsCompaction javlja da li postoji nivo preko cilja koji trenutno niko ne kompaktira
+func NeedsCompaction(m *Manifest) bool {
+	if CompactionStrategy() == StrategySizeTiered {
+		return len(pickBucket(m)) > 0 && !m.levelsBusy(0)
+	}
+
+	for level := 0; level < bottomLevel(); level++ {
+		if levelScore(m, level) > 1 && !m.levelsBusy(level) {
+			return true
+		}
+	}
+	return false
+}
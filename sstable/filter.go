@@ -0,0 +1,47 @@
+package sstable
+
+import (
+	"napredni/bloomfilter"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// bloom filter svake SSTable se ucitava samo jednom i drzi u memoriji
+// kljuc mape je putanja do sstable foldera
+var (
+	filterMu     sync.Mutex
+	filters      = make(map[string]*bloomfilter.BloomFilter)
+	bloomSkipped uint64 // koliko puta je bloom filter rekao "sigurno ne postoji"
+)
+
+// vraca bloom filter za dati sstable folder, ako fajl ne postoji ili je ostecen vraca nil
+// u tom slucaju se tabela pretrazuje normalno; i neuspelo ucitavanje se pamti (kao nil - "mozda postoji"),
+// da se fajl ne bi ponovo citao sa diska pri svakoj pretrazi
+func loadFilter(sstablePath string) *bloomfilter.BloomFilter {
+	filterMu.Lock()
+	defer filterMu.Unlock()
+
+	if bf, ok := filters[sstablePath]; ok {
+		return bf
+	}
+
+	bf, err := bloomfilter.LoadFromFile(filepath.Join(sstablePath, "bloom"))
+	if err != nil {
+		bf = nil
+	}
+	filters[sstablePath] = bf
+	return bf
+}
+
+// ForgetFilter izbacuje filter iz memorije, poziva se kada se sstable obrise
+func ForgetFilter(sstablePath string) {
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	delete(filters, sstablePath)
+}
+
+// BloomSkippedCount vraca broj pretraga tabela koje je bloom filter preskocio
+func BloomSkippedCount() uint64 {
+	return atomic.LoadUint64(&bloomSkipped)
+}
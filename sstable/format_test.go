@@ -0,0 +1,165 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// pravi tabelu u starom formatu: meta ima samo broj zapisa, svaki zapis je u svom bloku
+func writeLegacyTable(t *testing.T, dir, name string, entries []Entry, bm *blockmanager.BlockManager) {
+	t.Helper()
+	makeTableDir(t, dir, name)
+	dataPath := filepath.Join(dir, name, "data")
+	os.Remove(dataPath)
+	for i, e := range entries {
+		buf := binary.LittleEndian.AppendUint64(nil, e.Seq)
+		if e.Tombstone {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(e.Key)))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(e.Value)))
+		buf = append(buf, e.Key...)
+		buf = append(buf, e.Value...)
+		if err := bm.WriteBlock(blockmanager.BlockID{Path: dataPath, Num: int64(i)}, buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := binary.LittleEndian.AppendUint64(nil, uint64(len(entries)))
+	if err := os.WriteFile(filepath.Join(dir, name, "meta"), meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetaRoundTrip(t *testing.T) {
+	meta, rangeDels, err := decodeMeta(encodeMeta(42, "a", "zz", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 42 || meta.MinKey != "a" || meta.MaxKey != "zz" || meta.Format != TableFormatVersion || rangeDels != 3 {
+		t.Fatalf("pogresno procitan meta: %+v", meta)
+	}
+}
+
+// stara tabela se pri otvaranju prepisuje u trenutni format, podaci i redosled tabela ostaju isti
+func TestOpenUpgradesLegacyTable(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+
+	// stari format cuva vreme upisa, ono postaje i Seq i Timestamp
+	entries := []Entry{
+		{Key: "a", Value: []byte("1"), Seq: 10, Timestamp: 10},
+		{Key: "b", Tombstone: true, Seq: 11, Timestamp: 11},
+		{Key: "c", Value: []byte("3"), Seq: 12, Timestamp: 12},
+	}
+	writeLegacyTable(t, dir, "sstable_L1_100", entries, bm)
+
+	m := openTestManifest(t, dir)
+	tables := m.Tables()
+	if len(tables) != 1 || tables[0].Format != TableFormatVersion || tables[0].Level != 1 {
+		t.Fatalf("tabela nije prepisana u novi format: %+v", tables)
+	}
+	if tables[0].MinKey != "a" || tables[0].MaxKey != "c" || tables[0].Count != 3 {
+		t.Fatalf("pogresan opseg prepisane tabele: %+v", tables[0])
+	}
+	if m.LastSequence() != 12 {
+		t.Fatalf("poslednji redni broj upisa = %d, ocekivano 12 (najveci iz stare tabele)", m.LastSequence())
+	}
+	if exists(filepath.Join(dir, "sstable_L1_100")) {
+		t.Error("stara tabela nije uklonjena posle prepisivanja")
+	}
+
+	got, err := ReadDataFileWithBlocks(filepath.Join(m.TablePath(tables[0].Name), "data"), int(tables[0].Count), bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if len(got[i].Value) == 0 {
+			got[i].Value = nil
+		}
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("podaci posle prepisivanja:\n%+v\nocekivano:\n%+v", got, entries)
+	}
+}
+
+// manifest iz starije verzije (tabele bez formata) se takodje prevodi
+func TestOpenUpgradesLegacyManifestEntry(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+
+	m, err := OpenManifest(dir, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLegacyTable(t, dir, "sstable_L0_2", []Entry{{Key: "k", Value: []byte("v"), Seq: 1}}, bm)
+	newer := TableMeta{Name: "sstable_L0_3", MinKey: "k", MaxKey: "k", Count: 1, CreatedSeq: 3, Format: TableFormatVersion}
+	makeTableDir(t, dir, newer.Name)
+	if err := m.Apply(VersionEdit{Added: []TableMeta{{Name: "sstable_L0_2", MinKey: "k", MaxKey: "k", Count: 1, CreatedSeq: 2}, newer}}); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	m = openTestManifest(t, dir)
+	tables := m.Tables()
+	if len(tables) != 2 || tables[0].Name != newer.Name || tables[1].Format != TableFormatVersion || tables[1].CreatedSeq != 2 {
+		t.Fatalf("posle prepisivanja: %+v", tables)
+	}
+}
+
+// tabela iz novije verzije baze (nepoznat format) ne sme ni da se preskoci ni da se cita pogresno
+func TestOpenRefusesUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+
+	makeTableDir(t, dir, "sstable_L0_1")
+	meta := binary.LittleEndian.AppendUint32([]byte(metaMagic), TableFormatVersion+1)
+	if err := os.WriteFile(filepath.Join(dir, "sstable_L0_1", "meta"), meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenManifest(dir, bm); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("ocekivana greska ErrUnsupportedFormat, dobijeno %v", err)
+	}
+	if !exists(filepath.Join(dir, "sstable_L0_1", "data")) {
+		t.Error("tabela je uklonjena")
+	}
+}
+
+// vrednost veca od bloka dobija svoj blok preko vise blokova na disku, susedni zapisi se citaju normalno
+func TestEntrySpansMultipleBlocks(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+	m := openTestManifest(t, dir)
+
+	big := make([]byte, 3*bm.BlockSize())
+	for i := range big {
+		big[i] = byte(i)
+	}
+	entries := []Entry{
+		{Key: "a", Value: []byte("1"), Seq: 1},
+		{Key: "b", Value: big, Seq: 2},
+		{Key: "c", Value: []byte("3"), Seq: 3},
+	}
+	meta := writeTestTable(t, m, 0, entries, bm)
+
+	got, err := ReadDataFileWithBlocks(filepath.Join(m.TablePath(meta.Name), "data"), int(meta.Count), bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("procitani zapisi se razlikuju od upisanih")
+	}
+	for _, e := range entries {
+		if value, ok := FastGetFromSSTablesWithBlocks(m, e.Key, bm); !ok || !bytes.Equal(value, e.Value) {
+			t.Fatalf("pretraga kljuca %q: nadjeno %v, %d bajtova", e.Key, ok, len(value))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package sstable
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Nova SSTable (flush ili kompakcija) se uvek pravi u privremenom folderu <ime>.tmp
+// Kada su svi fajlovi upisani radi se fsync, pa se folder atomski preimenuje u konacno ime
+// Tek posle toga se tabela registruje u manifestu, a ulazne tabele brisu
+// Ako baza padne bilo gde usred toga, pri pokretanju se brisu .tmp folderi i folderi tabela koje je manifest izbacio
+// Ostali folderi koji nisu u manifestu (ne mogu da se procitaju, ili tabela nije stigla da se registruje)
+// se ne brisu nego premestaju u quarantine folder, da se podaci ne bi izgubili
+
+const (
+	tmpSuffix     = ".tmp"
+	quarantineDir = "quarantine"
+)
+
+// TempTablePath vraca putanju privremenog foldera u kome se gradi tabela
+func (m *Manifest) TempTablePath(name string) string {
+	return filepath.Join(m.dir, name+tmpSuffix)
+}
+
+// InstallTable radi fsync svih fajlova privremenog foldera i preimenuje ga u konacno ime
+func InstallTable(tmpPath, finalPath string) error {
+	if err := syncDir(tmpPath, true); err != nil {
+		return fmt.Errorf("ne mogu da uradim fsync za %s: %v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return fmt.Errorf("ne mogu da preimenujem %s u %s: %v", tmpPath, finalPath, err)
+	}
+	// fsync roditeljskog foldera da bi i sam rename bio trajan
+	return syncDir(filepath.Dir(finalPath), false)
+}
+
+// radi fsync foldera, a ako je withFiles true i svih fajlova u njemu
+func syncDir(path string, withFiles bool) error {
+	if withFiles {
+		files, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			if err := syncFile(filepath.Join(path, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// upisuje fajl preko privremenog fajla i rename-a, tako da se na disku vidi ili stari ili novi sadrzaj
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + tmpSuffix
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path), false)
+}
+
+// brise ostatke prekinutih flush-eva i kompakcija: privremene foldere i foldere tabela koje je manifest izbacio
+// SSTable folder koji nije u manifestu, a manifest ga nije ni izbacio, premesta se u quarantine
+func (m *Manifest) removeLeftovers() {
+	files, err := os.ReadDir(m.dir)
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		if !f.IsDir() || !strings.HasPrefix(name, "sstable_") {
+			continue
+		}
+		if _, live := m.tables[name]; live {
+			continue
+		}
+		if !strings.HasSuffix(name, tmpSuffix) && !m.removed[name] {
+			m.quarantine(name)
+			continue
+		}
+		fmt.Printf(" Brisem nedovrsen SSTable folder: %s\n", name)
+		if err := os.RemoveAll(filepath.Join(m.dir, name)); err != nil {
+			fmt.Printf(" Ne mogu da obrišem %s: %v\n", name, err)
+		}
+	}
+}
+
+// premesta SSTable folder koji nije u manifestu u quarantine folder, odakle moze rucno da se pregleda ili vrati
+func (m *Manifest) quarantine(name string) {
+	dir := filepath.Join(m.dir, quarantineDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		fmt.Printf(" Ne mogu da napravim %s: %v\n", dir, err)
+		return
+	}
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		target = filepath.Join(dir, fmt.Sprintf("%s_%d", name, time.Now().UnixNano()))
+	}
+	fmt.Printf(" SSTable folder %s nije u manifestu, premestam ga u %s\n", name, target)
+	if err := os.Rename(filepath.Join(m.dir, name), target); err != nil {
+		fmt.Printf(" Ne mogu da premestim %s: %v\n", name, err)
+	}
+}
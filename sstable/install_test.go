@@ -0,0 +1,88 @@
+package sstable
+
+import (
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeTableDir(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "data"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// pri otvaranju se brisu samo .tmp folderi i tabele koje je manifest izbacio, nepoznate tabele idu u quarantine
+func TestRemoveLeftoversKeepsUnknownTables(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+
+	m, err := OpenManifest(dir, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeTableDir(t, dir, "sstable_L0_9")
+	if err := m.Apply(VersionEdit{Added: []TableMeta{{Name: "sstable_L0_9", Count: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Apply(VersionEdit{Removed: []string{"sstable_L0_9"}}); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	makeTableDir(t, dir, "sstable_L0_5.tmp")
+	makeTableDir(t, dir, "sstable_L0_7")
+
+	m, err = OpenManifest(dir, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if exists(filepath.Join(dir, "sstable_L0_5.tmp")) {
+		t.Error("privremeni folder nije obrisan")
+	}
+	if exists(filepath.Join(dir, "sstable_L0_9")) {
+		t.Error("tabela koju je manifest izbacio nije obrisana")
+	}
+	if exists(filepath.Join(dir, "sstable_L0_7")) {
+		t.Error("nepoznata tabela je ostala medju tabelama")
+	}
+	if !exists(filepath.Join(dir, quarantineDir, "sstable_L0_7", "data")) {
+		t.Error("nepoznata tabela nije premestena u quarantine")
+	}
+}
+
+// tabela koja ne moze da se procita pri pravljenju manifesta se ne brise
+func TestBootstrapQuarantinesUnreadableTable(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+
+	makeTableDir(t, dir, "sstable_L0_3")
+	if err := os.WriteFile(filepath.Join(dir, "sstable_L0_3", "meta"), []byte{1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := OpenManifest(dir, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if len(m.Tables()) != 0 {
+		t.Fatalf("ostecena tabela je u manifestu: %v", m.Tables())
+	}
+	if !exists(filepath.Join(dir, quarantineDir, "sstable_L0_3", "data")) {
+		t.Error("ostecena tabela nije premestena u quarantine")
+	}
+}
@@ -0,0 +1,545 @@
+package sstable
+
+import (
+	"container/heap"
+	"fmt"
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Iteratori za citanje redom po kljucu, bez ucitavanja svega u memoriju:
+//   - tableIterator cita data fajl jedne tabele blok po blok (u memoriji je samo trenutni blok)
+//   - sliceIterator ide kroz vec sortiran niz zapisa (npr. kopija hashmap Memtable)
+//   - Memtable iteratori su u paketu memtable
+//   - MergingIterator spaja iteratore Memtable-ova i tabela u pogled na bazu: za svaki kljuc samo najnovija
+//     verzija (najveci Seq, a ne veci od zadatog - snapshot), a obrisani kljucevi se preskacu
+//   - mergeIterator (k-way merge preko heap-a) koristi kompakcija, on vraca sve verzije i tombstone-e
+//
+// Novi iterator nije ni na jednom zapisu, prvo se pozove Seek, SeekToFirst ili SeekToLast
+// Next i Prev na iteratoru koji nije Valid ne rade nista
+
+// Iterator je iterator nad kljucevima sortiranim rastuce
+type Iterator interface {
+	Seek(key string) // na prvi kljuc >= key
+	SeekToFirst()
+	SeekToLast()
+	Next()
+	Prev()
+	Valid() bool   // da li je iterator na nekom zapisu
+	Key() string   // trenutni kljuc, samo dok je Valid
+	Value() []byte // trenutna vrednost, samo dok je Valid
+	Err() error    // greska zbog koje je iterator stao, ako je bilo
+	Close() error
+}
+
+// InternalIterator vidi i tombstone-e i redne brojeve upisa; kljuc moze imati vise verzija,
+// one idu jedna za drugom, od najnovije ka najstarijoj (Seek staje na najnoviju)
+// takvi su iteratori Memtable-ova i tabela, a u pogled na bazu ih spaja MergingIterator
+type InternalIterator interface {
+	Iterator
+	Entry() Entry // ceo trenutni zapis (Seq, Tombstone)
+}
+
+type tableIterator struct {
+	bm          *blockmanager.BlockManager
+	sstablePath string
+	path        string // data fajl
+	blocks      int64  // broj blokova u data fajlu
+	blockStart  int64  // prvi blok trenutnog (mozda fragmentisanog) bloka
+	blockNext   int64  // blok posle trenutnog
+	block       []blockEntry
+	pos         int
+	cur         Entry
+	valid       bool
+	err         error
+}
+
+// NewTableIterator pravi iterator nad jednom tabelom; tabela mora da ostane na disku dok se iterator koristi
+// (pozivalac drzi Manifest.RLockFiles ili je tabelu uzeo preko PinTables)
+func NewTableIterator(m *Manifest, table TableMeta, bm *blockmanager.BlockManager) InternalIterator {
+	return newTableIterator(m, table, bm)
+}
+
+func newTableIterator(m *Manifest, table TableMeta, bm *blockmanager.BlockManager) *tableIterator {
+	sstablePath := m.TablePath(table.Name)
+	it := &tableIterator{bm: bm, sstablePath: sstablePath, path: filepath.Join(sstablePath, "data")}
+
+	info, err := os.Stat(it.path)
+	if err != nil {
+		it.err = fmt.Errorf("ne mogu da otvorim data fajl %s: %v", it.path, err)
+		return it
+	}
+	blockSize := int64(bm.BlockSize())
+	it.blocks = (info.Size() + blockSize - 1) / blockSize
+	return it
+}
+
+// seekDataBlock vraca blok data fajla u kom je prvi kljuc >= key, preko summary i index fajla
+// ako takvog kljuca nema, vraca kraj fajla
+func seekDataBlock(bm *blockmanager.BlockManager, sstablePath string, key string, blocks int64) int64 {
+	var start EntryPos
+	if pos, found := FindClosestIndexOffsetWithBlocks(bm, filepath.Join(sstablePath, "summary"), key); found {
+		start = pos
+	}
+
+	indexPath := filepath.Join(sstablePath, "index")
+	for blockNum := start.Block; ; {
+		data, next, err := readBlock(bm, indexPath, blockNum)
+		if err != nil {
+			return blocks
+		}
+		entries, err := decodeBlock(data)
+		if err != nil {
+			// bez index-a krecemo od pocetka, Seek ce sam preskociti manje kljuceve
+			return 0
+		}
+		for _, e := range entries {
+			if blockNum == start.Block && e.offset < start.Offset {
+				continue
+			}
+			if e.key >= key {
+				pos, err := decodeEntryPos(e.value)
+				if err != nil {
+					return 0
+				}
+				return pos.Block
+			}
+		}
+		blockNum = next
+	}
+}
+
+// loadBlock ucitava blok koji pocinje na start
+func (it *tableIterator) loadBlock(start int64) bool {
+	data, next, err := readBlock(it.bm, it.path, start)
+	if err != nil {
+		it.err = fmt.Errorf("ne mogu da procitam blok %d iz %s: %v", start, it.path, err)
+		it.valid = false
+		return false
+	}
+	block, err := decodeBlock(data)
+	if err != nil {
+		it.err = fmt.Errorf("korumpiran blok %d u %s: %v", start, it.path, err)
+		it.valid = false
+		return false
+	}
+	it.block, it.blockStart, it.blockNext = block, start, next
+	return true
+}
+
+// setPos postavlja iterator na zapis pos u trenutnom bloku
+func (it *tableIterator) setPos(pos int) {
+	if pos < 0 || pos >= len(it.block) {
+		it.valid = false
+		return
+	}
+	entry, err := decodeDataEntry(it.block[pos])
+	if err != nil {
+		it.err = err
+		it.valid = false
+		return
+	}
+	it.pos, it.cur, it.valid = pos, entry, true
+}
+
+func (it *tableIterator) SeekToFirst() {
+	it.valid = false
+	if it.err != nil || it.blocks == 0 {
+		return
+	}
+	if it.loadBlock(0) {
+		it.setPos(0)
+	}
+}
+
+func (it *tableIterator) SeekToLast() {
+	it.valid = false
+	if it.err != nil || it.blocks == 0 {
+		return
+	}
+	start, err := prevBlockStart(it.bm, it.path, it.blocks)
+	if err != nil {
+		it.err = err
+		return
+	}
+	if it.loadBlock(start) {
+		it.setPos(len(it.block) - 1)
+	}
+}
+
+func (it *tableIterator) Seek(key string) {
+	it.valid = false
+	if it.err != nil || it.blocks == 0 {
+		return
+	}
+	start := seekDataBlock(it.bm, it.sstablePath, key, it.blocks)
+	if start >= it.blocks || !it.loadBlock(start) {
+		return
+	}
+	pos := sort.Search(len(it.block), func(i int) bool { return it.block[i].key >= key })
+	if pos < len(it.block) {
+		it.setPos(pos)
+	} else {
+		it.setPos(len(it.block) - 1)
+		it.Next()
+	}
+	for it.valid && it.cur.Key < key {
+		it.Next()
+	}
+}
+
+func (it *tableIterator) Next() {
+	if !it.valid {
+		return
+	}
+	if it.pos+1 < len(it.block) {
+		it.setPos(it.pos + 1)
+		return
+	}
+	if it.blockNext >= it.blocks {
+		it.valid = false
+		return
+	}
+	if it.loadBlock(it.blockNext) {
+		it.setPos(0)
+	}
+}
+
+func (it *tableIterator) Prev() {
+	if !it.valid {
+		return
+	}
+	if it.pos > 0 {
+		it.setPos(it.pos - 1)
+		return
+	}
+	if it.blockStart == 0 {
+		it.valid = false
+		return
+	}
+	start, err := prevBlockStart(it.bm, it.path, it.blockStart)
+	if err != nil {
+		it.err = err
+		it.valid = false
+		return
+	}
+	if it.loadBlock(start) {
+		it.setPos(len(it.block) - 1)
+	}
+}
+
+func (it *tableIterator) Valid() bool   { return it.valid }
+func (it *tableIterator) Key() string   { return it.cur.Key }
+func (it *tableIterator) Value() []byte { return it.cur.Value }
+func (it *tableIterator) Entry() Entry  { return it.cur }
+func (it *tableIterator) Err() error    { return it.err }
+func (it *tableIterator) Close() error  { return nil }
+
+// sliceIterator ide kroz niz zapisa sortiran po kljucu, verzije istog kljuca od najnovije
+type sliceIterator struct {
+	entries []Entry
+	pos     int
+	valid   bool
+}
+
+// NewSliceIterator pravi iterator nad nizom zapisa koji je vec sortiran po kljucu (pa po Seq opadajuce)
+func NewSliceIterator(entries []Entry) InternalIterator {
+	return &sliceIterator{entries: entries}
+}
+
+func (it *sliceIterator) setPos(pos int) {
+	it.pos = pos
+	it.valid = pos >= 0 && pos < len(it.entries)
+}
+
+func (it *sliceIterator) Seek(key string) {
+	it.setPos(sort.Search(len(it.entries), func(i int) bool { return it.entries[i].Key >= key }))
+}
+
+func (it *sliceIterator) SeekToFirst() { it.setPos(0) }
+func (it *sliceIterator) SeekToLast()  { it.setPos(len(it.entries) - 1) }
+
+func (it *sliceIterator) Next() {
+	if it.valid {
+		it.setPos(it.pos + 1)
+	}
+}
+
+func (it *sliceIterator) Prev() {
+	if it.valid {
+		it.setPos(it.pos - 1)
+	}
+}
+
+func (it *sliceIterator) Valid() bool   { return it.valid }
+func (it *sliceIterator) Key() string   { return it.entries[it.pos].Key }
+func (it *sliceIterator) Value() []byte { return it.entries[it.pos].Value }
+func (it *sliceIterator) Entry() Entry  { return it.entries[it.pos] }
+func (it *sliceIterator) Err() error    { return nil }
+func (it *sliceIterator) Close() error  { return nil }
+
+// MergingIterator spaja vise InternalIterator-a: za svaki kljuc vraca verziju sa najvecim Seq koji nije veci od seq,
+// a kljuc cija je ta verzija tombstone (ili koji tada jos nije postojao) preskace
+//
+// Kada ide napred, svi ulazni iteratori su vec pomereni iza trenutnog kljuca, a kada ide nazad, ispred njega;
+// pri promeni smera ulazni iteratori se ponovo postavljaju oko trenutnog kljuca (kao u LevelDB)
+type mergingIterator struct {
+	children []InternalIterator
+	seq      uint64           // vidljive su samo verzije sa Seq <= seq
+	now      int64            // zapisi istekli do pravljenja iteratora se ne vide
+	dels     []RangeTombstone // brisanja opsega, vaze ona sa Seq <= seq
+	forward  bool
+	cur      Entry
+	valid    bool
+	err      error
+}
+
+// NewMergingIterator pravi pogled na bazu od iteratora Memtable-ova i tabela u trenutku seq; Close zatvara i njih
+// dels su brisanja opsega iz istih Memtable-ova i tabela
+func NewMergingIterator(children []InternalIterator, seq uint64, dels []RangeTombstone) Iterator {
+	return &mergingIterator{children: children, seq: seq, now: time.Now().UnixNano(), dels: dels}
+}
+
+func (m *mergingIterator) SeekToFirst() {
+	for _, c := range m.children {
+		c.SeekToFirst()
+	}
+	m.forward = true
+	m.findNext()
+}
+
+func (m *mergingIterator) Seek(key string) {
+	for _, c := range m.children {
+		c.Seek(key)
+	}
+	m.forward = true
+	m.findNext()
+}
+
+func (m *mergingIterator) SeekToLast() {
+	for _, c := range m.children {
+		c.SeekToLast()
+	}
+	m.forward = false
+	m.findPrev()
+}
+
+func (m *mergingIterator) Next() {
+	if !m.valid {
+		return
+	}
+	if !m.forward {
+		// ulazni iteratori su ispred trenutnog kljuca, pomeramo ih na prvi kljuc posle njega
+		for _, c := range m.children {
+			c.Seek(m.cur.Key)
+			for c.Valid() && c.Key() == m.cur.Key {
+				c.Next()
+			}
+		}
+		m.forward = true
+	}
+	m.findNext()
+}
+
+func (m *mergingIterator) Prev() {
+	if !m.valid {
+		return
+	}
+	if m.forward {
+		// ulazni iteratori su iza trenutnog kljuca, pomeramo ih na poslednji kljuc pre njega
+		for _, c := range m.children {
+			c.Seek(m.cur.Key)
+			if c.Valid() {
+				c.Prev()
+			} else {
+				c.SeekToLast()
+			}
+		}
+		m.forward = false
+	}
+	m.findPrev()
+}
+
+// findNext uzima najmanji kljuc medju ulaznim iteratorima, pomera sve koji su na njemu
+// i staje na prvom kljucu cija je najnovija verzija ziva (live)
+func (m *mergingIterator) findNext() {
+	for {
+		key, ok := m.pick(func(a, b string) bool { return a < b })
+		if !ok {
+			return
+		}
+		newest, ok := m.newestAt(key, InternalIterator.Next)
+		if ok && m.live(newest) {
+			m.cur, m.valid = newest, true
+			return
+		}
+	}
+}
+
+// findPrev je isto sto i findNext, samo unazad
+func (m *mergingIterator) findPrev() {
+	for {
+		key, ok := m.pick(func(a, b string) bool { return a > b })
+		if !ok {
+			return
+		}
+		newest, ok := m.newestAt(key, InternalIterator.Prev)
+		if ok && m.live(newest) {
+			m.cur, m.valid = newest, true
+			return
+		}
+	}
+}
+
+// live kaze da li se najnovija vidljiva verzija kljuca vidi: nije tombstone, nije istekla i ne pokriva je brisanje opsega
+func (m *mergingIterator) live(newest Entry) bool {
+	if newest.Tombstone || newest.Expired(m.now) {
+		return false
+	}
+	_, covered := CoveringTombstone(m.dels, newest.Key, newest.Seq, m.seq)
+	return !covered
+}
+
+// pick vraca kljuc koji je prvi po redosledu before medju ulaznim iteratorima
+func (m *mergingIterator) pick(before func(a, b string) bool) (string, bool) {
+	m.valid = false
+	var key string
+	found := false
+	for _, c := range m.children {
+		if err := c.Err(); err != nil {
+			m.err = err
+			return "", false
+		}
+		if c.Valid() && (!found || before(c.Key(), key)) {
+			key, found = c.Key(), true
+		}
+	}
+	return key, found
+}
+
+// newestAt vraca najnoviju vidljivu verziju kljuca i pomera (move) sve ulazne iteratore iza svih njegovih verzija
+// false - kljuc nema nijednu verziju sa Seq <= m.seq
+func (m *mergingIterator) newestAt(key string, move func(InternalIterator)) (Entry, bool) {
+	var newest Entry
+	found := false
+	for _, c := range m.children {
+		for c.Valid() && c.Key() == key {
+			if e := c.Entry(); e.Seq <= m.seq && (!found || e.Seq > newest.Seq) {
+				newest, found = e, true
+			}
+			move(c)
+		}
+	}
+	return newest, found
+}
+
+func (m *mergingIterator) Valid() bool   { return m.valid }
+func (m *mergingIterator) Key() string   { return m.cur.Key }
+func (m *mergingIterator) Value() []byte { return m.cur.Value }
+func (m *mergingIterator) Err() error    { return m.err }
+
+func (m *mergingIterator) Close() error {
+	for _, c := range m.children {
+		if err := c.Close(); err != nil && m.err == nil {
+			m.err = err
+		}
+	}
+	m.valid = false
+	return m.err
+}
+
+// iterHeap je min-heap iteratora po trenutnom kljucu, a za isti kljuc po najvecem Seq
+type iterHeap []InternalIterator
+
+func (h iterHeap) Len() int { return len(h) }
+
+func (h iterHeap) Less(i, j int) bool {
+	a, b := h[i].Entry(), h[j].Entry()
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.Seq > b.Seq
+}
+
+func (h iterHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *iterHeap) Push(x any) { *h = append(*h, x.(InternalIterator)) }
+
+func (h *iterHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
+
+// mergeIterator je k-way merge za kompakciju: samo unapred, vraca sve verzije i tombstone-e
+// za isti kljuc prvo daje verziju sa najvecim Seq, pa je prva verzija kljuca uvek najnovija
+type mergeIterator struct {
+	heap    iterHeap
+	current InternalIterator // iterator ciji je zapis poslednji vracen, pomera se pri sledecem next
+	err     error
+}
+
+// newMergeIterator pravi mergeIterator od iteratora koji su vec postavljeni (Seek/SeekToFirst)
+func newMergeIterator(iters []InternalIterator) *mergeIterator {
+	m := &mergeIterator{}
+	for _, it := range iters {
+		if it.Valid() {
+			m.heap = append(m.heap, it)
+		} else if err := it.Err(); err != nil && m.err == nil {
+			m.err = err
+		}
+	}
+	heap.Init(&m.heap)
+	return m
+}
+
+func (m *mergeIterator) next() bool {
+	if m.err != nil {
+		return false
+	}
+	if m.current != nil {
+		m.current.Next()
+		if m.current.Valid() {
+			heap.Fix(&m.heap, 0)
+		} else {
+			heap.Pop(&m.heap)
+			if err := m.current.Err(); err != nil {
+				m.err = err
+				return false
+			}
+		}
+		m.current = nil
+	}
+	if len(m.heap) == 0 {
+		return false
+	}
+	m.current = m.heap[0]
+	return true
+}
+
+func (m *mergeIterator) entry() Entry {
+	return m.current.Entry()
+}
+
+func (m *mergeIterator) error() error {
+	return m.err
+}
+
+// mergeTables pravi mergeIterator nad svim zapisima datih tabela
+func mergeTables(m *Manifest, tables []TableMeta, bm *blockmanager.BlockManager) *mergeIterator {
+	iters := make([]InternalIterator, 0, len(tables))
+	for _, t := range tables {
+		// tabela samo sa brisanjima opsega nema data fajl
+		if t.Count == 0 {
+			continue
+		}
+		it := newTableIterator(m, t, bm)
+		it.SeekToFirst()
+		iters = append(iters, it)
+	}
+	return newMergeIterator(iters)
+}
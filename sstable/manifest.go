@@ -0,0 +1,757 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Manifest je izvor istine o tome koje SSTable postoje, na kom su nivou i koji opseg kljuceva pokrivaju
+// Na disku je to append-only log izmena (VersionEdit) u fajlu MANIFEST-xxxxxx,
+// a fajl CURRENT sadrzi ime manifest fajla koji je trenutno aktivan
+//
+// jedan zapis u manifest fajlu: CRC(4)|LEN(4)|JSON(VersionEdit)
+// ako je poslednji zapis nepotpun (pad usred pisanja) on se ignorise
+
+const (
+	currentFileName  = "CURRENT"
+	manifestPrefix   = "MANIFEST-"
+	manifestMaxEdits = 1000 // posle ovoliko izmena manifest se prepisuje u novi fajl
+)
+
+// TableMeta opisuje jednu SSTable u manifestu
+type TableMeta struct {
+	Name       string `json:"name"` // ime foldera unutar sstable direktorijuma
+	Level      int    `json:"level"`
+	MinKey     string `json:"min_key"`
+	MaxKey     string `json:"max_key"`
+	Count      int64  `json:"count"`
+	CreatedSeq uint64 `json:"created_seq"`      // redni broj kreiranja, veci broj znaci novija tabela
+	Format     int    `json:"format,omitempty"` // verzija formata tabele (TableFormatVersion), 0 - stari format
+	Size       int64  `json:"size,omitempty"`   // ukupna velicina fajlova tabele u bajtovima (stari manifesti je nemaju)
+
+	RangeDels []RangeTombstone `json:"range_dels,omitempty"` // brisanja opsega iz rangedel fajla tabele
+}
+
+// VersionEdit je jedna izmena stanja - tabele koje su dodate i tabele koje su uklonjene
+// izmena se primenjuje atomski, npr. kod kompakcije nova tabela i brisanje starih idu u isti zapis
+type VersionEdit struct {
+	Added   []TableMeta `json:"added,omitempty"`
+	Removed []string    `json:"removed,omitempty"`
+	NextSeq uint64      `json:"next_seq,omitempty"`
+	// poslednji dodeljen redni broj upisa (Entry.Seq), da bi posle restarta brojanje nastavilo od njega
+	LastSequence uint64 `json:"last_sequence,omitempty"`
+}
+
+type Manifest struct {
+	dir     string
+	mu      sync.RWMutex
+	tables  map[string]TableMeta // ime foldera -> opis tabele
+	nextSeq uint64
+	lastSeq uint64   // poslednji redni broj upisa koji je sigurno u nekoj tabeli
+	file    *os.File // trenutni manifest fajl, otvoren za dopisivanje
+	fileNum int
+	edits   int // broj izmena u trenutnom fajlu
+
+	// tabele koje je neka izmena izbacila iz manifesta; folder moze da ostane na disku ako baza padne pre brisanja,
+	// pa ga removeLeftovers pri otvaranju brise (a rotate ih prepisuje u novi manifest dok folder postoji)
+	removed map[string]bool
+
+	// filesMu cuva fajlove tabela dok se citaju: citaoci drze RLock od uzimanja spiska tabela do kraja citanja,
+	// a brisanje tabela posle kompakcije ceka na Lock, pa nijedan citalac ne ostane bez fajla koji je video u spisku
+	filesMu sync.RWMutex
+	// kompakcije nivoa drze RLock i mogu da rade paralelno (svaka na svom nivou, vidi busyLevels),
+	// a kompakcija svih tabela (CompactSSTables) drzi Lock i radi sama
+	compactMu sync.RWMutex
+	// nivoi koje neka kompakcija upravo kompaktira, da dve ne bi uzele iste ulazne tabele
+	busyMu     sync.Mutex
+	busyLevels map[int]bool
+	// za svaki nivo najveci kljuc tabele koja je poslednja kompaktirana, sledeca kompakcija nastavlja posle njega
+	compactPointer map[int]string
+	// tabele koje drze otvoreni iteratori (ime -> broj iteratora); tabela koju kompakcija izbaci
+	// dok je neko drzi ostaje na disku (obsolete) dok je poslednji iterator ne pusti
+	pinMu    sync.Mutex
+	pinned   map[string]int
+	obsolete map[string]bool
+	// zivi snapshot-ovi (redni broj upisa -> broj snapshot-ova na njemu), kompakcija cuva verzije koje oni vide
+	snapMu    sync.Mutex
+	snapshots map[uint64]int
+	// kompakcija je mozda izbacila verzije koje vidi citanje na rednom broju manjem od ovoga (cuva se pod snapMu)
+	compactedSeq uint64
+}
+
+// OpenManifest ucitava manifest iz sstable direktorijuma
+// ako manifest ne postoji (stara baza), pravi se novi od SSTable foldera koji su na disku
+func OpenManifest(dir string, bm *blockmanager.BlockManager) (*Manifest, error) {
+	m := &Manifest{
+		dir:     dir,
+		tables:  make(map[string]TableMeta),
+		removed: make(map[string]bool),
+		nextSeq: 1,
+	}
+
+	current, err := os.ReadFile(filepath.Join(dir, currentFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("ne mogu da procitam CURRENT: %v", err)
+		}
+		if err := m.bootstrap(bm); err != nil {
+			return nil, err
+		}
+	} else {
+		name := strings.TrimSpace(string(current))
+		// neispravan CURRENT ne sme tiho da izabere neki drugi manifest (npr. MANIFEST-000000)
+		m.fileNum, err = strconv.Atoi(strings.TrimPrefix(name, manifestPrefix))
+		if err != nil || m.fileNum <= 0 {
+			return nil, fmt.Errorf("neispravan sadrzaj CURRENT fajla: %q", name)
+		}
+		if err := m.replay(filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	// tabelu u formatu koji ne citamo ne smemo ni da preskocimo (nestali bi podaci) ni da citamo pogresno
+	for name, t := range m.tables {
+		if t.Format > TableFormatVersion {
+			return nil, unsupportedTableError(name, fmt.Errorf("%w (format %d, podrzan je %d)", ErrUnsupportedFormat, t.Format, TableFormatVersion))
+		}
+	}
+
+	m.removeLeftovers()
+
+	// stari manifesti ne cuvaju velicinu tabele, a ona je potrebna za ciljnu velicinu nivoa
+	for name, t := range m.tables {
+		if t.Size == 0 {
+			t.Size = tableSize(m.TablePath(name))
+			m.tables[name] = t
+		}
+	}
+
+	// pri svakom otvaranju prepisujemo stanje u novi manifest fajl,
+	// tako se odbacuje eventualni nepotpuni zapis sa kraja i log ne raste beskonacno
+	if err := m.rotate(); err != nil {
+		return nil, err
+	}
+
+	if err := m.upgradeLegacyTables(bm); err != nil {
+		m.Close()
+		return nil, err
+	}
+	// ne znamo dokle su kompakcije pre otvaranja izbacivale verzije
+	m.compactedSeq = m.lastSeq
+	return m, nil
+}
+
+// tabele u starom formatu (jedan zapis po bloku) se jednom prepisuju u trenutni format
+// nova tabela zadrzava nivo i redni broj kreiranja stare, pa redosled pretrage ostaje isti
+// zamena ide kroz manifest kao kod kompakcije: ako se padne usred prepisivanja, stara tabela ostaje vazeca
+func (m *Manifest) upgradeLegacyTables(bm *blockmanager.BlockManager) error {
+	for _, t := range m.Tables() {
+		if t.Format != 0 {
+			continue
+		}
+		entries, err := readLegacyDataFile(filepath.Join(m.TablePath(t.Name), "data"), int(t.Count), bm)
+		if err != nil {
+			return fmt.Errorf("ne mogu da procitam SSTable %s u starom formatu: %v", t.Name, err)
+		}
+		sort.Sort(byKey(entries))
+
+		out := newCompactionOutput(m, t.Level, 0, []TableMeta{t}, bm)
+		for _, entry := range entries {
+			if err := out.add(entry); err != nil {
+				out.abort()
+				return fmt.Errorf("ne mogu da prepisem SSTable %s u novi format: %v", t.Name, err)
+			}
+		}
+		added, err := out.finish()
+		if err != nil {
+			out.abort()
+			return fmt.Errorf("ne mogu da prepisem SSTable %s u novi format: %v", t.Name, err)
+		}
+		for i := range added {
+			added[i].CreatedSeq = t.CreatedSeq
+		}
+		if err := replaceTables(m, []TableMeta{t}, added); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cita sve izmene iz manifest fajla i primenjuje ih redom
+func (m *Manifest) replay(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("ne mogu da procitam manifest %s: %v", path, err)
+	}
+
+	pos := 0
+	for pos+8 <= len(data) {
+		crc := binary.LittleEndian.Uint32(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		if pos+8+length > len(data) {
+			break // nepotpun zapis na kraju
+		}
+		payload := data[pos+8 : pos+8+length]
+		if crc32.ChecksumIEEE(payload) != crc {
+			break
+		}
+
+		var edit VersionEdit
+		if err := json.Unmarshal(payload, &edit); err != nil {
+			return fmt.Errorf("ostecen zapis u manifestu: %v", err)
+		}
+		m.applyInMemory(edit)
+		pos += 8 + length
+	}
+	return nil
+}
+
+// pravi pocetno stanje od SSTable foldera koji postoje na disku
+// redosled kreiranja se uzima iz vremena u imenu foldera (sstable_L<nivo>_<vreme>)
+func (m *Manifest) bootstrap(bm *blockmanager.BlockManager) error {
+	files, err := os.ReadDir(m.dir)
+	if err != nil {
+		return fmt.Errorf("ne mogu da procitam sstable direktorijum: %v", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		if f.IsDir() && strings.HasPrefix(f.Name(), "sstable_") && !strings.HasSuffix(f.Name(), tmpSuffix) {
+			names = append(names, f.Name())
+		}
+	}
+
+	createdAt := func(name string) int64 {
+		parts := strings.Split(name, "_")
+		n, _ := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+		return n
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return createdAt(names[i]) < createdAt(names[j])
+	})
+
+	for _, name := range names {
+		meta, err := ReadTableInfo(filepath.Join(m.dir, name), bm)
+		if errors.Is(err, ErrUnsupportedFormat) {
+			return unsupportedTableError(name, err)
+		}
+		if err != nil {
+			fmt.Printf(" Preskacem SSTable %s: %v\n", name, err)
+			continue
+		}
+		meta.Name = name
+		meta.Level = ExtractLevelFromFolder(name)
+		meta.CreatedSeq = m.nextSeq
+		m.nextSeq++
+		m.tables[name] = meta
+
+		// stara baza nema zabelezen poslednji redni broj upisa, pa se uzima najveci iz tabela
+		read := ReadDataFileWithBlocks
+		if meta.Format == 0 {
+			read = readLegacyDataFile
+		}
+		entries, err := read(filepath.Join(m.dir, name, "data"), int(meta.Count), bm)
+		if err == nil {
+			for _, e := range entries {
+				if e.Seq > m.lastSeq {
+					m.lastSeq = e.Seq
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// upisuje kompletno stanje u novi manifest fajl i prebacuje CURRENT na njega
+func (m *Manifest) rotate() error {
+	oldFile := m.file
+	oldPath := ""
+	if m.fileNum > 0 {
+		oldPath = filepath.Join(m.dir, fmt.Sprintf("%s%06d", manifestPrefix, m.fileNum))
+	}
+
+	m.fileNum++
+	name := fmt.Sprintf("%s%06d", manifestPrefix, m.fileNum)
+	f, err := os.OpenFile(filepath.Join(m.dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("ne mogu da napravim manifest: %v", err)
+	}
+
+	snapshot := VersionEdit{NextSeq: m.nextSeq, LastSequence: m.lastSeq}
+	for _, t := range m.tables {
+		snapshot.Added = append(snapshot.Added, t)
+	}
+	for name := range m.removed {
+		// kada folder vise ne postoji, istorija o izbacenoj tabeli nije potrebna
+		if _, err := os.Stat(m.TablePath(name)); os.IsNotExist(err) {
+			delete(m.removed, name)
+			continue
+		}
+		snapshot.Removed = append(snapshot.Removed, name)
+	}
+	if err := writeEdit(f, snapshot); err != nil {
+		f.Close()
+		return err
+	}
+
+	// CURRENT se menja preko privremenog fajla i rename-a da bi promena bila atomska
+	if err := writeFileAtomic(filepath.Join(m.dir, currentFileName), []byte(name+"\n")); err != nil {
+		f.Close()
+		return fmt.Errorf("ne mogu da azuriram CURRENT: %v", err)
+	}
+
+	m.file = f
+	m.edits = 1
+	if oldFile != nil {
+		oldFile.Close()
+	}
+	if oldPath != "" {
+		os.Remove(oldPath)
+	}
+	return nil
+}
+
+// upisuje jedan zapis u manifest i radi fsync
+func writeEdit(f *os.File, edit VersionEdit) error {
+	payload, err := json.Marshal(edit)
+	if err != nil {
+		return fmt.Errorf("ne mogu da serijalizujem izmenu manifesta: %v", err)
+	}
+
+	buf := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	buf = append(buf, payload...)
+
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("ne mogu da upisem u manifest: %v", err)
+	}
+	return f.Sync()
+}
+
+func (m *Manifest) applyInMemory(edit VersionEdit) {
+	for _, name := range edit.Removed {
+		delete(m.tables, name)
+		m.removed[name] = true
+	}
+	for _, t := range edit.Added {
+		m.tables[t.Name] = t
+		delete(m.removed, t.Name)
+	}
+	if edit.NextSeq > m.nextSeq {
+		m.nextSeq = edit.NextSeq
+	}
+	if edit.LastSequence > m.lastSeq {
+		m.lastSeq = edit.LastSequence
+	}
+}
+
+// Apply trajno upisuje izmenu u manifest i tek onda je primenjuje u memoriji
+func (m *Manifest) Apply(edit VersionEdit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	edit.NextSeq = m.nextSeq
+	if err := writeEdit(m.file, edit); err != nil {
+		return err
+	}
+	m.applyInMemory(edit)
+	m.edits++
+
+	if m.edits >= manifestMaxEdits {
+		return m.rotate()
+	}
+	return nil
+}
+
+// NewTableName rezervise ime za novu SSTable na datom nivou i vraca njen redni broj kreiranja
+func (m *Manifest) NewTableName(level int) (string, uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		seq := m.nextSeq
+		m.nextSeq++
+		name := fmt.Sprintf("sstable_L%d_%d", level, seq)
+		// folder sa tim imenom moze da ostane od prekinutog upisa, njega ne diramo
+		if _, err := os.Stat(filepath.Join(m.dir, name)); !os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(m.TempTablePath(name)); os.IsNotExist(err) {
+			return name, seq
+		}
+	}
+}
+
+// Tables vraca sve tabele u redosledu pretrage: nivo po nivo, a unutar nivoa od najnovije ka najstarijoj
+func (m *Manifest) Tables() []TableMeta {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]TableMeta, 0, len(m.tables))
+	for _, t := range m.tables {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Level != result[j].Level {
+			return result[i].Level < result[j].Level
+		}
+		return result[i].CreatedSeq > result[j].CreatedSeq
+	})
+	return result
+}
+
+// LevelTables vraca tabele na jednom nivou, od najnovije ka najstarijoj
+func (m *Manifest) LevelTables(level int) []TableMeta {
+	var result []TableMeta
+	for _, t := range m.Tables() {
+		if t.Level == level {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// reserveLevels oznacava nivo i nivo ispod njega kao zauzete (kompakcija cita oba i menja oba),
+// vraca false ako bilo koji od njih vec kompaktira neko drugi
+func (m *Manifest) reserveLevels(level int) bool {
+	m.busyMu.Lock()
+	defer m.busyMu.Unlock()
+	if m.busyLevels == nil {
+		m.busyLevels = make(map[int]bool)
+	}
+	if m.busyLevels[level] || m.busyLevels[level+1] {
+		return false
+	}
+	m.busyLevels[level] = true
+	m.busyLevels[level+1] = true
+	return true
+}
+
+func (m *Manifest) releaseLevels(level int) {
+	m.busyMu.Lock()
+	defer m.busyMu.Unlock()
+	delete(m.busyLevels, level)
+	delete(m.busyLevels, level+1)
+}
+
+func (m *Manifest) levelsBusy(level int) bool {
+	m.busyMu.Lock()
+	defer m.busyMu.Unlock()
+	return m.busyLevels[level] || m.busyLevels[level+1]
+}
+
+func (m *Manifest) getCompactPointer(level int) string {
+	m.busyMu.Lock()
+	defer m.busyMu.Unlock()
+	return m.compactPointer[level]
+}
+
+func (m *Manifest) setCompactPointer(level int, key string) {
+	m.busyMu.Lock()
+	defer m.busyMu.Unlock()
+	if m.compactPointer == nil {
+		m.compactPointer = make(map[int]string)
+	}
+	m.compactPointer[level] = key
+}
+
+// RLockFiles zabranjuje brisanje fajlova tabela dok citalac ne pozove RUnlockFiles
+func (m *Manifest) RLockFiles() {
+	m.filesMu.RLock()
+}
+
+func (m *Manifest) RUnlockFiles() {
+	m.filesMu.RUnlock()
+}
+
+// PinTables vraca trenutni spisak tabela i cuva njihove fajlove dok se ne pozove UnpinTables
+// za iteratore koji zive duze od jednog citanja, RLockFiles bi za to vreme zaustavio kompakciju
+func (m *Manifest) PinTables() []TableMeta {
+	m.filesMu.RLock()
+	defer m.filesMu.RUnlock()
+
+	tables := m.Tables()
+	m.pinMu.Lock()
+	defer m.pinMu.Unlock()
+	if m.pinned == nil {
+		m.pinned = make(map[string]int)
+	}
+	for _, t := range tables {
+		m.pinned[t.Name]++
+	}
+	return tables
+}
+
+// UnpinTables pusta tabele dobijene od PinTables; tabele koje je kompakcija u medjuvremenu izbacila tek se sada brisu
+func (m *Manifest) UnpinTables(tables []TableMeta) {
+	var remove []string
+	m.pinMu.Lock()
+	for _, t := range tables {
+		m.pinned[t.Name]--
+		if m.pinned[t.Name] > 0 {
+			continue
+		}
+		delete(m.pinned, t.Name)
+		if m.obsolete[t.Name] {
+			delete(m.obsolete, t.Name)
+			remove = append(remove, t.Name)
+		}
+	}
+	m.pinMu.Unlock()
+	if len(remove) == 0 {
+		return
+	}
+
+	m.filesMu.Lock()
+	defer m.filesMu.Unlock()
+	for _, name := range remove {
+		m.removeTableFiles(name)
+	}
+}
+
+// removeTableFiles brise folder tabele koja vise nije u manifestu; ako je drzi neki iterator,
+// brisanje se odlaze do UnpinTables. pozivalac drzi filesMu.Lock
+func (m *Manifest) removeTableFiles(name string) {
+	m.pinMu.Lock()
+	if m.pinned[name] > 0 {
+		if m.obsolete == nil {
+			m.obsolete = make(map[string]bool)
+		}
+		m.obsolete[name] = true
+		m.pinMu.Unlock()
+		return
+	}
+	m.pinMu.Unlock()
+
+	fullPath := m.TablePath(name)
+	ForgetFilter(fullPath)
+	if err := os.RemoveAll(fullPath); err != nil {
+		fmt.Printf(" Ne mogu da obrišem %s: %v\n", fullPath, err)
+	}
+}
+
+// AcquireSnapshot belezi snapshot na rednom broju upisa seq; dok se ne pozove ReleaseSnapshot,
+// kompakcija ne izbacuje verzije koje on vidi
+func (m *Manifest) AcquireSnapshot(seq uint64) {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+	if m.snapshots == nil {
+		m.snapshots = make(map[uint64]int)
+	}
+	m.snapshots[seq]++
+}
+
+// ReleaseSnapshot pusta snapshot zabelezen sa AcquireSnapshot
+func (m *Manifest) ReleaseSnapshot(seq uint64) {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+	m.snapshots[seq]--
+	if m.snapshots[seq] <= 0 {
+		delete(m.snapshots, seq)
+	}
+}
+
+// AcquireSnapshotAt je AcquireSnapshot za stariji redni broj upisa (npr. iz tokena skeniranja)
+// vraca false, bez belezenja, ako je neka kompakcija mozda vec izbacila verzije koje snapshot na seq vidi
+func (m *Manifest) AcquireSnapshotAt(seq uint64) bool {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+	if seq < m.compactedSeq {
+		return false
+	}
+	if m.snapshots == nil {
+		m.snapshots = make(map[uint64]int)
+	}
+	m.snapshots[seq]++
+	return true
+}
+
+// oldestSnapshot vraca redni broj najstarijeg zivog snapshot-a, a math.MaxUint64 ako ih nema
+// poziva ga kompakcija: verzije koje vide samo citanja pre tog broja (ili pre poslednjeg upisa, ako snapshot-ova nema)
+// mogu da se izbace, pa se to pamti u compactedSeq
+func (m *Manifest) oldestSnapshot() uint64 {
+	lastSeq := m.LastSequence()
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+	oldest := uint64(math.MaxUint64)
+	for seq := range m.snapshots {
+		if seq < oldest {
+			oldest = seq
+		}
+	}
+	if horizon := min(oldest, lastSeq); horizon > m.compactedSeq {
+		m.compactedSeq = horizon
+	}
+	return oldest
+}
+
+// LastSequence vraca poslednji redni broj upisa zabelezen u manifestu
+func (m *Manifest) LastSequence() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastSeq
+}
+
+// Dir vraca sstable direktorijum kojim manifest upravlja
+func (m *Manifest) Dir() string {
+	return m.dir
+}
+
+// TablePath vraca punu putanju do foldera tabele
+func (m *Manifest) TablePath(name string) string {
+	return filepath.Join(m.dir, name)
+}
+
+// Contains proverava da li kljuc moze biti u tabeli na osnovu njenog opsega kljuceva
+func (t TableMeta) Contains(key string) bool {
+	return t.Count > 0 && key >= t.MinKey && key <= t.MaxKey
+}
+
+// Overlaps proverava da li se opseg tabele sece sa opsegom [from, to]
+func (t TableMeta) Overlaps(from, to string) bool {
+	return t.Count > 0 && t.MaxKey >= from && t.MinKey <= to
+}
+
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.file == nil {
+		return nil
+	}
+	err := m.file.Close()
+	m.file = nil
+	return err
+}
+
+// Format tabele
+// meta fajl pocinje oznakom i verzijom formata, pa se tabela iz druge verzije baze prepoznaje umesto da se pogresno procita
+// meta: MAGIC(4)|VERZIJA(4)|BROJ_ZAPISA(8)|KEYSIZE|MINKEY|KEYSIZE|MAXKEY|[BROJ_BRISANJA_OPSEGA(8)]
+// stare tabele (jedan zapis po bloku) imaju meta bez oznake, one su format 0 i pri otvaranju se prepisuju u trenutni format
+const (
+	metaMagic = "SSTM"
+	// TableFormatVersion je verzija formata koju pise ova verzija baze:
+	// 1 - vise zapisa po bloku sa deljenim prefiksom kljuceva (block.go), zapis moze da se prostire kroz vise blokova
+	TableFormatVersion = 1
+)
+
+// ErrUnsupportedFormat se vraca za tabelu ciji format ova verzija baze ne cita (tabela iz novije verzije)
+var ErrUnsupportedFormat = errors.New("SSTable je u formatu koji ova verzija baze ne cita")
+
+func unsupportedTableError(name string, err error) error {
+	return fmt.Errorf("ne mogu da otvorim bazu, SSTable %s: %w; podatke treba izvesti verzijom baze koja ih je napisala", name, err)
+}
+
+// encodeMeta pravi sadrzaj meta fajla, broj brisanja opsega se upisuje samo za tabele koje ih imaju
+func encodeMeta(count int64, minKey, maxKey string, rangeDels int) []byte {
+	meta := binary.LittleEndian.AppendUint32([]byte(metaMagic), TableFormatVersion)
+	meta = binary.LittleEndian.AppendUint64(meta, uint64(count))
+	for _, key := range []string{minKey, maxKey} {
+		meta = binary.LittleEndian.AppendUint64(meta, uint64(len(key)))
+		meta = append(meta, key...)
+	}
+	if rangeDels > 0 {
+		meta = binary.LittleEndian.AppendUint64(meta, uint64(rangeDels))
+	}
+	return meta
+}
+
+// decodeMeta cita meta fajl i vraca opis tabele (bez imena i nivoa) i broj brisanja opsega u rangedel fajlu
+// za stari meta (samo broj zapisa, bez oznake) vraca format 0, opseg kljuceva tada treba procitati iz data fajla
+func decodeMeta(data []byte) (TableMeta, int, error) {
+	if len(data) < 8 {
+		return TableMeta{}, 0, fmt.Errorf("meta fajl je prekratak")
+	}
+	if string(data[0:4]) != metaMagic {
+		return TableMeta{Count: int64(binary.LittleEndian.Uint64(data[0:8]))}, 0, nil
+	}
+	version := int(binary.LittleEndian.Uint32(data[4:8]))
+	if version != TableFormatVersion {
+		return TableMeta{}, 0, fmt.Errorf("%w (format %d, podrzan je %d)", ErrUnsupportedFormat, version, TableFormatVersion)
+	}
+	if len(data) < 16 {
+		return TableMeta{}, 0, fmt.Errorf("meta fajl je prekratak")
+	}
+
+	meta := TableMeta{Count: int64(binary.LittleEndian.Uint64(data[8:16])), Format: version}
+	minKey, rest, err := readSizedString(data[16:])
+	if err != nil {
+		return TableMeta{}, 0, err
+	}
+	maxKey, rest, err := readSizedString(rest)
+	if err != nil {
+		return TableMeta{}, 0, err
+	}
+	meta.MinKey, meta.MaxKey = minKey, maxKey
+	rangeDels := 0
+	if len(rest) >= 8 {
+		rangeDels = int(binary.LittleEndian.Uint64(rest[0:8]))
+	}
+	return meta, rangeDels, nil
+}
+
+// ReadTableInfo cita broj zapisa i opseg kljuceva tabele iz meta fajla
+// za tabelu u formatu koji ova verzija ne cita vraca ErrUnsupportedFormat
+func ReadTableInfo(dirPath string, bm *blockmanager.BlockManager) (TableMeta, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, "meta"))
+	if err != nil {
+		return TableMeta{}, fmt.Errorf("ne mogu da procitam meta fajl: %v", err)
+	}
+	meta, rangeDels, err := decodeMeta(data)
+	if err != nil {
+		return TableMeta{}, err
+	}
+	meta.Size = tableSize(dirPath)
+	if rangeDels > 0 {
+		if meta.RangeDels, err = readRangeDelFile(filepath.Join(dirPath, "rangedel"), rangeDels, bm); err != nil {
+			return TableMeta{}, err
+		}
+	}
+	if meta.Format == 0 && meta.Count > 0 {
+		entries, err := readLegacyDataFile(filepath.Join(dirPath, "data"), int(meta.Count), bm)
+		if err != nil {
+			return TableMeta{}, err
+		}
+		meta.MinKey, meta.MaxKey = entries[0].Key, entries[len(entries)-1].Key
+	}
+	return meta, nil
+}
+
+// tableSize sabira velicine svih fajlova u folderu tabele
+func tableSize(dirPath string) int64 {
+	files, err := os.ReadDir(dirPath)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, f := range files {
+		if info, err := f.Info(); err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// cita KEYSIZE|KEY i vraca ostatak bafera
+func readSizedString(data []byte) (string, []byte, error) {
+	if len(data) < 8 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	size := binary.LittleEndian.Uint64(data[0:8])
+	if uint64(len(data)-8) < size {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(data[8 : 8+size]), data[8+size:], nil
+}
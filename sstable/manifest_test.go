@@ -0,0 +1,127 @@
+package sstable
+
+import (
+	"fmt"
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func openTestManifest(t *testing.T, dir string) *Manifest {
+	t.Helper()
+	m, err := OpenManifest(dir, blockmanager.NewBlockManager(1, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func mustApply(t *testing.T, m *Manifest, edit VersionEdit) {
+	t.Helper()
+	if err := m.Apply(edit); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func manifestFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, manifestPrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// izmene ostaju posle ponovnog otvaranja, a brojanje imena tabela nastavlja od poslednjeg rezervisanog
+func TestManifestPersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestManifest(t, dir)
+
+	a := TableMeta{Name: "sstable_L0_1", Level: 0, MinKey: "a", MaxKey: "m", Count: 3, CreatedSeq: 1, Format: TableFormatVersion}
+	b := TableMeta{Name: "sstable_L1_2", Level: 1, MinKey: "n", MaxKey: "z", Count: 5, CreatedSeq: 2, Format: TableFormatVersion}
+	c := TableMeta{Name: "sstable_L0_3", Level: 0, MinKey: "b", MaxKey: "c", Count: 1, CreatedSeq: 3, Format: TableFormatVersion}
+	for i := 0; i < 3; i++ {
+		m.NewTableName(0)
+	}
+	mustApply(t, m, VersionEdit{Added: []TableMeta{a, b}})
+	mustApply(t, m, VersionEdit{Added: []TableMeta{c}, Removed: []string{a.Name}})
+	m.Close()
+
+	m = openTestManifest(t, dir)
+	if got, want := m.Tables(), []TableMeta{c, b}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("posle ponovnog otvaranja:\n%+v\nocekivano:\n%+v", got, want)
+	}
+	if name, seq := m.NewTableName(0); seq != 4 || name != "sstable_L0_4" {
+		t.Fatalf("NewTableName posle ponovnog otvaranja = %s, %d", name, seq)
+	}
+	if files := manifestFiles(t, dir); len(files) != 1 {
+		t.Fatalf("posle otvaranja treba da ostane jedan manifest fajl, ima ih %v", files)
+	}
+}
+
+// posle manifestMaxEdits izmena stanje se prepisuje u novi fajl, a stari se brise
+func TestManifestRotatesAfterMaxEdits(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestManifest(t, dir)
+	before := manifestFiles(t, dir)
+
+	for i := 1; i <= manifestMaxEdits; i++ {
+		meta := TableMeta{Name: fmt.Sprintf("sstable_L1_%d", i), Level: 1, Count: 1, CreatedSeq: uint64(i), Format: TableFormatVersion}
+		mustApply(t, m, VersionEdit{Added: []TableMeta{meta}})
+	}
+
+	after := manifestFiles(t, dir)
+	if len(after) != 1 || reflect.DeepEqual(before, after) {
+		t.Fatalf("manifest nije prepisan u novi fajl: pre %v, posle %v", before, after)
+	}
+	current, err := os.ReadFile(filepath.Join(dir, currentFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(current)) != filepath.Base(after[0]) {
+		t.Fatalf("CURRENT = %q, a manifest je %s", current, after[0])
+	}
+
+	tables := m.Tables()
+	m.Close()
+	m = openTestManifest(t, dir)
+	if got := m.Tables(); !reflect.DeepEqual(got, tables) {
+		t.Fatalf("posle rotacije i ponovnog otvaranja:\n%+v\nocekivano:\n%+v", got, tables)
+	}
+}
+
+// nepotpun zapis na kraju manifesta (pad usred upisa) se ignorise
+func TestManifestIgnoresTornTail(t *testing.T) {
+	dir := t.TempDir()
+	m := openTestManifest(t, dir)
+	meta := TableMeta{Name: "sstable_L0_1", MinKey: "a", MaxKey: "b", Count: 2, CreatedSeq: 1, Format: TableFormatVersion}
+	mustApply(t, m, VersionEdit{Added: []TableMeta{meta}})
+	m.Close()
+
+	f, err := os.OpenFile(manifestFiles(t, dir)[0], os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3, 4, 200, 0, 0, 0, '{'})
+	f.Close()
+
+	m = openTestManifest(t, dir)
+	if got := m.Tables(); !reflect.DeepEqual(got, []TableMeta{meta}) {
+		t.Fatalf("posle nepotpunog zapisa: %+v", got)
+	}
+}
+
+func TestManifestRejectsMalformedCurrent(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, currentFileName), []byte("MANIFEST-abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := OpenManifest(dir, blockmanager.NewBlockManager(1, 16)); err == nil {
+		m.Close()
+		t.Fatal("ocekivana greska za neispravan CURRENT")
+	}
+}
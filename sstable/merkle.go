@@ -13,21 +13,7 @@ func GenerateMerkleRoot(entries []Entry) []byte {
 	var hashes [][]byte
 
 	for _, e := range entries {
-		h := sha256.New()
-
-		h.Write([]byte(e.Key))
-		h.Write(e.Value)
-		if e.Tombstone {
-			h.Write([]byte{1})
-		} else {
-			h.Write([]byte{0})
-		}
-
-		tmp := make([]byte, 8)
-		binary.LittleEndian.PutUint64(tmp, e.Timestamp)
-		h.Write(tmp)
-
-		hashes = append(hashes, h.Sum(nil))
+		hashes = append(hashes, merkleLeaf(e))
 	}
 
 	for len(hashes) > 1 {
@@ -39,10 +25,7 @@ func GenerateMerkleRoot(entries []Entry) []byte {
 				break
 			}
 			//ako nije spajamo dva hasha
-			h := sha256.New()
-			h.Write(hashes[i])
-			h.Write(hashes[i+1])
-			newLevel = append(newLevel, h.Sum(nil))
+			newLevel = append(newLevel, merkleParent(hashes[i], hashes[i+1]))
 		}
 		hashes = newLevel
 	}
@@ -52,6 +35,33 @@ func GenerateMerkleRoot(entries []Entry) []byte {
 	return nil
 }
 
+// hash jednog zapisa (list merkle stabla)
+func merkleLeaf(e Entry) []byte {
+	h := sha256.New()
+
+	h.Write([]byte(e.Key))
+	h.Write(e.Value)
+	if e.Tombstone {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+
+	tmp := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tmp, e.Seq)
+	h.Write(tmp)
+
+	return h.Sum(nil)
+}
+
+// hash roditelja u merkle stablu
+func merkleParent(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
 func SaveMerkleRoot(root []byte, dirPath string) error {
 	f, err := os.Create(filepath.Join(dirPath, "merkle"))
 	if err != nil {
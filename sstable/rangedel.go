@@ -0,0 +1,135 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"napredni/blockmanager"
+	"path/filepath"
+	"sort"
+)
+
+// Brisanje opsega (range tombstone)
+// Jedan zapis brise sve verzije kljuceva iz [Start, End) koje su starije od njega (manji Seq), umesto tombstone-a po kljucu
+// Citanja ga primenjuju preko svih Memtable-ova i tabela (CoveringTombstone), pa nije bitno u kojoj tabeli se nalazi;
+// kompakcija izbacuje verzije koje pokriva, a sam zapis kada van nje vise nema tabela koje bi on sakrivao
+// U tabeli su brisanja opsega u posebnom fajlu rangedel (blokovi kao u data fajlu), a njihov broj je na kraju meta fajla
+//
+// zapis u rangedel fajlu: kljuc START, vrednost SEQ(8)|TIMESTAMP(8)|END
+
+// RangeTombstone je jedno brisanje opsega kljuceva
+type RangeTombstone struct {
+	Start     string `json:"start"`
+	End       string `json:"end,omitempty"` // prvi kljuc van opsega, "" - bez gornje granice
+	Seq       uint64 `json:"seq"`
+	Timestamp int64  `json:"timestamp,omitempty"` // vreme upisa (UnixNano)
+}
+
+// Contains kaze da li je kljuc u opsegu brisanja
+func (t RangeTombstone) Contains(key string) bool {
+	return key >= t.Start && (t.End == "" || key < t.End)
+}
+
+// Overlaps kaze da li opseg brisanja sece opseg kljuceva [minKey, maxKey]
+func (t RangeTombstone) Overlaps(minKey, maxKey string) bool {
+	return maxKey >= t.Start && (t.End == "" || minKey < t.End)
+}
+
+// CoveringTombstone vraca najnovije brisanje opsega koje sakriva verziju kljuca sa rednim brojem seq
+// gledaju se samo brisanja sa Seq <= limit (npr. snapshot)
+func CoveringTombstone(dels []RangeTombstone, key string, seq, limit uint64) (RangeTombstone, bool) {
+	var best RangeTombstone
+	found := false
+	for _, t := range dels {
+		if t.Seq > seq && t.Seq <= limit && t.Contains(key) && (!found || t.Seq > best.Seq) {
+			best, found = t, true
+		}
+	}
+	return best, found
+}
+
+// RangeTombstonesOf vraca sva brisanja opsega iz datih tabela
+func RangeTombstonesOf(tables []TableMeta) []RangeTombstone {
+	var dels []RangeTombstone
+	for _, t := range tables {
+		dels = append(dels, t.RangeDels...)
+	}
+	return dels
+}
+
+// RangeTombstones vraca sva brisanja opsega iz tabela u manifestu
+func (m *Manifest) RangeTombstones() []RangeTombstone {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var dels []RangeTombstone
+	for _, t := range m.tables {
+		dels = append(dels, t.RangeDels...)
+	}
+	return dels
+}
+
+func encodeRangeTombstone(t RangeTombstone) []byte {
+	buf := make([]byte, 16, 16+len(t.End))
+	binary.LittleEndian.PutUint64(buf[0:8], t.Seq)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(t.Timestamp))
+	return append(buf, t.End...)
+}
+
+func decodeRangeTombstone(be blockEntry) (RangeTombstone, error) {
+	if len(be.value) < 16 {
+		return RangeTombstone{}, fmt.Errorf("korumpirano brisanje opsega za kljuc %q", be.key)
+	}
+	return RangeTombstone{
+		Start:     be.key,
+		End:       string(be.value[16:]),
+		Seq:       binary.LittleEndian.Uint64(be.value[0:8]),
+		Timestamp: int64(binary.LittleEndian.Uint64(be.value[8:16])),
+	}, nil
+}
+
+// writeRangeDelFile upisuje brisanja opsega u rangedel fajl tabele, sortirana po pocetku opsega
+func writeRangeDelFile(dir string, dels []RangeTombstone, bm *blockmanager.BlockManager) error {
+	sorted := append([]RangeTombstone(nil), dels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].Seq > sorted[j].Seq
+	})
+
+	w := newBlockFileWriter(bm, filepath.Join(dir, "rangedel"))
+	for _, t := range sorted {
+		if _, err := w.add(t.Start, encodeRangeTombstone(t)); err != nil {
+			return fmt.Errorf("ne mogu da upisem rangedel fajl: %v", err)
+		}
+	}
+	if err := w.close(); err != nil {
+		return fmt.Errorf("ne mogu da upisem rangedel fajl: %v", err)
+	}
+	return nil
+}
+
+// readRangeDelFile cita n brisanja opsega iz rangedel fajla
+func readRangeDelFile(path string, n int, bm *blockmanager.BlockManager) ([]RangeTombstone, error) {
+	var dels []RangeTombstone
+	for blockNum := int64(0); len(dels) < n; {
+		data, next, err := readBlock(bm, path, blockNum)
+		if err != nil {
+			return nil, fmt.Errorf("greska pri citanju bloka: %v", err)
+		}
+
+		blockEntries, err := decodeBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("korumpiran blok %d: %v", blockNum, err)
+		}
+		for _, be := range blockEntries {
+			t, err := decodeRangeTombstone(be)
+			if err != nil {
+				return nil, err
+			}
+			dels = append(dels, t)
+		}
+		blockNum = next
+	}
+	return dels, nil
+}
@@ -4,28 +4,35 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"napredni/blockmanager"
-	"napredni/bloomfilter"
-	"napredni/config"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 // sadrzi binarne fajlove DATA, INDEX, SUMMARY, BLOOM I MERKLE
-// data fajl je binarni fajl koji sadrzi sve informacije TIMESTAMP|TOMBSTONE|KEYSIZE|VALUESIZE|KEY|VALUE
-// index fajl je dodatni fajl koji se pravi uz data i sadrzi kljuc i offset
-// summary fajl je sazetak index fajlq KEYSIZE|KEY|OFFSET
+// data, index i summary fajl su podeljeni na blokove, u jednom bloku je vise zapisa (format u block.go)
+// data fajl: kljuc -> SEQ|FLAGS|VALUE (FLAGS: tombstone, vreme upisa, vreme isteka, vidi encodeDataValue)
+// SEQ je globalni redni broj upisa (dodeljuje ga Engine), veci SEQ znaci novija verzija kljuca
+// index fajl je dodatni fajl koji se pravi uz data i sadrzi kljuc i poziciju zapisa u data fajlu (BLOK|POZICIJA)
+// summary fajl je sazetak index fajla, svaki N-ti kljuc i njegova pozicija u index fajlu
 
 type Entry struct {
 	Key       string
 	Value     []byte
 	Tombstone bool
-	Timestamp uint64
+	Seq       uint64 // redni broj upisa
+	Timestamp int64  // vreme upisa (UnixNano), 0 - nepoznato
+	ExpiresAt int64  // vreme isteka (UnixNano), 0 - ne istice
+}
+
+// Expired kaze da li je zapis istekao u trenutku now (UnixNano); istekao zapis se cita kao tombstone
+func (e Entry) Expired(now int64) bool {
+	return e.ExpiresAt != 0 && e.ExpiresAt <= now
 }
 
 // pomocne funkcije i strukture neophodne jer se koristi sort.Interface koji mora da ima funkcije LEN, SWAP, LESS u njima definisemo kako sortiramo podatke, u nasem slucaju je sve po kljucu
@@ -41,677 +48,474 @@ func (e byKey) Swap(i, j int) {
 	e[i], e[j] = e[j], e[i]
 }
 
+// verzije istog kljuca idu od najnovije ka najstarijoj
 func (e byKey) Less(i, j int) bool {
-	return e[i].Key < e[j].Key
+	if e[i].Key != e[j].Key {
+		return e[i].Key < e[j].Key
+	}
+	return e[i].Seq > e[j].Seq
 }
 
-// data fajl je jedini fajl sstable-a koji pisemo preko blokova
-func WriteDataFileWithBlocks(entries []Entry, path string, bm *blockmanager.BlockManager) error {
+// data fajl se pise preko blokova, vise zapisa u jednom bloku
+// vraca poziciju (blok i mesto u bloku) svakog zapisa, redom kako su sortirani
+func WriteDataFileWithBlocks(entries []Entry, path string, bm *blockmanager.BlockManager) ([]EntryPos, error) {
 	sort.Sort(byKey(entries))
 
-	for blockNum, entry := range entries {
-		keyBytes := []byte(entry.Key)
-		keySize := uint64(len(keyBytes))
-		valueSize := uint64(len(entry.Value))
-
-		tmp := make([]byte, 8)
-
-		buf := make([]byte, 0)
-
-		binary.LittleEndian.PutUint64(tmp, entry.Timestamp)
-		buf = append(buf, tmp...)
-
-		if entry.Tombstone {
-			buf = append(buf, byte(1))
-		} else {
-			buf = append(buf, byte(0))
+	w := newBlockFileWriter(bm, path)
+	positions := make([]EntryPos, 0, len(entries))
+	for _, entry := range entries {
+		pos, err := w.add(entry.Key, encodeDataValue(entry))
+		if err != nil {
+			return nil, err
 		}
+		positions = append(positions, pos)
+	}
 
-		binary.LittleEndian.PutUint64(tmp, keySize)
-		buf = append(buf, tmp...)
-
-		binary.LittleEndian.PutUint64(tmp, valueSize)
-		buf = append(buf, tmp...)
+	if err := w.close(); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
 
-		buf = append(buf, keyBytes...)
+// bitovi u bajtu FLAGS zapisa (tabele iz starijih verzija imaju samo 0 ili 1)
+const (
+	dataTombstone    = 1 << 0
+	dataHasTimestamp = 1 << 1 // posle FLAGS ide TIMESTAMP(8)
+	dataHasExpiry    = 1 << 2 // posle TIMESTAMP (ako ga ima) ide EXPIRES(8)
+)
 
-		buf = append(buf, entry.Value...)
+// vrednost zapisa u data bloku: SEQ(8)|FLAGS(1)|[TIMESTAMP(8)]|[EXPIRES(8)]|VALUE
+func encodeDataValue(entry Entry) []byte {
+	buf := make([]byte, 9, 25+len(entry.Value))
+	binary.LittleEndian.PutUint64(buf[0:8], entry.Seq)
+	if entry.Tombstone {
+		buf[8] |= dataTombstone
+	}
+	if entry.Timestamp != 0 {
+		buf[8] |= dataHasTimestamp
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.Timestamp))
+	}
+	if entry.ExpiresAt != 0 {
+		buf[8] |= dataHasExpiry
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.ExpiresAt))
+	}
+	return append(buf, entry.Value...)
+}
 
-		blockID := blockmanager.BlockID{Path: path, Num: int64(blockNum)}
-		err := bm.WriteBlock(blockID, buf)
-		if err != nil {
-			return err
+func decodeDataEntry(be blockEntry) (Entry, error) {
+	if len(be.value) < 9 {
+		return Entry{}, fmt.Errorf("korumpiran zapis za kljuc %q", be.key)
+	}
+	entry := Entry{
+		Key:       be.key,
+		Tombstone: be.value[8]&dataTombstone != 0,
+		Seq:       binary.LittleEndian.Uint64(be.value[0:8]),
+	}
+	value := be.value[9:]
+	if be.value[8]&dataHasTimestamp != 0 {
+		if len(value) < 8 {
+			return Entry{}, fmt.Errorf("korumpiran zapis za kljuc %q", be.key)
 		}
+		entry.Timestamp = int64(binary.LittleEndian.Uint64(value[:8]))
+		value = value[8:]
 	}
-
-	return nil
+	if be.value[8]&dataHasExpiry != 0 {
+		if len(value) < 8 {
+			return Entry{}, fmt.Errorf("korumpiran zapis za kljuc %q", be.key)
+		}
+		entry.ExpiresAt = int64(binary.LittleEndian.Uint64(value[:8]))
+		value = value[8:]
+	}
+	entry.Value = value
+	return entry, nil
 }
 
 // cita sve entrije iz SSTable fajla koriscenjem blokova
 func ReadDataFileWithBlocks(path string, numEntries int, bm *blockmanager.BlockManager) ([]Entry, error) {
 	var entries []Entry
 
-	for blockNum := 0; blockNum < numEntries; blockNum++ {
-		blockID := blockmanager.BlockID{Path: path, Num: int64(blockNum)}
-		data, err := bm.ReadBlock(blockID)
+	for blockNum := int64(0); len(entries) < numEntries; {
+		data, next, err := readBlock(bm, path, blockNum)
 		if err != nil {
 			return nil, fmt.Errorf("greska pri citanju bloka: %v", err)
 		}
 
-		header := data[:25]
-		timestamp := binary.LittleEndian.Uint64(header[0:8])
-		tombstone := header[8] == 1
-		keySize := binary.LittleEndian.Uint64(header[9:17])
-		valueSize := binary.LittleEndian.Uint64(header[17:25])
-
-		// vaALIDACIJA - pre nego što pokušamo da napravimo slice
-		if 25+keySize+valueSize > uint64(len(data)) {
-			return nil, fmt.Errorf("korumpiran blok: keySize=%d, valueSize=%d, ukupno treba %d bajta, ali blok ima samo %d bajta", keySize, valueSize, 25+keySize+valueSize, len(data))
+		blockEntries, err := decodeBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("korumpiran blok %d: %v", blockNum, err)
 		}
 
-		key := data[25 : 25+keySize]
-		value := data[25+keySize : 25+keySize+valueSize]
-
-		entry := Entry{
-			Key:       string(key),
-			Value:     value,
-			Tombstone: tombstone,
-			Timestamp: timestamp,
+		for _, be := range blockEntries {
+			entry, err := decodeDataEntry(be)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
 		}
-		entries = append(entries, entry)
+		blockNum = next
 	}
 
 	return entries, nil
 }
 
-// svaki zapis idu u svoj blok: keysize|key|offset
-func WriteIndexFileWithBlocks(entries []Entry, indexPath string, dataOffset []int64, bm *blockmanager.BlockManager) error {
-	tmp := make([]byte, 8)
-	blockNum := int64(0) // broj bloka krece od 0
-
-	for i, entry := range entries {
-		keyBytes := []byte(entry.Key)
-		keySize := uint64(len(keyBytes))
-
-		buf := make([]byte, 0)
-
-		binary.LittleEndian.PutUint64(tmp, keySize)
-		buf = append(buf, tmp...)
-
-		buf = append(buf, keyBytes...)
-
-		binary.LittleEndian.PutUint64(tmp, uint64(dataOffset[i]))
-		buf = append(buf, tmp...)
-
-		blockID := blockmanager.BlockID{Path: indexPath, Num: blockNum}
-		err := bm.WriteBlock(blockID, buf)
+// cita tabelu u starom formatu (format 0): svaki zapis je u svom bloku
+// TIMESTAMP(8)|TOMBSTONE(1)|KEYSIZE(8)|VALUESIZE(8)|KEY|VALUE
+// koristi se samo za prepisivanje starih tabela u trenutni format
+// stari format umesto rednog broja upisa cuva vreme upisa (UnixNano), ono raste kao i redni broj pa se koristi kao Seq,
+// a ujedno je i Timestamp zapisa
+func readLegacyDataFile(path string, numEntries int, bm *blockmanager.BlockManager) ([]Entry, error) {
+	entries := make([]Entry, 0, numEntries)
+	for blockNum := 0; blockNum < numEntries; blockNum++ {
+		data, err := bm.ReadBlock(blockmanager.BlockID{Path: path, Num: int64(blockNum)})
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("greska pri citanju bloka: %v", err)
 		}
-		blockNum++
-	}
-
-	return nil
-}
-
-// cita blok po blok
-func FindKeyInIndexWithBlocks(bm *blockmanager.BlockManager, indexPath string, targetKey string) (int64, bool) {
-	blockNum := int64(0)
-
-	for {
-		blockID := blockmanager.BlockID{Path: indexPath, Num: blockNum}
-		data, err := bm.ReadBlock(blockID)
-		if err != nil {
-			break
+		if len(data) < 25 {
+			return nil, fmt.Errorf("korumpiran blok %d", blockNum)
 		}
-
-		tmp := data[:8]
-		keySize := binary.LittleEndian.Uint64(tmp)
-
-		keyBytes := data[8 : 8+keySize]
-		key := string(keyBytes)
-
-		offsetBytes := data[8+keySize : 8+keySize+8]
-		offset := int64(binary.LittleEndian.Uint64(offsetBytes))
-
-		if key == targetKey {
-			return offset, true
+		keySize := binary.LittleEndian.Uint64(data[9:17])
+		valueSize := binary.LittleEndian.Uint64(data[17:25])
+		if keySize > uint64(len(data)-25) || valueSize > uint64(len(data)-25)-keySize {
+			return nil, fmt.Errorf("korumpiran blok %d: keySize=%d, valueSize=%d", blockNum, keySize, valueSize)
 		}
-
-		blockNum++
-
+		entries = append(entries, Entry{
+			Key:       string(data[25 : 25+keySize]),
+			Value:     append([]byte(nil), data[25+keySize:25+keySize+valueSize]...),
+			Tombstone: data[8] == 1,
+			Seq:       binary.LittleEndian.Uint64(data[0:8]),
+			Timestamp: int64(binary.LittleEndian.Uint64(data[0:8])),
+		})
 	}
-	return -1, false
+	return entries, nil
 }
 
-// cita zapis na datom offsetu u data fajlu
-func ReadDataEntryAtOffset(file *os.File, offset int64) (Entry, error) {
-	_, err := file.Seek(offset, io.SeekCurrent)
-	if err != nil {
-		return Entry{}, fmt.Errorf("ne mogu da se pozicioniram u fajlu: %v", err)
-	}
-
-	header := make([]byte, 8+1+8+8)
-	_, err = file.Read(header)
-	if err != nil {
-		return Entry{}, fmt.Errorf("greska pri citanju zagljavlja: %v", err)
-	}
-
-	timestamp := binary.LittleEndian.Uint64(header[0:8])
-	tombstone := header[8] == 1
-	keySize := binary.LittleEndian.Uint64(header[9:17])
-	valueSize := binary.LittleEndian.Uint64(header[17:25])
+// index fajl: za svaki kljuc pozicija njegovog zapisa u data fajlu
+// vraca poziciju svakog index zapisa, koristi se za pravljenje summary fajla
+func WriteIndexFileWithBlocks(entries []Entry, indexPath string, dataPos []EntryPos, bm *blockmanager.BlockManager) ([]EntryPos, error) {
+	w := newBlockFileWriter(bm, indexPath)
+	positions := make([]EntryPos, 0, len(entries))
 
-	key := make([]byte, keySize)
-	_, err = file.Read(key)
-	if err != nil {
-		return Entry{}, fmt.Errorf("greska pri citanju kljuca: %v", err)
+	for i, entry := range entries {
+		pos, err := w.add(entry.Key, encodeEntryPos(dataPos[i]))
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, pos)
 	}
 
-	value := make([]byte, valueSize)
-	_, err = file.Read(value)
-	if err != nil {
-		return Entry{}, fmt.Errorf("greska pri citanju vrendosti : %v", err)
+	if err := w.close(); err != nil {
+		return nil, err
 	}
+	return positions, nil
+}
 
-	return Entry{
-		Key:       string(key),
-		Value:     value,
-		Tombstone: tombstone,
-		Timestamp: timestamp,
-	}, nil
-
+// trazi kljuc u celom index fajlu
+func FindKeyInIndexWithBlocks(bm *blockmanager.BlockManager, indexPath string, targetKey string) (EntryPos, bool) {
+	return FindKeyInIndexFromWithBlocks(bm, indexPath, targetKey, EntryPos{})
 }
 
-// FastGetFromSSTablesWithBlocks se koristi za brzu pretragu u sstable direktorijumu koristeci blokove
-func FastGetFromSSTablesWithBlocks(baseDir string, targetKey string, bm *blockmanager.BlockManager) ([]byte, bool) {
-	entries, err := os.ReadDir(baseDir)
-	if err != nil {
-		fmt.Println("greska pri citanju direktorijuma:", err)
+// FastGetFromSSTablesWithBlocks se koristi za brzu pretragu SSTable-ova koristeci blokove
+// tabele se obilaze redosledom iz manifesta: L0 od najnovije ka najstarijoj, pa L1, L2...
+func FastGetFromSSTablesWithBlocks(m *Manifest, targetKey string, bm *blockmanager.BlockManager) ([]byte, bool) {
+	entry, found := FastGetEntryFromSSTables(m, targetKey, bm)
+	if !found || entry.Tombstone || entry.Expired(time.Now().UnixNano()) {
 		return nil, false
 	}
+	return entry.Value, true
+}
 
-	var sstableDirs []string
-	for _, entry := range entries {
-		if entry.IsDir() && strings.HasPrefix(entry.Name(), "sstable_") {
-			sstableDirs = append(sstableDirs, entry.Name())
-		}
-	}
+// FastGetEntryFromSSTables je isto sto i FastGetFromSSTablesWithBlocks, samo vraca ceo najnoviji zapis kljuca,
+// i kada je tombstone ili je istekao
+func FastGetEntryFromSSTables(m *Manifest, targetKey string, bm *blockmanager.BlockManager) (Entry, bool) {
+	m.RLockFiles()
+	defer m.RUnlockFiles()
 
-	sort.Sort(sort.Reverse(sort.StringSlice(sstableDirs)))
+	for _, table := range m.Tables() {
+		// kljuc van opsega tabele - nema potrebe da je citamo
+		if !table.Contains(targetKey) {
+			continue
+		}
 
-	for _, dir := range sstableDirs {
-		sstablePath := filepath.Join(baseDir, dir)
+		sstablePath := m.TablePath(table.Name)
 		indexPath := filepath.Join(sstablePath, "index")
 		dataPath := filepath.Join(sstablePath, "data")
 		summaryPath := filepath.Join(sstablePath, "summary")
 
-		var startOffset int64 = 0
+		// ako bloom filter kaze da kljuc sigurno ne postoji, tabelu ne citamo uopste
+		if bf := loadFilter(sstablePath); bf != nil && !bf.MayContain(targetKey) {
+			atomic.AddUint64(&bloomSkipped, 1)
+			continue
+		}
+
+		var startPos EntryPos
 		if _, err := os.Stat(summaryPath); err == nil {
-			offset, found := FindClosestIndexOffsetWithBlocks(bm, summaryPath, targetKey)
+			pos, found := FindClosestIndexOffsetWithBlocks(bm, summaryPath, targetKey)
 			if found {
-				startOffset = offset
+				startPos = pos
 			}
 		}
 
-		offset, found := FindKeyInIndexFromWithBlocks(bm, indexPath, targetKey, startOffset)
+		dataPos, found := FindKeyInIndexFromWithBlocks(bm, indexPath, targetKey, startPos)
 		if !found {
 			continue
 		}
 
-		entry, err := ReadDataEntryAtBlock(bm, dataPath, offset)
+		entry, err := ReadDataEntryAtBlock(bm, dataPath, dataPos)
 		if err != nil {
 			fmt.Println("greska pri citanju zapisa:", err)
 			continue
 		}
 
-		if entry.Tombstone {
-			return nil, false
-		}
-
-		return entry.Value, true
+		return entry, true
 	}
 
-	return nil, false
+	return Entry{}, false
 }
-// pronalazi kljuc u index fajlu od startOffset
-// vraća offset i true ako je pronađen, inače -1 i false
-// radi sekvencijalno, direktno čitajući index fajl
-func FindKeyInIndexFrom(indexPath string, targetKey string, startOffset int64) (int64, bool) {
-	file, err := os.Open(indexPath)
-	if err != nil {
-		fmt.Println("Greška pri otvaranju index fajla:", err)
-		return -1, false
-	}
-	defer file.Close()
 
-	_, err = file.Seek(startOffset, io.SeekStart)
-	if err != nil {
-		fmt.Println("Greška pri seek operaciji:", err)
-		return -1, false
-	}
+// GetFromSSTablesAt vraca verziju kljuca koju vidi snapshot seq: najnoviju sa Seq <= seq, moze biti i tombstone
+// tabele se obilaze istim redosledom kao u FastGetFromSSTablesWithBlocks; tabela koja ima samo novije verzije
+// kljuca se preskace
+func GetFromSSTablesAt(m *Manifest, targetKey string, seq uint64, bm *blockmanager.BlockManager) (Entry, bool) {
+	m.RLockFiles()
+	defer m.RUnlockFiles()
 
-	tmp := make([]byte, 8)
-
-	for {
-		_, err := file.Read(tmp)
-		if err != nil {
-			break
+	for _, table := range m.Tables() {
+		if !table.Contains(targetKey) {
+			continue
 		}
-		keySize := binary.LittleEndian.Uint64(tmp)
-
-		keyBytes := make([]byte, keySize)
-		_, err = file.Read(keyBytes)
-		if err != nil {
-			break
+		sstablePath := m.TablePath(table.Name)
+		if bf := loadFilter(sstablePath); bf != nil && !bf.MayContain(targetKey) {
+			atomic.AddUint64(&bloomSkipped, 1)
+			continue
 		}
-		key := string(keyBytes)
 
-		_, err = file.Read(tmp)
-		if err != nil {
-			break
+		// verzije kljuca su u tabeli jedna za drugom, od najnovije
+		it := newTableIterator(m, table, bm)
+		for it.Seek(targetKey); it.Valid() && it.cur.Key == targetKey; it.Next() {
+			if it.cur.Seq <= seq {
+				return it.cur, true
+			}
 		}
-		dataOffset := int64(binary.LittleEndian.Uint64(tmp))
-
-		if key == targetKey {
-			return dataOffset, true
+		if err := it.Err(); err != nil {
+			fmt.Println("greska pri citanju zapisa:", err)
 		}
 	}
 
-	return -1, false
+	return Entry{}, false
 }
 
-// pronalazi kljuc u index fajlu od startBlockNum
-// vraća offset i true ako je pronađen, inače -1 i false
-// koristi BlockManager za čitanje
-func FindKeyInIndexFromWithBlocks(bm *blockmanager.BlockManager, indexPath string, targetKey string, startBlockNum int64) (int64, bool) {
-	blockNum := startBlockNum
+// VersionsFromSSTables vraca sve verzije kljuca iz svih tabela, redom iz manifesta (od novijih ka starijim)
+func VersionsFromSSTables(m *Manifest, targetKey string, bm *blockmanager.BlockManager) []Entry {
+	m.RLockFiles()
+	defer m.RUnlockFiles()
 
-	for {
-		blockID := blockmanager.BlockID{Path: indexPath, Num: blockNum}
-		data, err := bm.ReadBlock(blockID)
-		if err != nil {
-			break
+	var versions []Entry
+	for _, table := range m.Tables() {
+		if !table.Contains(targetKey) {
+			continue
 		}
-
-		tmp := data[:8]
-		keySize := binary.LittleEndian.Uint64(tmp)
-
-		keyBytes := data[8 : 8+keySize]
-		key := string(keyBytes)
-
-		offsetBytes := data[8+keySize : 8+keySize+8]
-		offset := int64(binary.LittleEndian.Uint64(offsetBytes))
-
-		if key == targetKey {
-			return offset, true
+		sstablePath := m.TablePath(table.Name)
+		if bf := loadFilter(sstablePath); bf != nil && !bf.MayContain(targetKey) {
+			atomic.AddUint64(&bloomSkipped, 1)
+			continue
 		}
-		blockNum++
 
+		it := newTableIterator(m, table, bm)
+		for it.Seek(targetKey); it.Valid() && it.cur.Key == targetKey; it.Next() {
+			versions = append(versions, it.cur)
+		}
+		if err := it.Err(); err != nil {
+			fmt.Println("greska pri citanju zapisa:", err)
+		}
 	}
-
-	return -1, false
-
+	return versions
 }
 
-// WriteSummaryFile pravi summary fajl koji sadrzi KEYSIZE|KEY|OFFSET
-// koristi se za brzi pristup kljucevima u index fajlu,
-// sekvencijalno cita index fajl
-func WriteSummaryFile(indexPath string, summaryPath string, samplingRate int) error {
-	indexFile, err := os.Open(indexPath)
-	if err != nil {
-		return fmt.Errorf("ne mogu da otvorim index fajl: %v", err)
-	}
-	defer indexFile.Close()
-
-	summaryFile, err := os.Create(summaryPath)
-	if err != nil {
-		return fmt.Errorf("ne mogu da kreiram summary fajl: %v", err)
-	}
-	defer summaryFile.Close()
-
-	tmp := make([]byte, 8)
-
-	var indexOffset int64 = 0
-	var counter = 0
-	for {
-		_, err := indexFile.Read(tmp)
+// pronalazi kljuc u index fajlu krenuvsi od zadate pozicije (obicno dobijene iz summary fajla)
+// vraća poziciju zapisa u data fajlu i true ako je pronađen
+// kljucevi su sortirani, pa se staje cim se naidje na veci kljuc
+func FindKeyInIndexFromWithBlocks(bm *blockmanager.BlockManager, indexPath string, targetKey string, start EntryPos) (EntryPos, bool) {
+	for blockNum := start.Block; ; {
+		data, next, err := readBlock(bm, indexPath, blockNum)
 		if err != nil {
 			break
 		}
-		keySize := binary.LittleEndian.Uint64(tmp)
 
-		key := make([]byte, keySize)
-		_, err = indexFile.Read(key)
+		entries, err := decodeBlock(data)
 		if err != nil {
+			fmt.Printf(" Ostecen index blok %d u %s: %v\n", blockNum, indexPath, err)
 			break
 		}
 
-		_, err = indexFile.Read(tmp)
-		if err != nil {
-			break
-		}
-
-		_ = binary.LittleEndian.Uint64(tmp)
-
-		// ako je redni broj deljiv sa samplingRate - upisujemo u summary
-		if counter%samplingRate == 0 {
-			binary.LittleEndian.PutUint64(tmp, keySize)
-			summaryFile.Write(tmp)
-
-			summaryFile.Write(key)
-
-			binary.LittleEndian.PutUint64(tmp, uint64(indexOffset))
-			summaryFile.Write(tmp)
+		for _, e := range entries {
+			if blockNum == start.Block && e.offset < start.Offset {
+				continue
+			}
+			if e.key > targetKey {
+				return EntryPos{}, false
+			}
+			if e.key == targetKey {
+				pos, err := decodeEntryPos(e.value)
+				if err != nil {
+					return EntryPos{}, false
+				}
+				return pos, true
+			}
 		}
-
-		indexOffset += 8 + int64(keySize) + 8
-		counter++
+		blockNum = next
 	}
 
-	return nil
+	return EntryPos{}, false
 }
 
-// slična funkcija kao WriteSummaryFile po nameni, ali koristi BlockManager za čitanje index fajla,
-// kao i za pisanje summary fajla
-func WriteSummaryFileWithBlocks(indexPath string, summaryPath string, samplingRate int, bm *blockmanager.BlockManager) error {
-	tmp := make([]byte, 8)
-	blockNum := int64(0)
-	summaryBlockNum := int64(0)
-	counter := 0
-
-	for {
-		blockID := blockmanager.BlockID{Path: indexPath, Num: blockNum}
-		data, err := bm.ReadBlock(blockID)
-		if err != nil {
-			break
-		}
-
-		if len(data) < 16 {
-			blockNum++
-			continue
-		}
-
-		keySize := binary.LittleEndian.Uint64(data[:8])
+// summary fajl sadrzi svaki samplingRate-ti kljuc iz index fajla i poziciju tog kljuca u index fajlu
+func WriteSummaryFileWithBlocks(entries []Entry, indexPos []EntryPos, summaryPath string, samplingRate int, bm *blockmanager.BlockManager) error {
+	if samplingRate <= 0 {
+		samplingRate = 1
+	}
 
-		if keySize > uint64(len(data)-16) {
-			fmt.Printf(" Nevalidan keySize: %d u bloku %d (preskačem)\n", keySize, blockNum)
-			blockNum++
+	w := newBlockFileWriter(bm, summaryPath)
+	for i, entry := range entries {
+		if i%samplingRate != 0 {
 			continue
 		}
-
-		keyBytes := data[8 : 8+keySize]
-
-		indexOffset := blockNum * int64(bm.BlockSize())
-
-		if counter%samplingRate == 0 {
-			buf := make([]byte, 0)
-
-			binary.LittleEndian.PutUint64(tmp, keySize)
-			buf = append(buf, tmp...)
-
-			buf = append(buf, keyBytes...)
-
-			binary.LittleEndian.PutUint64(tmp, uint64(indexOffset))
-			buf = append(buf, tmp...)
-
-			summaryBlockID := blockmanager.BlockID{Path: summaryPath, Num: summaryBlockNum}
-			err := bm.WriteBlock(summaryBlockID, buf)
-			if err != nil {
-				return err
-			}
-			summaryBlockNum++
+		if _, err := w.add(entry.Key, encodeEntryPos(indexPos[i])); err != nil {
+			return err
 		}
-		counter++
-		blockNum++
 	}
-	return nil
+	return w.close()
 }
 
-// nalazi nalbliži offset u summary fajlu,
-// koji je manji ili jednak od targetKey
-// vraća offset i true ako je pronađen, inače -1 i false
-// sve ovo radi sekvencijalno, direktno čitajući summary fajl
-func FindClosestIndexOffset(summaryPath, targetKey string) (int64, bool) {
-	file, err := os.Open(summaryPath)
-	if err != nil {
-		fmt.Println("ne mogu da otvorim summary fajl:", err)
-		return -1, false
-	}
-	defer file.Close()
-
-	var bestMatchOffset int64 = -1
-	var tmp = make([]byte, 8)
-
-	for {
-		_, err := file.Read(tmp)
-		if err != nil {
-			break
-		}
-		keySize := binary.LittleEndian.Uint64(tmp)
-
-		keyBytes := make([]byte, keySize)
-		_, err = file.Read(keyBytes)
-		if err != nil {
-			break
-		}
-		key := string(keyBytes)
+// nalazi nalbliži kljuc u summary fajlu koji je strogo manji od targetKey
+// (jednak ne sme: tabela moze imati vise verzija kljuca, a summary moze pokazivati na neku od starijih)
+// vraća njegovu poziciju u index fajlu i true ako je pronađen
+func FindClosestIndexOffsetWithBlocks(bm *blockmanager.BlockManager, summaryPath string, targetKey string) (EntryPos, bool) {
+	var best EntryPos
+	found := false
 
-		_, err = file.Read(tmp)
+	for blockNum := int64(0); ; {
+		data, next, err := readBlock(bm, summaryPath, blockNum)
 		if err != nil {
 			break
 		}
-		offset := int64(binary.LittleEndian.Uint64(tmp))
-
-		if key <= targetKey {
-			bestMatchOffset = offset
-		} else {
-			break
-		}
-	}
-
-	if bestMatchOffset == -1 {
-		return -1, false
-	}
-
-	return bestMatchOffset, true
-
-}
-
-// nalazi nalbliži offset u summary fajlu
-// koji je manji ili jednak od targetKey
-// ali koristi BlockManager za čitanje
-func FindClosestIndexOffsetWithBlocks(bm *blockmanager.BlockManager, summaryPath string, targetKey string) (int64, bool) {
-	blockNum := int64(0)
-	var bestMatchOffset int64 = -1
 
-	for {
-		blockID := blockmanager.BlockID{Path: summaryPath, Num: blockNum}
-		data, err := bm.ReadBlock(blockID)
+		entries, err := decodeBlock(data)
 		if err != nil {
 			break
 		}
 
-		tmp := data[:8]
-		keySize := binary.LittleEndian.Uint64(tmp)
-
-		keyBytes := data[8 : 8+keySize]
-		key := string(keyBytes)
-
-		offsetBytes := data[8+keySize : 8+keySize+8]
-		offset := int64(binary.LittleEndian.Uint64(offsetBytes))
-
-		if key <= targetKey {
-			bestMatchOffset = offset
-		} else {
-			break
+		for _, e := range entries {
+			if e.key >= targetKey {
+				return best, found
+			}
+			pos, err := decodeEntryPos(e.value)
+			if err != nil {
+				return best, found
+			}
+			best = pos
+			found = true
 		}
-
-		blockNum++
+		blockNum = next
 	}
 
-	if bestMatchOffset == -1 {
-		return -1, false
-	}
-
-	return bestMatchOffset, true
+	return best, found
 }
 
 // kombinuje vise SSTable fajlova u jedan SSTable fajl
 // stare fajlove brise, kao i sve prethodno logicki obrisane zapise unutar njih
-func CompactSSTables(sstableDir string, bm *blockmanager.BlockManager) error {
-	files, err := os.ReadDir(sstableDir)
-	if err != nil {
-		return fmt.Errorf("ne mogu da procitam direktorijum SSTable: %v", err)
-	}
-
-	sstableFolders := []string{}
-	for _, f := range files {
-		if f.IsDir() && strings.HasPrefix(f.Name(), "sstable_") {
-			sstableFolders = append(sstableFolders, filepath.Join(sstableDir, f.Name()))
-		}
-	}
-
-	if len(sstableFolders) < 2 {
+// kod leveled strategije nova tabela ide na poslednji nivo, a kod size_tiered na L0 (tamo zive sve tabele),
+// sa mestom najnovije ulazne tabele; u oba slucaja tabele koje flush doda dok spajanje traje ostaju ispred nje
+func CompactSSTables(m *Manifest, bm *blockmanager.BlockManager) error {
+	m.compactMu.Lock()
+	defer m.compactMu.Unlock()
+
+	tables := m.Tables()
+	if len(tables) < 2 {
 		fmt.Println("nema potrebe za kompaktiranjem, postoji manje od 2 sstable-a")
 		return nil
 	}
 
-	merged := make(map[string]Entry)
-
-	for _, folder := range sstableFolders {
-		metaPath := filepath.Join(folder, "meta")
-		dataPath := filepath.Join(folder, "data")
-
-		count, err := LoadMeta(metaPath)
-		if err != nil {
-			return fmt.Errorf("greska pri citanju meta fajla: %v", err)
-		}
-
-		entries, err := ReadDataFileWithBlocks(dataPath, int(count), bm)
-		if err != nil {
-			return fmt.Errorf("greska pri citanju SSTable %s: %v", folder, err)
-		}
-
-		for _, e := range entries {
-			if existing, ok := merged[e.Key]; !ok || e.Timestamp > existing.Timestamp {
-				merged[e.Key] = e
-			}
-		}
-	}
-
-	var finalEntries []Entry
-	for _, entry := range merged {
-		if !entry.Tombstone {
-			finalEntries = append(finalEntries, entry)
-		}
+	// leveled: izlaz se deli po target_file_size_bytes, tabele poslednjeg nivoa su disjunktne
+	level, targetSize := bottomLevel(), targetFileSize()
+	if CompactionStrategy() == StrategySizeTiered {
+		level, targetSize = 0, 0
 	}
-	sort.Slice(finalEntries, func(i, j int) bool {
-		return finalEntries[i].Key < finalEntries[j].Key
-	})
 
-	timestamp := time.Now().UnixNano()
-	newDir := filepath.Join(sstableDir, fmt.Sprintf("sstable_L0_%d", timestamp))
-	err = os.MkdirAll(newDir, os.ModePerm)
+	// spajaju se sve tabele, pa tombstone vise nema sta da sakrije i moze da se izbaci
+	out := newCompactionOutput(m, level, targetSize, tables, bm)
+	written, _, err := mergeInto(m, tables, out, func(string) bool { return true }, bm)
 	if err != nil {
-		return fmt.Errorf("ne mogu da napravim novi SSTable folder: %v", err)
+		out.abort()
+		return err
 	}
-
-	err = WriteAllFilesWithBlocks(newDir, finalEntries, bm)
+	added, err := out.finish()
 	if err != nil {
-		return fmt.Errorf("ne mogu da upisem novi SSTable: %v", err)
+		out.abort()
+		return err
+	}
+	for i := range added {
+		added[i].CreatedSeq = newestCreated(tables)
 	}
 
-	for _, old := range sstableFolders {
-		if err := os.RemoveAll(old); err != nil {
-			fmt.Printf(" Ne mogu da obrišem %s: %v\n", old, err)
-		}
+	if err := replaceTables(m, tables, added); err != nil {
+		return err
 	}
 
-	fmt.Printf(" Kompaktiranje uspešno! Napravljen novi SSTable (%d zapisa).\n", len(finalEntries))
+	fmt.Printf(" Kompaktiranje uspešno! Napravljeno %d SSTable-ova (%d zapisa).\n", len(added), written)
 	return nil
 }
 
-// cita zapis na datoj poziciji bloka u data fajlu
-func ReadDataEntryAtBlock(bm *blockmanager.BlockManager, path string, blockNum int64) (Entry, error) {
-	blockID := blockmanager.BlockID{Path: path, Num: blockNum}
-	data, err := bm.ReadBlock(blockID)
-	if err != nil {
-		return Entry{}, fmt.Errorf("ne mogu da procitam blok: %v", err)
+// u jednoj izmeni manifesta dodaje nove tabele i uklanja stare, pa tek onda brise stare foldere
+// ako se padne pre upisa u manifest, stare tabele ostaju vazece, a nove se brisu pri sledecem pokretanju
+func replaceTables(m *Manifest, old []TableMeta, added []TableMeta) error {
+	edit := VersionEdit{Added: added}
+	for _, t := range old {
+		edit.Removed = append(edit.Removed, t.Name)
+	}
+	if err := m.Apply(edit); err != nil {
+		return fmt.Errorf("ne mogu da azuriram manifest: %v", err)
 	}
 
-	header := data[:25]
-	timestamp := binary.LittleEndian.Uint64(header[0:8])
-	tombstone := header[8] == 1
-	keySize := binary.LittleEndian.Uint64(header[9:17])
-	valueSize := binary.LittleEndian.Uint64(header[17:25])
-
-	key := data[25 : 25+keySize]
-	value := data[25+keySize : 25+keySize+valueSize]
-
-	return Entry{
-		Key:       string(key),
-		Value:     value,
-		Tombstone: tombstone,
-		Timestamp: timestamp,
-	}, nil
+	// ceka citaoce koji su uzeli spisak tabela pre izmene; tabele koje drze iteratori ostaju dok ih ne puste
+	m.filesMu.Lock()
+	defer m.filesMu.Unlock()
+	for _, t := range old {
+		m.removeTableFiles(t.Name)
+	}
+	return nil
 }
 
-// upisuje sve fajlove u sstable direktorijum
-func WriteAllFilesWithBlocks(dirPath string, entries []Entry, bm *blockmanager.BlockManager) error {
-	dataPath := filepath.Join(dirPath, "data")
-	err := WriteDataFileWithBlocks(entries, dataPath, bm)
+// cita zapis na datoj poziciji (blok i mesto u bloku) u data fajlu
+func ReadDataEntryAtBlock(bm *blockmanager.BlockManager, path string, pos EntryPos) (Entry, error) {
+	data, _, err := readBlock(bm, path, pos.Block)
 	if err != nil {
-		return fmt.Errorf("ne mogu da upisem data fajl: %v", err)
+		return Entry{}, fmt.Errorf("ne mogu da procitam blok: %v", err)
 	}
 
-	metaPath := filepath.Join(dirPath, "meta")
-	metaFile, err := os.Create(metaPath)
-	if err != nil {
-		return fmt.Errorf("ne mogu da kreiram meta fajl: %v", err)
-	}
-	defer metaFile.Close()
-	err = binary.Write(metaFile, binary.LittleEndian, int64(len(entries)))
+	be, err := decodeEntryAt(data, pos.Offset)
 	if err != nil {
-		return fmt.Errorf("ne mogu da upisem broj zapisa u meta fajl: %v", err)
+		return Entry{}, err
 	}
+	return decodeDataEntry(be)
+}
 
-	indexPath := filepath.Join(dirPath, "index")
-	var offsets []int64
-	for i := range entries {
-		offsets = append(offsets, int64(i))
-	}
-	err = WriteIndexFileWithBlocks(entries, indexPath, offsets, bm)
-	if err != nil {
-		return fmt.Errorf("ne mogu da upisem index fajl: %v", err)
-	}
+// upisuje sve fajlove u sstable direktorijum
+func WriteAllFilesWithBlocks(dirPath string, entries []Entry, bm *blockmanager.BlockManager) error {
+	return WriteTableWithRangeDels(dirPath, entries, nil, bm)
+}
 
-	summaryPath := filepath.Join(dirPath, "summary")
-	err = WriteSummaryFileWithBlocks(indexPath, summaryPath, config.Current.SummaryKeyDistance, bm)
-	if err != nil {
-		return fmt.Errorf("ne mogu da upisem summary fajl: %v", err)
-	}
+// WriteTableWithRangeDels je isto sto i WriteAllFilesWithBlocks, uz brisanja opsega (flush Memtable-a)
+func WriteTableWithRangeDels(dirPath string, entries []Entry, dels []RangeTombstone, bm *blockmanager.BlockManager) error {
+	sort.Sort(byKey(entries))
 
-	bf := bloomfilter.NewBloomFilter(len(entries), 0.01)
+	builder := newTableBuilder(dirPath, len(entries), bm)
+	builder.rangeDels = dels
 	for _, entry := range entries {
-		if !entry.Tombstone {
-			bf.Add(entry.Key)
+		if err := builder.add(entry); err != nil {
+			return err
 		}
 	}
-	bloomPath := filepath.Join(dirPath, "bloom")
-	err = bf.SaveToFile(bloomPath)
-	if err != nil {
-		return fmt.Errorf("ne mogu da upisem bloom filter: %v", err)
-	}
-
-	root := GenerateMerkleRoot(entries)
-	merklePath := filepath.Join(dirPath, "merkle")
-	err = os.WriteFile(merklePath, []byte(hex.EncodeToString(root)), 0644)
-	if err != nil {
-		return fmt.Errorf("ne mogu da upisem merkle root: %v", err)
-	}
-
-	return nil
+	return builder.finish()
 }
 
 // izvlaci nivo ss tabla
@@ -728,100 +532,16 @@ func ExtractLevelFromFolder(folderName string) int {
 	return level
 }
 
-func CompactLevel(sstableDir string, level int, bm *blockmanager.BlockManager) error {
-	entries, err := os.ReadDir(sstableDir)
-	if err != nil {
-		return fmt.Errorf("ne mogu da procitam sstable direktorijum: %v", err)
-	}
-
-	var foldersOnLevel []string
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		folderName := entry.Name()
-		if !strings.HasPrefix(folderName, "sstable_L") {
-			continue
-		}
-		folderLevel := ExtractLevelFromFolder(folderName)
-		if folderLevel == level {
-			foldersOnLevel = append(foldersOnLevel, folderName)
-		}
-	}
-
-	if len(foldersOnLevel) <= config.Current.SSTableFilesPerLevel {
-		return nil
-	}
-
-	fmt.Printf(" Pokrećem kompakciju za nivo %d...\n", level)
-
-	var allEntries []Entry
-	for _, folderName := range foldersOnLevel {
-		folderPath := filepath.Join(sstableDir, folderName)
-		metaPath := filepath.Join(folderPath, "meta")
-		dataPath := filepath.Join(folderPath, "data")
-
-		count, err := LoadMeta(metaPath)
-		if err != nil {
-			return fmt.Errorf("greska pri citanju meta fajla: %v", err)
-		}
-
-		entries, err := ReadDataFileWithBlocks(dataPath, int(count), bm)
-		if err != nil {
-			return fmt.Errorf("greska pri citanju SSTable foldera %s: %v", folderName, err)
-		}
-		allEntries = append(allEntries, entries...)
-	}
-
-	sort.Slice(allEntries, func(i, j int) bool {
-		return allEntries[i].Key < allEntries[j].Key
-	})
-
-	newLevel := level + 1
-	newFolderName := fmt.Sprintf("sstable_L%d_%d", newLevel, time.Now().UnixNano())
-	newFolderPath := filepath.Join(sstableDir, newFolderName)
-
-	err = os.MkdirAll(newFolderPath, os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("ne mogu da napravim novi SSTable folder: %v", err)
-	}
-
-	err = WriteAllFilesWithBlocks(newFolderPath, allEntries, bm)
-	if err != nil {
-		return fmt.Errorf("ne mogu da upisem fajlove: %v", err)
-	}
-
-	for _, folderName := range foldersOnLevel {
-		fullPath := filepath.Join(sstableDir, folderName)
-		err := os.RemoveAll(fullPath)
-		if err != nil {
-			fmt.Printf(" Ne mogu da obrišem %s: %v\n", fullPath, err)
-		}
-	}
-
-	fmt.Printf("Kompaktiranje nivoa %d uspešno! Novi nivo %d.\n", level, newLevel)
-	return nil
-}
-
-// funkcija koja iterira kroz nivoe
-func AutoCompact(sstableDir string, bm *blockmanager.BlockManager) error {
-	maxLevels := config.Current.MaxSSTableLevels
-
-	for level := 0; level < maxLevels; level++ {
-		err := CompactLevel(sstableDir, level, bm)
-		if err != nil {
-			return fmt.Errorf("greska pri kompaktiranju nivoa %d: %v", level, err)
-		}
-	}
-	return nil
-}
-
 func LoadMeta(path string) (int64, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return 0, fmt.Errorf("ne mogu da procitam meta fajl: %v", err)
 	}
-	return int64(binary.LittleEndian.Uint64(data)), nil
+	meta, _, err := decodeMeta(data)
+	if err != nil {
+		return 0, err
+	}
+	return meta.Count, nil
 }
 
 // proverava da li je Merkle stablo validno, tj da li je neki od zapisa promenjen
@@ -0,0 +1,168 @@
+package sstable
+
+import (
+	"fmt"
+	"napredni/blockmanager"
+	"napredni/config"
+	"sort"
+)
+
+// Size-tiered kompakcija (compaction_strategy: size_tiered):
+//   - sve tabele zive na L0, nema nivoa ni ciljnih velicina
+//   - tabele se, od najstarije ka najnovijoj, dele u grupe (bucket) slicne velicine: tabela ulazi u grupu ako je
+//     izmedju tieredBucketLow i tieredBucketHigh puta prosecne velicine grupe; sve tabele manje od tieredMinTableBytes
+//     se racunaju kao iste velicine
+//   - grupa se spaja u jednu tabelu cim ima bar min_threshold tabela (najvise tieredMaxThreshold odjednom)
+//   - u grupi su samo tabele koje su susedne po starosti, pa nova tabela dobija mesto (CreatedSeq) najnovije ulazne
+//     i pretraga i dalje ide od novijih ka starijim podacima
+//   - tombstone se izbacuje samo kada nijedna tabela van grupe ne pokriva kljuc
+// Manje prepisivanja podataka nego leveled, ali vise prostora i vise tabela za citanje
+
+const (
+	tieredBucketLow      = 0.5
+	tieredBucketHigh     = 1.5
+	tieredMinTableBytes  = 4 * 1024
+	tieredMaxThreshold   = 32
+	defaultTieredMinimum = 4
+)
+
+func minThreshold() int {
+	if config.Current.MinThreshold >= 2 {
+		return config.Current.MinThreshold
+	}
+	return defaultTieredMinimum
+}
+
+// tieredBuckets deli tabele sa L0 u grupe susednih tabela slicne velicine, od najstarije ka najnovijoj
+func tieredBuckets(m *Manifest) [][]TableMeta {
+	tables := m.LevelTables(0)
+	sort.Slice(tables, func(i, j int) bool { return tables[i].CreatedSeq < tables[j].CreatedSeq })
+
+	var buckets [][]TableMeta
+	var current []TableMeta
+	var sum int64
+	for _, t := range tables {
+		if len(current) > 0 && !similarSize(t.Size, sum/int64(len(current))) {
+			buckets = append(buckets, current)
+			current, sum = nil, 0
+		}
+		current = append(current, t)
+		sum += t.Size
+	}
+	if len(current) > 0 {
+		buckets = append(buckets, current)
+	}
+	return buckets
+}
+
+func similarSize(size, avg int64) bool {
+	if size < tieredMinTableBytes && avg < tieredMinTableBytes {
+		return true
+	}
+	return float64(size) >= tieredBucketLow*float64(avg) && float64(size) <= tieredBucketHigh*float64(avg)
+}
+
+// pickBucket vraca grupu za spajanje: medju grupama sa bar min_threshold tabela onu sa najmanjim tabelama
+// (one se najbrze spajaju i najvise smanjuju broj tabela), ili nil ako takve nema
+func pickBucket(m *Manifest) []TableMeta {
+	var best []TableMeta
+	var bestAvg int64
+	for _, bucket := range tieredBuckets(m) {
+		if len(bucket) < minThreshold() {
+			continue
+		}
+		if len(bucket) > tieredMaxThreshold {
+			bucket = bucket[:tieredMaxThreshold]
+		}
+		avg := totalSize(bucket) / int64(len(bucket))
+		if best == nil || avg < bestAvg {
+			best, bestAvg = bucket, avg
+		}
+	}
+	return best
+}
+
+// pendingTieredBytes je ukupna velicina tabela u grupama koje cekaju spajanje
+func pendingTieredBytes(m *Manifest) int64 {
+	var pending int64
+	for _, bucket := range tieredBuckets(m) {
+		if len(bucket) >= minThreshold() {
+			pending += totalSize(bucket)
+		}
+	}
+	return pending
+}
+
+// newestCreated vraca najveci CreatedSeq medju tabelama
+func newestCreated(tables []TableMeta) uint64 {
+	var newest uint64
+	for _, t := range tables {
+		if t.CreatedSeq > newest {
+			newest = t.CreatedSeq
+		}
+	}
+	return newest
+}
+
+// autoCompactTiered spaja grupe dok god neka ima bar min_threshold tabela
+// grupe se biraju na L0, pa jednu size-tiered kompakciju radi samo jedan radnik (rezervise L0)
+func autoCompactTiered(m *Manifest, bm *blockmanager.BlockManager) error {
+	m.compactMu.RLock()
+	defer m.compactMu.RUnlock()
+
+	if !m.reserveLevels(0) {
+		return nil
+	}
+	defer m.releaseLevels(0)
+
+	for {
+		bucket := pickBucket(m)
+		if bucket == nil {
+			return nil
+		}
+		if err := compactBucket(m, bucket, bm); err != nil {
+			return fmt.Errorf("greska pri size-tiered kompakciji: %v", err)
+		}
+	}
+}
+
+// compactBucket spaja jednu grupu tabela u novu tabelu na L0
+func compactBucket(m *Manifest, bucket []TableMeta, bm *blockmanager.BlockManager) error {
+	fmt.Printf(" Pokrećem size-tiered kompakciju: %d tabela, %d bajtova\n", len(bucket), totalSize(bucket))
+
+	inBucket := make(map[string]bool)
+	for _, table := range bucket {
+		inBucket[table.Name] = true
+	}
+	var others []TableMeta
+	for _, t := range m.Tables() {
+		if !inBucket[t.Name] {
+			others = append(others, t)
+		}
+	}
+
+	// grupa se spaja u jednu tabelu (bez podele po velicini), inace bi ostala u istoj grupi
+	out := newCompactionOutput(m, 0, 0, bucket, bm)
+	written, _, err := mergeInto(m, bucket, out, func(key string) bool {
+		return !coveredBelow(others, key)
+	}, bm)
+	if err != nil {
+		out.abort()
+		return err
+	}
+	added, err := out.finish()
+	if err != nil {
+		out.abort()
+		return err
+	}
+	// nova tabela zauzima mesto najnovije ulazne, tabele novije od grupe ostaju ispred nje
+	for i := range added {
+		added[i].CreatedSeq = newestCreated(bucket)
+	}
+
+	if err := replaceTables(m, bucket, added); err != nil {
+		return err
+	}
+	fmt.Printf("Size-tiered kompakcija uspešna! Nova tabela ima %d zapisa.\n", written)
+	return nil
+}
@@ -0,0 +1,62 @@
+package sstable
+
+import (
+	"fmt"
+	"napredni/config"
+	"testing"
+)
+
+func bucketNames(bucket []TableMeta) []string {
+	var names []string
+	for _, t := range bucket {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// tabele se grupisu po starosti i velicini, a spaja se grupa sa najmanjim tabelama koja ima bar min_threshold tabela
+func TestTieredBucketSelection(t *testing.T) {
+	saved := config.Current
+	t.Cleanup(func() { config.Current = saved })
+	config.Current.CompactionStrategy = StrategySizeTiered
+	config.Current.MinThreshold = 4
+
+	m := openTestManifest(t, t.TempDir())
+	sizes := []int64{
+		100 << 10, 120 << 10, 90 << 10, 110 << 10, // velike, stare
+		30 << 10, 40 << 10, // srednje, samo dve
+		1 << 10, 2 << 10, 3 << 10, 1 << 10, 2 << 10, // manje od tieredMinTableBytes, racunaju se kao iste
+	}
+	var tables []TableMeta
+	for _, size := range sizes {
+		name, seq := m.NewTableName(0)
+		tables = append(tables, TableMeta{Name: name, Level: 0, MinKey: "a", MaxKey: "z", Count: 1,
+			CreatedSeq: seq, Format: TableFormatVersion, Size: size})
+	}
+	mustApply(t, m, VersionEdit{Added: tables})
+
+	buckets := tieredBuckets(m)
+	want := [][]TableMeta{tables[0:4], tables[4:6], tables[6:]}
+	if len(buckets) != len(want) {
+		t.Fatalf("dobijeno %d grupa %v, ocekivano %d", len(buckets), buckets, len(want))
+	}
+	for i := range want {
+		if got, exp := fmt.Sprint(bucketNames(buckets[i])), fmt.Sprint(bucketNames(want[i])); got != exp {
+			t.Fatalf("grupa %d je %s, ocekivano %s", i, got, exp)
+		}
+	}
+
+	// obe grupe sa bar 4 tabele cekaju spajanje, bira se ona sa manjim tabelama
+	if got, exp := fmt.Sprint(bucketNames(pickBucket(m))), fmt.Sprint(bucketNames(tables[6:])); got != exp {
+		t.Fatalf("izabrana grupa %s, ocekivano %s", got, exp)
+	}
+	if got, exp := pendingTieredBytes(m), totalSize(tables[0:4])+totalSize(tables[6:]); got != exp {
+		t.Fatalf("ceka kompakciju %d bajtova, ocekivano %d", got, exp)
+	}
+
+	// sa vecim pragom nijedna grupa nije dovoljno velika
+	config.Current.MinThreshold = 6
+	if bucket := pickBucket(m); bucket != nil {
+		t.Fatalf("izabrana grupa %v, ocekivano da nema grupe za spajanje", bucketNames(bucket))
+	}
+}
@@ -0,0 +1,75 @@
+package wal
+
+import (
+	"fmt"
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+)
+
+// Nacin oporavka WAL-a posle pada (wal_recovery_mode), kao kod RocksDB-a
+//
+// absolute_consistency    - bilo kakvo ostecenje je greska, baza se ne otvara
+// tolerate_corrupted_tail - ostecen kraj poslednjeg segmenta (presecen upis) se odseca, ostecenje bilo gde drugde je greska
+// point_in_time           - replay staje na prvom ostecenju, sve posle njega (i kasniji segmenti) se odbacuje
+// skip_any_corrupted      - osteceni delovi se preskacu, a replay nastavlja dalje
+
+const (
+	RecoveryAbsoluteConsistency   = "absolute_consistency"
+	RecoveryTolerateCorruptedTail = "tolerate_corrupted_tail"
+	RecoveryPointInTime           = "point_in_time"
+	RecoverySkipAnyCorrupted      = "skip_any_corrupted"
+)
+
+// RecoveryReport opisuje kako je prosao replay WAL-a
+type RecoveryReport struct {
+	Mode       string
+	Segments   int              // broj procitanih segmenata
+	Records    int              // broj zapisa vracenih u Memtable
+	Corruption *CorruptionError // prvo ostecenje, nil ako ga nije bilo
+	Stopped    bool             // replay je stao na ostecenju (ostatak WAL-a je odbacen)
+	Skipped    int              // broj segmenata sa ostecenjima koja su preskocena
+}
+
+func (r RecoveryReport) String() string {
+	switch {
+	case r.Corruption == nil:
+		return fmt.Sprintf("WAL oporavak (%s): %d segmenata, %d zapisa, bez ostecenja", r.Mode, r.Segments, r.Records)
+	case r.Stopped:
+		return fmt.Sprintf("WAL oporavak (%s): %d zapisa, stao u %s, blok %d: %s",
+			r.Mode, r.Records, filepath.Base(r.Corruption.Segment), r.Corruption.Block, r.Corruption.Reason)
+	default:
+		return fmt.Sprintf("WAL oporavak (%s): %d zapisa, preskocena ostecenja u %d segmenata (prvo u %s, blok %d: %s)",
+			r.Mode, r.Records, r.Skipped, filepath.Base(r.Corruption.Segment), r.Corruption.Block, r.Corruption.Reason)
+	}
+}
+
+func normalizeRecoveryMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return RecoveryTolerateCorruptedTail, nil
+	case RecoveryAbsoluteConsistency, RecoveryTolerateCorruptedTail, RecoveryPointInTime, RecoverySkipAnyCorrupted:
+		return mode, nil
+	}
+	return "", fmt.Errorf("nepoznat wal_recovery_mode: %s", mode)
+}
+
+// odbacuje WAL posle mesta ostecenja: odseca segment na kraju poslednjeg validnog zapisa i brise kasnije segmente
+func discardAfter(bm *blockmanager.BlockManager, segments []string, index int, end int64) error {
+	if err := bm.Truncate(segments[index], end); err != nil {
+		return fmt.Errorf("ne mogu da odsecem segment %s: %v", segments[index], err)
+	}
+	for _, path := range segments[index+1:] {
+		fmt.Printf(" Brisem WAL segment posle ostecenja: %s\n", filepath.Base(path))
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("ne mogu da obrisem segment %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// proverava da li iza ostecenja u segmentu postoje jos validni zapisi (tada ostecenje nije samo presecen kraj)
+func hasRecordsAfter(bm *blockmanager.BlockManager, path string, before int) bool {
+	records, _, _, err := scanSegment(bm, path, true)
+	return err == nil && len(records) > before
+}
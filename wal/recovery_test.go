@@ -0,0 +1,266 @@
+package wal
+
+import (
+	"fmt"
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pise n zapisa (kljucevi k0, k1, ...) u WAL sa malim segmentima, pa ih ima vise
+func writeRecords(t *testing.T, dir string, from, n int) {
+	t.Helper()
+	w, err := NewWriter(dir, 100, blockmanager.NewBlockManager(1, 16), SyncOptions{Mode: SyncNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := from; i < from+n; i++ {
+		rec := Record{Seq: uint64(i + 1), Key: []byte(fmt.Sprintf("k%d", i)), Value: []byte("vrednost")}
+		if err := w.Write(rec, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func replay(dir, mode string) ([]string, RecoveryReport, error) {
+	var keys []string
+	report, err := ReplayWAL(blockmanager.NewBlockManager(1, 16), dir, mode, func(_ string, rec Record) error {
+		keys = append(keys, string(rec.Key))
+		return nil
+	})
+	return keys, report, err
+}
+
+func segmentPaths(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+// presecen upis na kraju segmenta
+func appendGarbage(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte{0xde, 0xad, 0xbe, 0xef, 0x20, 0, 0, 0, 1, 'x'}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ostecenje prvog zapisa u segmentu
+func flipByte(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[segmentHeaderSize+fragmentHeaderSize+2] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTolerateCorruptedTailTruncates(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, 0, 10)
+	segments := segmentPaths(t, dir)
+	last := segments[len(segments)-1]
+	size := fileSize(t, last)
+	appendGarbage(t, last)
+
+	keys, report, err := replay(dir, RecoveryTolerateCorruptedTail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 10 || report.Corruption == nil {
+		t.Fatalf("vraceno %d zapisa, ostecenje %v", len(keys), report.Corruption)
+	}
+	if got := fileSize(t, last); got != size {
+		t.Fatalf("segment nije odsecen: %d bajtova, ocekivano %d", got, size)
+	}
+
+	// novi zapisi se nastavljaju odmah iza validnih
+	writeRecords(t, dir, 10, 1)
+	keys, report, err = replay(dir, RecoveryTolerateCorruptedTail)
+	if err != nil || len(keys) != 11 || report.Corruption != nil {
+		t.Fatalf("posle odsecanja: %d zapisa, ostecenje %v, greska %v", len(keys), report.Corruption, err)
+	}
+}
+
+func TestTolerateRejectsCorruptionBeforeTail(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, 0, 10)
+	segments := segmentPaths(t, dir)
+	if len(segments) < 3 {
+		t.Fatalf("ocekivano vise segmenata, ima ih %d", len(segments))
+	}
+	flipByte(t, segments[0])
+	size := fileSize(t, segments[0])
+
+	if _, _, err := replay(dir, RecoveryTolerateCorruptedTail); err == nil {
+		t.Fatal("ocekivana greska za ostecenje koje nije na kraju WAL-a")
+	}
+	if len(segmentPaths(t, dir)) != len(segments) || fileSize(t, segments[0]) != size {
+		t.Fatal("WAL je menjan iako replay nije uspeo")
+	}
+}
+
+func TestAbsoluteConsistencyKeepsWAL(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, 0, 3)
+	segments := segmentPaths(t, dir)
+	last := segments[len(segments)-1]
+	appendGarbage(t, last)
+	size := fileSize(t, last)
+
+	if _, _, err := replay(dir, RecoveryAbsoluteConsistency); err == nil {
+		t.Fatal("ocekivana greska za ostecen kraj")
+	}
+	if fileSize(t, last) != size {
+		t.Fatal("absolute_consistency je odsekao segment")
+	}
+}
+
+func TestPointInTimeDiscardsAfterCorruption(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, 0, 10)
+	segments := segmentPaths(t, dir)
+	flipByte(t, segments[1])
+
+	keys, report, err := replay(dir, RecoveryPointInTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Stopped {
+		t.Fatal("replay nije stao na ostecenju")
+	}
+	first, _, err := replay(dir, RecoveryAbsoluteConsistency)
+	if err != nil {
+		t.Fatalf("posle point_in_time WAL nije cist: %v", err)
+	}
+	if len(first) != len(keys) || len(segmentPaths(t, dir)) != 2 {
+		t.Fatalf("ocekivani samo zapisi pre ostecenja: %v, segmenti %v", keys, segmentPaths(t, dir))
+	}
+}
+
+func TestSkipAnyCorruptedKeepsDamage(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, 0, 10)
+	segments := segmentPaths(t, dir)
+	flipByte(t, segments[0])
+	last := segments[len(segments)-1]
+	appendGarbage(t, last)
+	size := fileSize(t, last)
+
+	keys, report, err := replay(dir, RecoverySkipAnyCorrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 2 || len(keys) == 0 || len(keys) >= 10 {
+		t.Fatalf("vraceno %d zapisa, preskoceno %d segmenata", len(keys), report.Skipped)
+	}
+	if fileSize(t, last) != size {
+		t.Fatal("skip_any_corrupted je odsekao segment")
+	}
+
+	// writer ne pise iza ostecenja, nego u novi segment
+	writeRecords(t, dir, 10, 1)
+	if fileSize(t, last) != size {
+		t.Fatal("writer je promenio segment sa ostecenjem")
+	}
+	after, _, err := replay(dir, RecoverySkipAnyCorrupted)
+	if err != nil || len(after) != len(keys)+1 || after[len(after)-1] != "k10" {
+		t.Fatalf("posle novog upisa: %v, greska %v", after, err)
+	}
+}
+
+// bez replay-a (npr. postoji snapshot) writer ne sme da odsece ostecen kraj
+func TestWriterDoesNotTruncate(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, 0, 2)
+	last := filepath.Join(dir, "wal_segment_0.log")
+	appendGarbage(t, last)
+	size := fileSize(t, last)
+
+	writeRecords(t, dir, 2, 1)
+	if fileSize(t, last) != size {
+		t.Fatal("writer je odsekao ostecen kraj bez replay-a")
+	}
+	if len(segmentPaths(t, dir)) != 2 {
+		t.Fatalf("ocekivan novi segment, ima %v", segmentPaths(t, dir))
+	}
+
+	// provera bez vracanja zapisa odseca kraj prema modu
+	if _, err := ReplayWAL(blockmanager.NewBlockManager(1, 16), dir, RecoveryPointInTime, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fileSize(t, last) >= size {
+		t.Fatal("provera WAL-a nije odsekla ostecen kraj")
+	}
+}
+
+// segment iz stare verzije baze se vraca i u tolerate_corrupted_tail modu, nikad se ne odseca
+func TestReplayKeepsLegacySegment(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wal_segment_1.log")
+	writeLegacySegment(t, path, []Record{
+		{Seq: 1, Key: []byte("a"), Value: []byte("1")},
+		{Seq: 2, Key: []byte("b"), Value: []byte("2")},
+	}, blockmanager.NewBlockManager(1, 16))
+	size := fileSize(t, path)
+
+	keys, report, err := replay(dir, RecoveryTolerateCorruptedTail)
+	if err != nil || len(keys) != 2 || report.Corruption != nil {
+		t.Fatalf("vraceno %d zapisa, ostecenje %v, greska %v", len(keys), report.Corruption, err)
+	}
+	if fileSize(t, path) != size {
+		t.Fatal("stari segment je odsecen")
+	}
+
+	// ostecen stari segment je greska, a segment ostaje kakav je bio
+	flipByte(t, path)
+	if _, _, err := replay(dir, RecoveryTolerateCorruptedTail); err == nil {
+		t.Fatal("ocekivana greska za ostecen stari segment")
+	}
+	if fileSize(t, path) != size {
+		t.Fatal("ostecen stari segment je odsecen")
+	}
+}
+
+// segmenti se vracaju po rednom broju, a ne po imenu (wal_segment_10 posle wal_segment_9)
+func TestReplayInNumericSegmentOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, 0, 40)
+	if n := len(segmentPaths(t, dir)); n <= 10 {
+		t.Fatalf("ocekivano vise od 10 segmenata, ima ih %d", n)
+	}
+
+	keys, _, err := replay(dir, RecoveryAbsoluteConsistency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 40 {
+		t.Fatalf("vraceno %d zapisa, ocekivano 40", len(keys))
+	}
+	for i, key := range keys {
+		if key != fmt.Sprintf("k%d", i) {
+			t.Fatalf("zapis %d je %s, redosled segmenata nije numericki: %v", i, key, keys)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// BlockManager.WriteBlock ne radi fsync, pa zapis moze da ostane samo u kesu operativnog sistema
+// Kada se radi fsync WAL segmenta odredjuje wal_sync_mode:
+//
+// always - zapis je fsync-ovan pre nego sto Put/Delete vrati odgovor; pisci koji stignu dok fsync traje
+//          dele sledeci fsync (vidi groupSyncer)
+// group  - zapisi vise pisaca se skupljaju u grupu i za celu grupu se radi jedan fsync,
+//          na svakih GroupInterval ili cim grupa predje GroupBytes bajtova
+//          pisac ceka dok se njegova grupa ne fsync-uje
+// none   - fsync se ne radi (brze, ali zapisi mogu da se izgube pri nestanku struje)
+
+const (
+	SyncAlways = "always"
+	SyncGroup  = "group"
+	SyncNone   = "none"
+
+	defaultGroupInterval = 5 * time.Millisecond
+	defaultGroupBytes    = 64 * 1024
+)
+
+// SyncOptions su podesavanja fsync-a za Writer
+type SyncOptions struct {
+	Mode          string
+	GroupInterval time.Duration // posle koliko vremena se radi fsync grupe
+	GroupBytes    int64         // posle koliko bajtova se radi fsync grupe
+}
+
+func (o SyncOptions) normalize() (SyncOptions, error) {
+	switch o.Mode {
+	case "":
+		o.Mode = SyncAlways
+	case SyncAlways, SyncGroup, SyncNone:
+	default:
+		return o, fmt.Errorf("nepoznat wal_sync_mode: %s", o.Mode)
+	}
+	if o.GroupInterval <= 0 {
+		o.GroupInterval = defaultGroupInterval
+	}
+	if o.GroupBytes <= 0 {
+		o.GroupBytes = defaultGroupBytes
+	}
+	return o, nil
+}
+
+// SyncStats je statistika fsync-ova, prikazuje se u STATS komandi
+type SyncStats struct {
+	Mode          string
+	Fsyncs        uint64 // ukupan broj fsync-ova
+	SyncedRecords uint64 // broj zapisa pokrivenih fsync-ovima
+	LastGroup     uint64 // broj zapisa u poslednjoj grupi
+	MaxGroup      uint64 // najveca grupa
+}
+
+// AvgGroup vraca prosecan broj zapisa po fsync-u
+func (s SyncStats) AvgGroup() float64 {
+	if s.Fsyncs == 0 {
+		return 0
+	}
+	return float64(s.SyncedRecords) / float64(s.Fsyncs)
+}
+
+// stanje fsync-a, sva polja se koriste samo dok se drzi Writer.mu
+//
+// Pisci cekaju fsync van svojih zakljucavanja (vidi Append i WaitSynced), kao red pisaca u LevelDB-u:
+// prvi pisac koji ceka, a fsync nije u toku, postaje vodja i radi jedan fsync za sve do tada upisane zapise,
+// ukljucujuci zapise pisaca koji cekaju iza njega (pratioci); fsync ide bez w.mu, pa za to vreme novi zapisi
+// mogu da se dopisuju i cine sledecu grupu
+type groupSyncer struct {
+	cond         *sync.Cond
+	dirty        map[string]bool // segmenti u kojima ima zapisa bez fsync-a
+	written      uint64          // redni broj poslednjeg upisanog zapisa
+	synced       uint64          // do kog zapisa je uradjen fsync
+	failed       uint64          // do kog zapisa je fsync pukao
+	err          error           // greska poslednjeg neuspelog fsync-a
+	pendingBytes int64
+	syncing      bool // vodja trenutno radi fsync
+	timerArmed   bool
+	stats        SyncStats
+}
+
+func (g *groupSyncer) init(mu *sync.Mutex) {
+	g.cond = sync.NewCond(mu)
+	g.dirty = make(map[string]bool)
+}
+
+// poziva se posle upisa zapisa, dok se drzi w.mu; vraca poziciju zapisa za WaitSynced
+func (g *groupSyncer) appended(w *Writer, size int64) uint64 {
+	g.written++
+	g.pendingBytes += size
+	g.dirty[w.currentSegmentPath] = true
+	return g.written
+}
+
+// WaitSynced ceka da zapis na poziciji pos bude fsync-ovan, prema wal_sync_mode
+// ako je forceSync true, ceka se fsync bez obzira na mod
+func (w *Writer) WaitSynced(pos uint64, forceSync bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.syncer.wait(w, pos, forceSync)
+}
+
+func (g *groupSyncer) wait(w *Writer, pos uint64, forceSync bool) error {
+	if w.options.Mode == SyncNone && !forceSync {
+		return nil
+	}
+
+	for g.synced < pos {
+		if g.failed >= pos {
+			return g.err
+		}
+		// fsync je u toku (mozda ne pokriva nas zapis), cekamo da vodja zavrsi
+		if g.syncing {
+			g.cond.Wait()
+			continue
+		}
+		// group - dok grupa nije dovoljno velika, fsync radi tajmer, a pisci cekaju da se grupa skupi
+		if w.options.Mode == SyncGroup && !forceSync && g.pendingBytes < w.options.GroupBytes {
+			if !g.timerArmed {
+				g.timerArmed = true
+				time.AfterFunc(w.options.GroupInterval, func() {
+					w.mu.Lock()
+					defer w.mu.Unlock()
+					g.timerArmed = false
+					g.syncLocked(w)
+				})
+			}
+			g.cond.Wait()
+			continue
+		}
+		// ovaj pisac je vodja: fsync za sve upisane zapise
+		g.syncLocked(w)
+	}
+	return nil
+}
+
+// radi fsync svih segmenata sa nesinhronizovanim zapisima i budi pisce koji cekaju
+// poziva se pod w.mu, a sam fsync ide bez njega; ako je fsync vec u toku, ne radi nista
+func (g *groupSyncer) syncLocked(w *Writer) error {
+	if g.syncing || g.synced == g.written {
+		return nil
+	}
+
+	g.syncing = true
+	target := g.written
+	dirty := g.dirty
+	g.dirty = make(map[string]bool)
+	g.pendingBytes = 0
+
+	w.mu.Unlock()
+	var err error
+	for path := range dirty {
+		// segment je mozda vec obrisan posle flush-a Memtable, tada nema sta da se sinhronizuje
+		if syncErr := w.blockManager.SyncFile(path); syncErr != nil && !os.IsNotExist(syncErr) {
+			err = fmt.Errorf("ne mogu da uradim fsync WAL segmenta %s: %v", path, syncErr)
+			break
+		}
+	}
+	w.mu.Lock()
+	g.syncing = false
+
+	if err != nil {
+		// segmenti ostaju prljavi, sledeci fsync pokusava ponovo
+		for path := range dirty {
+			g.dirty[path] = true
+		}
+		g.failed = target
+		g.err = err
+		g.cond.Broadcast()
+		return err
+	}
+
+	group := target - g.synced
+	g.stats.Fsyncs++
+	g.stats.SyncedRecords += group
+	g.stats.LastGroup = group
+	if group > g.stats.MaxGroup {
+		g.stats.MaxGroup = group
+	}
+
+	g.synced = target
+	g.cond.Broadcast()
+	return nil
+}
+
+// SyncStats vraca statistiku fsync-ova WAL-a
+func (w *Writer) SyncStats() SyncStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.syncer.stats
+	stats.Mode = w.options.Mode
+	return stats
+}
+
+// Sync radi fsync svih zapisa koji jos nisu sinhronizovani
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.syncer.wait(w, w.syncer.written, true)
+}
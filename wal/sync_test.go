@@ -0,0 +1,94 @@
+package wal
+
+import (
+	"fmt"
+	"napredni/blockmanager"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSyncWriter(t *testing.T, options SyncOptions) *Writer {
+	t.Helper()
+	w, err := NewWriter(t.TempDir(), 1<<20, blockmanager.NewBlockManager(4, 16), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func writeConcurrently(t *testing.T, w *Writer, writers, records int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < records; i++ {
+				rec := Record{Key: []byte(fmt.Sprintf("g%d-%d", g, i)), Value: []byte("v")}
+				if err := w.Write(rec, false); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestSyncNoneSkipsFsync(t *testing.T) {
+	w := newSyncWriter(t, SyncOptions{Mode: SyncNone})
+	writeConcurrently(t, w, 4, 10)
+	if stats := w.SyncStats(); stats.Fsyncs != 0 {
+		t.Fatalf("none ne sme da radi fsync: %+v", stats)
+	}
+
+	// Sync i zapis sa forceSync rade fsync i u none modu
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(Record{Key: []byte("k")}, true); err != nil {
+		t.Fatal(err)
+	}
+	if stats := w.SyncStats(); stats.Fsyncs != 2 || stats.SyncedRecords != 41 {
+		t.Fatalf("neocekivana statistika: %+v", stats)
+	}
+}
+
+func TestSyncAlwaysCoversEveryRecord(t *testing.T) {
+	w := newSyncWriter(t, SyncOptions{Mode: SyncAlways})
+	for i := 0; i < 5; i++ {
+		if err := w.Write(Record{Key: []byte(fmt.Sprint(i))}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := w.SyncStats(); stats.Fsyncs != 5 || stats.SyncedRecords != 5 {
+		t.Fatalf("svaki zapis treba svoj fsync kada nema drugih pisaca: %+v", stats)
+	}
+
+	writeConcurrently(t, w, 8, 20)
+	if stats := w.SyncStats(); stats.SyncedRecords != 165 || stats.Fsyncs > 165 {
+		t.Fatalf("neocekivana statistika: %+v", stats)
+	}
+}
+
+// group - pisci dele fsync, a grupa se zatvara po vremenu ili po velicini
+func TestSyncGroupBatchesWriters(t *testing.T) {
+	w := newSyncWriter(t, SyncOptions{Mode: SyncGroup, GroupInterval: 20 * time.Millisecond, GroupBytes: 1 << 20})
+	writeConcurrently(t, w, 16, 10)
+	stats := w.SyncStats()
+	if stats.SyncedRecords != 160 || stats.MaxGroup < 2 || stats.Fsyncs >= 160 {
+		t.Fatalf("pisci ne dele fsync: %+v", stats)
+	}
+}
+
+func TestSyncGroupBytesClosesGroup(t *testing.T) {
+	w := newSyncWriter(t, SyncOptions{Mode: SyncGroup, GroupInterval: time.Hour, GroupBytes: 1})
+	// tajmer se nikad ne okida, pa bi bez fsync-a po velicini Write cekao zauvek
+	if err := w.Write(Record{Key: []byte("k"), Value: []byte("v")}, false); err != nil {
+		t.Fatal(err)
+	}
+	if stats := w.SyncStats(); stats.Fsyncs != 1 {
+		t.Fatalf("neocekivana statistika: %+v", stats)
+	}
+}
@@ -7,63 +7,170 @@ import (
 	"hash/crc32"
 	"io"
 	"napredni/blockmanager"
-	"napredni/memtable"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // U sustini WAL je obican fajl u kojem su informacije BINARNOG formata!
 
+// Format WAL segmenta (kao log format kod LevelDB-a)
+// Segment je podeljen na blokove, ali zapisi se pisu jedan za drugim, bez praznog prostora izmedju
+// Zapis koji ne stane do kraja bloka se deli na fragmente, a svaki fragment ima svoje zaglavlje:
+//
+// | CRC(4) | LEN(4) | TYPE(1) | DATA |
+//
+// CRC se racuna nad TYPE|DATA, LEN je duzina DATA
+// TYPE: FULL (ceo zapis), FIRST, MIDDLE, LAST (delovi zapisa koji prelazi granicu bloka)
+// Ako do kraja bloka ostane manje od zaglavlja, ostatak bloka ostaje popunjen nulama
+//
+// Segment pocinje zaglavljem MAGIC(4)|VERZIJA(4), pa se segment iz druge verzije baze prepoznaje umesto da se proglasi ostecenim
+// Segment bez zaglavlja je iz stare verzije baze (jedan zapis po bloku, CRC|TIMESTAMP|TOMBSTONE|KEYSIZE|VALUESIZE|KEY|VALUE),
+// takav segment se cita starim formatom i nikad se ne dopisuje; njegov TIMESTAMP (UnixNano) raste kao i redni broj upisa pa se cita kao SEQ
+
+const (
+	fragmentHeaderSize  = 9
+	defaultSegmentBytes = 1 << 20 // ako u konfiguraciji nije zadata velicina segmenta
+
+	segmentMagic      = "WALS"
+	segmentHeaderSize = 8
+	// SegmentFormatVersion je verzija formata segmenta koju pise i cita ova verzija baze
+	SegmentFormatVersion = 1
+)
+
+// ErrUnsupportedFormat se vraca za segment ciji format ova verzija baze ne cita (segment iz novije verzije)
+var ErrUnsupportedFormat = errors.New("WAL segment je u formatu koji ova verzija baze ne cita")
+
 // WAL zapis
-// CRC|TIMESTAMP|TOMBSTONE|KEYSIZE|VALUESIZE|KEY|VALUE
-// crc se svaki put racuna zato nije deo struct-a
+// SEQ|TOMBSTONE|KEYSIZE|VALUESIZE|KEY|VALUE
+// crc je u zaglavlju svakog fragmenta zato nije deo struct-a
+// SEQ je globalni redni broj upisa koji dodeljuje Engine, isti broj ide dalje u Memtable i SSTable
 type Record struct {
-	Timestamp uint64
+	Seq       uint64
 	Tombstone bool
 	Key       []byte
 	Value     []byte
+	Timestamp int64 // vreme upisa (UnixNano), 0 - nepoznato (zapisi iz starijih verzija)
+	ExpiresAt int64 // vreme isteka (UnixNano), 0 - kljuc ne istice
+
+	// brisanje opsega [Key, Value), prazan Value - bez gornje granice
+	RangeDelete bool
+
+	// zapisi grupnog upisa (vidi NewBatchRecord); Key i Value su tada prazni, a Seq je najveci Seq u grupi
+	Batch []Record
+}
+
+// bitovi u bajtu Tombstone (stari zapisi imaju samo 0 ili 1)
+const (
+	recordTombstone    = 1 << 0
+	recordHasTimestamp = 1 << 1 // posle vrednosti ide jos 8 bajtova vremena upisa
+	recordBatch        = 1 << 2 // vrednost je niz zapisa grupnog upisa
+	recordHasExpiry    = 1 << 3 // posle vremena upisa (ako ga ima) ide jos 8 bajtova vremena isteka
+	recordRangeDelete  = 1 << 4 // brisanje opsega, Key je pocetak, a Value kraj opsega
+)
+
+// NewBatchRecord pakuje zapise grupnog upisa u jedan WAL zapis
+// zapis ima jedan CRC po fragmentu i cita se ceo ili nikako, pa se pri replay-u vracaju svi zapisi grupe ili nijedan
+func NewBatchRecord(records []Record) Record {
+	batch := Record{Batch: records}
+	for _, rec := range records {
+		if rec.Seq > batch.Seq {
+			batch.Seq = rec.Seq
+		}
+	}
+	return batch
+}
+
+// vrednost grupnog zapisa: za svaki zapis DUZINA(uvarint)|ZAPIS (kao EncodeRecord)
+func encodeBatch(records []Record) []byte {
+	var buf []byte
+	for _, rec := range records {
+		data := EncodeRecord(rec)
+		buf = binary.AppendUvarint(buf, uint64(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+func decodeBatch(data []byte) ([]Record, error) {
+	var records []Record
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			return nil, fmt.Errorf("ostecen grupni zapis")
+		}
+		rec, err := DecodeRecord(data[n : n+int(size)])
+		if err != nil {
+			return nil, fmt.Errorf("ostecen zapis u grupi: %v", err)
+		}
+		records = append(records, rec)
+		data = data[n+int(size):]
+	}
+	return records, nil
 }
 
 // Writer struktura za segmentaciju
 // Preko Writer-a mi pozivamo funkcije za zpis i ucitavanje Record-a
 type Writer struct {
-	dirPath     string // folder u kojem cuvamo fajlove
-	segmentSize int    // maksimalan broj zapisa po segmentu
+	dirPath      string // folder u kojem cuvamo fajlove
+	segmentBytes int64  // maksimalna velicina segmenta u bajtovima
 	//currentFile   *os.File // trenutni otvoren fajl
-	currentIndex       int // broj trenutnog segmenta
-	recordsInFile      int // koliko zapisa ima u trenutnom fajlu
+	currentIndex       int    // broj trenutnog segmenta
+	offset             int64  // do kog bajta je popunjen trenutni segment
+	tail               []byte // sadrzaj poslednjeg, nepopunjenog bloka segmenta
 	blockManager       *blockmanager.BlockManager
 	currentSegmentPath string
+
+	mu      sync.Mutex
+	syncer  groupSyncer // stanje za fsync (vidi sync.go)
+	options SyncOptions
 }
 
-// Put zapis u fajl
-func WriteRecord(bm *blockmanager.BlockManager, segmentPath string, blockNum int64, record Record) error {
+// EncodeRecord pretvara zapis u niz bajtova
+func EncodeRecord(record Record) []byte {
+	// grupni zapis: zapisi grupe idu kao vrednost
+	if len(record.Batch) > 0 {
+		record.Key, record.Value, record.Tombstone = nil, encodeBatch(record.Batch), false
+	}
+
 	// Priprema svih delova za binarno upisivanje
 	// Od []byte za Key i Value, mi dobijamo njihovu duzinu
 	keySize := uint64(len(record.Key))
 	valueSize := uint64(len(record.Value))
 
 	// Kreiramo byte slice gde cemo sve podatke da upisemo pre nego ih pisemo u fajl
-	buf := make([]byte, 0)
+	buf := make([]byte, 0, 25+len(record.Key)+len(record.Value)+16)
 
 	// Encode sve podatke u binarni oblik
 	// Preko tmp cemo da podatke iz njihovih tipova bilo int, bool i slicno da pretvorimo u niz bajtova
-	tmp := make([]byte, 8) // privremeni buffer za svako polje // odmah inicijalizovan na duzinu 8 jer prva informacija koju upisujemo je Timestamp(8 bajtova)
+	tmp := make([]byte, 8) // privremeni buffer za svako polje // odmah inicijalizovan na duzinu 8 jer prva informacija koju upisujemo je Seq(8 bajtova)
 
-	// Timestamp
-	binary.LittleEndian.PutUint64(tmp, record.Timestamp) // binary.LittleEndian.PutTIP(tmp, Timestamp) - znaci da mi podatak Timestamp iz uint64 pretvaramo u niz bajtova i dodajemo u nas slice tmp
+	// Seq
+	binary.LittleEndian.PutUint64(tmp, record.Seq) // binary.LittleEndian.PutTIP(tmp, Seq) - znaci da mi podatak Seq iz uint64 pretvaramo u niz bajtova i dodajemo u nas slice tmp
 	// LittleEndian - Little Endian je nacin kako se bajtovi rasporedjuju u memoriji. Kada je vrednost tipa uint64 (koja se sastoji od 8 bajtova), u Little Endian formatu najniži bajt (najmanje značajan) dolazi prvi, a najviši bajt poslednji.
 	buf = append(buf, tmp...) // ... unpacking ili sirenje slice-a, sirimo buf slice, tako sto dodajemo pojedinacno el iz tmp slice, da nema ... bilo bi da el iz tmp ubacujemo u buf kao jedan veliki el
 
-	// Tombstone (bool kao 1 bajt)
+	// Tombstone (bool kao 1 bajt), u istom bajtu je i oznaka da zapis ima vreme upisa
+	var flags byte
 	if record.Tombstone { // provera da li record koji upisujemo ima polje Tombstone na true, tj da li je taj record logicki obrisan
-		buf = append(buf, byte(1))
-	} else {
-		buf = append(buf, byte(0))
+		flags |= recordTombstone
+	}
+	if record.Timestamp != 0 {
+		flags |= recordHasTimestamp
+	}
+	if len(record.Batch) > 0 {
+		flags |= recordBatch
 	}
+	if record.ExpiresAt != 0 {
+		flags |= recordHasExpiry
+	}
+	if record.RangeDelete {
+		flags |= recordRangeDelete
+	}
+	buf = append(buf, flags)
 
 	// KeySize
 	binary.LittleEndian.PutUint64(tmp, keySize) // isto sve za keySize, na pocetku je uzeta duzina []byte kljuca, dobio se int, koji sada preko binary.LittleEndian mi pretvaramo u niz bajtova zapisujemo u tmp
@@ -79,135 +186,300 @@ func WriteRecord(bm *blockmanager.BlockManager, segmentPath string, blockNum int
 	// Value
 	buf = append(buf, record.Value...) // isto kao kod kljuca
 
-	// Racunanje CRC32 (kontrola gresaka)
-	crc := crc32.ChecksumIEEE(buf)
+	// Timestamp, samo ako postoji
+	if record.Timestamp != 0 {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(record.Timestamp))
+	}
+	// vreme isteka, samo ako postoji
+	if record.ExpiresAt != 0 {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(record.ExpiresAt))
+	}
+
+	return buf
+}
+
+// DecodeRecord pravi zapis iz niza bajtova (obrnuto od EncodeRecord)
+func DecodeRecord(data []byte) (Record, error) {
+	/* vizuelna slika jednog zapisa (posle spajanja fragmenata)
+	[0   - 7]      : Seq
+	[8   - 8]      : Tombstone (bit 0) i da li postoji Timestamp (bit 1)
+	[9   - 16]     : Key Size
+	[17  - 24]     : Value Size
+	[25  - 25+keySize-1]: Key
+	[25+keySize - 25+keySize+valueSize-1]: Value
+	[sledecih 8]   : Timestamp, samo ako je bit 1 postavljen
+	[sledecih 8]   : ExpiresAt, samo ako je bit 3 postavljen
+	bit 2 - grupni zapis, Value su zapisi grupe (vidi encodeBatch)
+	bit 4 - brisanje opsega [Key, Value)
+	*/
+	if len(data) < 25 { // Seq 8 bajta, Tombstone 1 bajt, KeySize i ValueSize po 8 = 25, a kljuc i vr onda jos vise
+		return Record{}, fmt.Errorf("zapis je premali da bi bio validan")
+	}
+
+	// sad umesto binary.LE.PUTTIP, nema to PUT neko samo TIP ovo je obrnuto nego kod pisanja, mi sada citamo niz bajtova, ali ih pretvaramo u odredjeni tip
+	seq := binary.LittleEndian.Uint64(data[0:8])
+	tombstone := data[8]&recordTombstone != 0
+	keySize := binary.LittleEndian.Uint64(data[9:17])
+	valueSize := binary.LittleEndian.Uint64(data[17:25])
 
-	// Na pocetak dodajemo CRC(4 bajta)
-	// Napravili smo full slice, i full ce upravo biti citav slice podataka koji zapisujemo u fajl, tj u blok, ali o tome kasnije...
-	// Najpre se zapisuje CRC pa tek onda ostalo
-	full := make([]byte, 4)
-	binary.LittleEndian.PutUint32(full, crc)
-	full = append(full, buf...)
+	if uint64(len(data)-25) < keySize || uint64(len(data)-25)-keySize < valueSize {
+		return Record{}, fmt.Errorf("zapis ne sadrži dovoljno podataka za key+value")
+	}
 
-	// Kreira se novi block, koji se onda zapisuje
-	blockID := blockmanager.BlockID{Path: segmentPath, Num: blockNum}
-	return bm.WriteBlock(blockID, full)
+	end := 25 + keySize + valueSize
+	var timestamp int64
+	if data[8]&recordHasTimestamp != 0 {
+		if uint64(len(data)) < end+8 {
+			return Record{}, fmt.Errorf("zapis ne sadrži vreme upisa")
+		}
+		timestamp = int64(binary.LittleEndian.Uint64(data[end : end+8]))
+	}
+	var expiresAt int64
+	if data[8]&recordHasExpiry != 0 {
+		at := end
+		if data[8]&recordHasTimestamp != 0 {
+			at += 8
+		}
+		if uint64(len(data)) < at+8 {
+			return Record{}, fmt.Errorf("zapis ne sadrži vreme isteka")
+		}
+		expiresAt = int64(binary.LittleEndian.Uint64(data[at : at+8]))
+	}
 
+	rec := Record{
+		Seq:       seq,
+		Tombstone: tombstone,
+		Key:       data[25 : 25+keySize],
+		Value:     data[25+keySize : end],
+		Timestamp: timestamp,
+		ExpiresAt: expiresAt,
+	}
+	rec.RangeDelete = data[8]&recordRangeDelete != 0
+	if data[8]&recordBatch != 0 {
+		batch, err := decodeBatch(rec.Value)
+		if err != nil {
+			return Record{}, err
+		}
+		rec.Value, rec.Batch = nil, batch
+	}
+	return rec, nil
 }
 
 // Funkcija cita sve Record-e
+// vraca gresku na prvom ostecenom zapisu
 func ReadAllRecords(bm *blockmanager.BlockManager, segmentPath string) ([]Record, error) {
-	var records []Record // vracamo niz Record struct-ova
-	i := 0
-	for {
-		fmt.Printf(" Čitam blok broj: %d iz fajla: %s\n", i, segmentPath)
-
-		/* vizuelna slika jednog bloka, dakle on je 4kb, podaci koje upisujemo mozda ali i vrv nece biti tacno 4kb pa ostatak bloka popunjavamo 0
-		[0   - 3]      : CRC
-		[4   - 11]     : Timestamp
-		[12  - 12]     : Tombstone
-		[13  - 20]     : Key Size
-		[21  - 28]     : Value Size
-		[29  - 29+keySize-1]: Key
-		[29+keySize - 29+keySize+valueSize-1]: Value
-		[ostatak bloka]: NULE, 00 00 00 00 ...
-		*/
-
-		// kreira se novi block, koji se cita
-		blockID := blockmanager.BlockID{Path: segmentPath, Num: int64(i)}
-		// data [valid data][valid data][valid data]...[baj baj baj...][00 00 00 00 00....]
-		data, err := bm.ReadBlock(blockID)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return nil, fmt.Errorf("greska pri citanju bloka: %v", err)
+	records, _, corruption, err := scanSegment(bm, segmentPath, false)
+	if err != nil {
+		return nil, err
+	}
+	if corruption != nil {
+		return nil, corruption
+	}
+	return records, nil
+}
+
+// cita zaglavlje segmenta, legacy je true za segment iz stare verzije baze (bez zaglavlja)
+// prazan segment (ili segment ciji prvi blok nije stigao na disk) nije legacy
+func readSegmentHeader(bm *blockmanager.BlockManager, segmentPath string) (bool, error) {
+	data, err := bm.ReadBlock(blockmanager.BlockID{Path: segmentPath, Num: 0})
+	if err != nil {
+		if errors.Is(err, io.EOF) || os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("ne mogu da procitam zaglavlje segmenta: %v", err)
+	}
+	if len(data) >= segmentHeaderSize && string(data[0:4]) == segmentMagic {
+		version := binary.LittleEndian.Uint32(data[4:8])
+		if version != SegmentFormatVersion {
+			return false, fmt.Errorf("%w (format %d, podrzan je %d)", ErrUnsupportedFormat, version, SegmentFormatVersion)
 		}
+		return false, nil
+	}
+	return !isZero(data), nil
+}
 
-		// PROVERA: Ako je blok prazan — znači kraj validnih podataka
-		isEmpty := true
-		for _, b := range data {
-			if b != 0 {
-				isEmpty = false
-				break
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cita segment iz stare verzije baze: svaki zapis je u svom bloku, sa CRC-om na pocetku, prazni blokovi se preskacu
+func readLegacySegment(bm *blockmanager.BlockManager, segmentPath string) ([]Record, error) {
+	var records []Record
+	for blockNum := int64(0); ; blockNum++ {
+		data, err := bm.ReadBlock(blockmanager.BlockID{Path: segmentPath, Num: blockNum})
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
 			}
+			return nil, fmt.Errorf("greska pri citanju bloka %d: %v", blockNum, err)
 		}
-		if isEmpty {
-			i++
+		if isZero(data) {
 			continue
 		}
-
-		if len(data) < 29 { // zbog cega < 29 jer je CRC 4abjta, Timestamp 8 bajta, Tombston1 bajt, KeySize i ValueSize po 8 = 29, a kljuc i vr onda jos vise
-			return nil, fmt.Errorf("blok je premali da sadrži validan zapis")
+		if len(data) < 4 {
+			return nil, fmt.Errorf("blok %d je premali da sadrzi validan zapis", blockNum)
 		}
 
-		expectedCRC := binary.LittleEndian.Uint32(data[0:4]) // sad umesto binary.LE.PUTTIP, nema to PUT neko samo TIP ovo je obrnuto nego kod pisanja, mi sada citamo niz bajtova, ali ih pretvaramo u odredjeni tip, bilo int, bool, ili nesto drugo i stavljamo u promenljivu
-		header := data[4 : 4+25]                             // pravimo header koji zapravo sadrzi informacije od 4 bajta do 29 a to su nam Timestamp|Tombstone|KeySize|ValueSize|
-
-		// isto kao gore za CRC preko binary.LE.TIP mi iz niza bajtova dobijamo tip podatka, i cuvamo u promenljivu
-		timestamp := binary.LittleEndian.Uint64(header[0:8])
-		tombstone := header[8] == 1
-		keySize := binary.LittleEndian.Uint64(header[9:17])
-		valueSize := binary.LittleEndian.Uint64(header[17:25])
-
-		expectedTotal := 4 + 25 + keySize + valueSize
-		if uint64(len(data)) < expectedTotal {
-			return nil, fmt.Errorf("blok ne sadrži dovoljno podataka za key+value")
+		expectedCRC := binary.LittleEndian.Uint32(data[0:4])
+		record, err := DecodeRecord(data[4:])
+		if err != nil {
+			return nil, fmt.Errorf("neispravan zapis u bloku %d: %v", blockNum, err)
 		}
+		size := 25 + len(record.Key) + len(record.Value)
+		if crc32.ChecksumIEEE(data[4:4+size]) != expectedCRC {
+			return nil, fmt.Errorf("CRC ne odgovara u bloku %d - podatak mozda ostecen", blockNum)
+		}
+		record.Timestamp = int64(record.Seq) // stari TIMESTAMP je procitan kao SEQ
+		records = append(records, record)
+	}
+}
 
-		// citamo kljuc od 29 bajta pa do 29+velicina kljuca
-		key := data[29 : 29+keySize]
-		// isto za data
-		value := data[29+keySize : 29+keySize+valueSize]
-
-		// Rekonstruisanje crcData
-		crcData := make([]byte, 0, 8+1+8+8+keySize+valueSize)
-		tmp := make([]byte, 8)
+// CorruptionError opisuje mesto u segmentu gde je pronadjen ostecen ili nepotpun zapis
+type CorruptionError struct {
+	Segment string
+	Block   int64
+	Offset  int64 // pozicija u segmentu (u bajtovima)
+	Reason  string
+}
 
-		// ovde sada radimo isto kao sto smo i za Write, zbog cega?
-		// vracamo sve u binary podatke tj []byte, da bismo za taj Record mogli izracunati CRC
-		// ako se ocekivani CRC razlikuje od izracunatog to znaci da je podatak ili ostecen iz nekog razloga ili promenjen
+func (c *CorruptionError) Error() string {
+	return fmt.Sprintf("ostecen WAL zapis u %s, blok %d (bajt %d): %s", filepath.Base(c.Segment), c.Block, c.Offset, c.Reason)
+}
 
-		binary.LittleEndian.PutUint64(tmp, timestamp)
-		crcData = append(crcData, tmp...)
+// scanSegment cita zapise iz segmenta redom
+// vraca i poziciju (u bajtovima) kraja poslednjeg validnog zapisa i prvo ostecenje na koje je naisao
+// ako je skipCorrupted false, citanje staje na prvom ostecenju
+// ako je true, preskace se ostatak bloka sa ostecenjem (granice fragmenata posle njega nisu pouzdane) i nastavlja dalje
+// segment iz stare verzije baze se cita starim formatom; ostecenje u njemu je greska (nikad se ne odseca), a kraj je 0 jer se u njega ne dopisuje
+func scanSegment(bm *blockmanager.BlockManager, segmentPath string, skipCorrupted bool) ([]Record, int64, *CorruptionError, error) {
+	legacy, err := readSegmentHeader(bm, segmentPath)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if legacy {
+		records, err := readLegacySegment(bm, segmentPath)
+		return records, 0, nil, err
+	}
 
-		if tombstone {
-			crcData = append(crcData, byte(1))
-		} else {
-			crcData = append(crcData, byte(0))
+	var records []Record // vracamo niz Record struct-ova
+	var pending []byte   // delovi zapisa koji prelazi granicu bloka
+	inRecord := false
+	var end int64
+	var first *CorruptionError
+
+	blockSize := int64(bm.BlockSize())
+	// pamti prvo ostecenje i vraca true ako citanje treba da stane
+	corrupt := func(blockNum int64, pos int, reason string) bool {
+		if first == nil {
+			first = &CorruptionError{Segment: segmentPath, Block: blockNum, Offset: blockNum*blockSize + int64(pos), Reason: reason}
 		}
+		pending = nil
+		inRecord = false
+		return !skipCorrupted
+	}
 
-		binary.LittleEndian.PutUint64(tmp, keySize)
-		crcData = append(crcData, tmp...)
+	for blockNum := int64(0); ; blockNum++ {
+		data, err := bm.ReadBlock(blockmanager.BlockID{Path: segmentPath, Num: blockNum})
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, end, nil, fmt.Errorf("greska pri citanju bloka %d: %v", blockNum, err)
+		}
 
-		binary.LittleEndian.PutUint64(tmp, valueSize)
-		crcData = append(crcData, tmp...)
+		pos := 0
+		if blockNum == 0 {
+			pos = segmentHeaderSize
+		}
+		for pos+fragmentHeaderSize <= len(data) {
+			expectedCRC := binary.LittleEndian.Uint32(data[pos : pos+4])
+			length := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+			fragmentType := data[pos+8]
 
-		crcData = append(crcData, key...)
-		crcData = append(crcData, value...)
+			// nule - ostatak bloka je prazan
+			if expectedCRC == 0 && length == 0 && fragmentType == 0 {
+				break
+			}
+			if pos+fragmentHeaderSize+length > len(data) {
+				if corrupt(blockNum, pos, "fragment prelazi granicu bloka") {
+					return records, end, first, nil
+				}
+				break
+			}
 
-		calculatedCRC := crc32.ChecksumIEEE(crcData)
+			// ako se ocekivani CRC razlikuje od izracunatog to znaci da je podatak ili ostecen iz nekog razloga ili promenjen
+			fragment := data[pos+8 : pos+fragmentHeaderSize+length] // TYPE|DATA
+			if crc32.ChecksumIEEE(fragment) != expectedCRC {
+				if corrupt(blockNum, pos, "CRC ne odgovara") {
+					return records, end, first, nil
+				}
+				break
+			}
+			chunk := fragment[1:]
+			fragmentPos := pos
+			pos += fragmentHeaderSize + length
+
+			var complete []byte
+			switch {
+			case fragmentType == blockmanager.FragmentFull && !inRecord:
+				complete = chunk
+			case fragmentType == blockmanager.FragmentFirst && !inRecord:
+				pending = append(pending[:0], chunk...)
+				inRecord = true
+				continue
+			case fragmentType == blockmanager.FragmentMiddle && inRecord:
+				pending = append(pending, chunk...)
+				continue
+			case fragmentType == blockmanager.FragmentLast && inRecord:
+				complete = append(pending, chunk...)
+				pending = nil
+				inRecord = false
+			default:
+				// CRC je ispravan, pa su granice fragmenata pouzdane - samo odbacujemo ovaj fragment
+				if corrupt(blockNum, fragmentPos, fmt.Sprintf("neocekivan tip fragmenta %d", fragmentType)) {
+					return records, end, first, nil
+				}
+				continue
+			}
 
-		if calculatedCRC != expectedCRC {
-			return nil, fmt.Errorf("CRC ne odgovara - podatak mozda ostecen")
+			record, err := DecodeRecord(complete)
+			if err != nil {
+				if corrupt(blockNum, fragmentPos, err.Error()) {
+					return records, end, first, nil
+				}
+				continue
+			}
+			records = append(records, record)
+			end = blockNum*blockSize + int64(pos)
 		}
-
-		// niz Record-a koji vracamo samo popunimo jednim Record-om i i++ idemo dalje
-		records = append(records, Record{
-			Timestamp: timestamp,
-			Tombstone: tombstone,
-			Key:       key,
-			Value:     value,
-		})
-
-		i++ // sledeći blok
 	}
 
-	return records, nil
+	if inRecord {
+		// zapis je presecen na kraju segmenta (npr. pad usred upisa)
+		corrupt(end/blockSize, int(end%blockSize), "poslednji zapis u segmentu je nepotpun")
+	}
+	return records, end, first, nil
 }
 
 // Konstruktor za Writer
-func NewWriter(dirPath string, segmentSize int, bm *blockmanager.BlockManager) (*Writer, error) {
+// segmentBytes je maksimalna velicina jednog segmenta u bajtovima
+// options odredjuje kada se radi fsync segmenta (always, group ili none)
+func NewWriter(dirPath string, segmentBytes int, bm *blockmanager.BlockManager, options SyncOptions) (*Writer, error) {
+	if bm.BlockSize() <= segmentHeaderSize+fragmentHeaderSize {
+		return nil, fmt.Errorf("blok je premali za WAL zapis")
+	}
+	if segmentBytes <= 0 {
+		segmentBytes = defaultSegmentBytes
+	}
+	options, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
 
 	// Kreiraj folder ako ne postoji
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
@@ -218,51 +490,169 @@ func NewWriter(dirPath string, segmentSize int, bm *blockmanager.BlockManager) (
 	}
 
 	maxIndex := FindMaxSegmentIndex(dirPath)
-	var recordsInLast int
 	segmentPath := filepath.Join(dirPath, fmt.Sprintf("wal_segment_%d.log", maxIndex))
-	if maxIndex > 0 {
-		// izracunaj broj validnih zapisa u tom segmentu
-		//segmentPath := filepath.Join(dirPath, fmt.Sprintf("wal_segment_%d.log", maxIndex))
-		records, err := ReadAllRecords(bm, segmentPath)
+
+	w := &Writer{
+		dirPath:      dirPath,
+		segmentBytes: int64(segmentBytes),
+		currentIndex: maxIndex,
+		blockManager: bm,
+		options:      options,
+	}
+	w.currentSegmentPath = segmentPath
+	w.syncer.init(&w.mu)
+
+	legacy, err := readSegmentHeader(bm, segmentPath)
+	if err != nil {
+		return nil, fmt.Errorf("ne mogu da procitam poslednji segment: %w", err)
+	}
+	if legacy {
+		// segment iz stare verzije baze ostaje netaknut (cita se pri replay-u), novi zapisi idu u sledeci segment
+		w.SetCurrentIndex(maxIndex + 1)
+	} else if _, err := os.Stat(segmentPath); err == nil {
+		// nastavljamo pisanje odmah posle poslednjeg validnog zapisa u tom segmentu
+		// writer nikada ne odseca ostecenja: to radi ReplayWAL, i samo kada wal_recovery_mode to dozvoljava
+		// ako ostecenje ostane (skip_any_corrupted), novi zapisi idu u novi segment, inace bi zavrsili iza njega
+		_, end, corruption, err := scanSegment(bm, segmentPath, false)
 		if err != nil {
 			return nil, fmt.Errorf("ne mogu da procitam zapise iz poslednjeg segmenta: %v", err)
 		}
-		recordsInLast = len(records)
+		if corruption != nil {
+			fmt.Printf(" WAL segment %s ima ostecenje (%s), nastavljam u novom segmentu\n", filepath.Base(segmentPath), corruption.Reason)
+			w.currentIndex++
+			w.currentSegmentPath = filepath.Join(dirPath, fmt.Sprintf("wal_segment_%d.log", w.currentIndex))
+			return w, nil
+		}
+		w.offset = end
+
+		// ucitamo i dosadasnji sadrzaj poslednjeg bloka, jer se on ponovo upisuje ceo
+		blockSize := int64(bm.BlockSize())
+		if inBlock := end % blockSize; inBlock > 0 {
+			data, err := bm.ReadBlock(blockmanager.BlockID{Path: segmentPath, Num: end / blockSize})
+			if err != nil {
+				return nil, fmt.Errorf("ne mogu da procitam poslednji blok segmenta: %v", err)
+			}
+			w.tail = append([]byte(nil), data[:inBlock]...)
+		}
 	}
 
-	w := &Writer{
-		dirPath:       dirPath,
-		segmentSize:   segmentSize,
-		currentIndex:  maxIndex,
-		recordsInFile: recordsInLast,
-		blockManager:  bm,
-	}
-	w.currentSegmentPath = segmentPath
 	return w, nil
 }
 
 // Funkcija za upisivanje zapisa i rotaciju
 // Ispred reci func imamo (w *Writer) - ovo se naziva receiver - postavlja se pre naziva funkcije i oznacava koja struktura moze da poziva tu funkciju
-func (w *Writer) Write(record Record) error {
-	// Provera da li je predjen prag dozvoljenih parove kljuc-vr u wal-u
-	if w.recordsInFile >= w.segmentSize {
+// ako je forceSync true, zapis se fsync-uje pre povratka bez obzira na wal_sync_mode
+func (w *Writer) Write(record Record, forceSync bool) error {
+	pos, err := w.Append(record)
+	if err != nil {
+		return err
+	}
+	return w.WaitSynced(pos, forceSync)
+}
+
+// Append dopisuje zapis u segment bez cekanja fsync-a i vraca njegovu poziciju u WAL-u
+// pozivalac posle (van svojih zakljucavanja) poziva WaitSynced(pos), da bi vise pisaca delilo isti fsync
+func (w *Writer) Append(record Record) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Provera da li je segment dostigao maksimalnu velicinu u bajtovima
+	if w.offset >= w.segmentBytes {
 		// rotacija na novi fajl
-		w.currentIndex++
-		w.recordsInFile = 0
+		w.rotate()
 	}
 
 	segmentPath := fmt.Sprintf("%s/wal_segment_%d.log", w.dirPath, w.currentIndex) // printf je formatirani string, na mesta %s, i %d se ugradjuju prosledjene vrednosti respektivno
 	w.currentSegmentPath = segmentPath
 
-	blockNum := int64(w.recordsInFile)
+	data := EncodeRecord(record)
+	if err := w.appendFragments(data); err != nil {
+		return 0, err
+	}
+	return w.syncer.appended(w, int64(len(data))), nil
+}
 
-	// Funkcija WriteRecord od gore
-	err := WriteRecord(w.blockManager, segmentPath, blockNum, record)
-	if err != nil {
-		return err
+// Rotate zatvara trenutni segment i sledeci zapis ide u novi
+// koristi se kada Memtable postane read-only, da se njeni zapisi ne bi mesali sa zapisima nove Memtable
+func (w *Writer) Rotate() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rotate()
+}
+
+func (w *Writer) rotate() {
+	if w.offset == 0 {
+		return // trenutni segment je jos prazan
+	}
+	w.currentIndex++
+	w.offset = 0
+	w.tail = w.tail[:0]
+	w.currentSegmentPath = filepath.Join(w.dirPath, fmt.Sprintf("wal_segment_%d.log", w.currentIndex))
+}
+
+// dopisuje zapis na kraj segmenta, deleci ga na fragmente na granicama blokova
+func (w *Writer) appendFragments(data []byte) error {
+	blockSize := int64(w.blockManager.BlockSize())
+
+	// prvi zapis u segmentu upisuje i zaglavlje segmenta, u istom bloku
+	if w.offset == 0 {
+		w.tail = append(w.tail[:0], segmentMagic...)
+		w.tail = binary.LittleEndian.AppendUint32(w.tail, SegmentFormatVersion)
+		w.offset = segmentHeaderSize
 	}
 
-	w.recordsInFile++
+	for first := true; first || len(data) > 0; {
+		blockNum := w.offset / blockSize
+		left := blockSize - w.offset%blockSize
+
+		// do kraja bloka ne staje ni zaglavlje, ostatak bloka ostaje nule i prelazimo na sledeci
+		if left < fragmentHeaderSize {
+			w.offset += left
+			w.tail = w.tail[:0]
+			continue
+		}
+
+		chunk := data
+		if int64(len(chunk)) > left-fragmentHeaderSize {
+			chunk = chunk[:left-fragmentHeaderSize]
+		}
+		data = data[len(chunk):]
+		last := len(data) == 0
+
+		var fragmentType byte
+		switch {
+		case first && last:
+			fragmentType = blockmanager.FragmentFull
+		case first:
+			fragmentType = blockmanager.FragmentFirst
+		case last:
+			fragmentType = blockmanager.FragmentLast
+		default:
+			fragmentType = blockmanager.FragmentMiddle
+		}
+		first = false
+
+		header := make([]byte, fragmentHeaderSize)
+		binary.LittleEndian.PutUint32(header[4:8], uint32(len(chunk)))
+		header[8] = fragmentType
+		crc := crc32.Update(crc32.ChecksumIEEE(header[8:9]), crc32.IEEETable, chunk)
+		binary.LittleEndian.PutUint32(header[0:4], crc)
+
+		w.tail = append(w.tail, header...)
+		w.tail = append(w.tail, chunk...)
+
+		// poslednji blok se upisuje ponovo ceo, sa novim fragmentom na kraju
+		block := append([]byte(nil), w.tail...)
+		err := w.blockManager.WriteBlock(blockmanager.BlockID{Path: w.currentSegmentPath, Num: blockNum}, block)
+		if err != nil {
+			return err
+		}
+
+		w.offset += int64(fragmentHeaderSize + len(chunk))
+		if w.offset%blockSize == 0 {
+			w.tail = w.tail[:0]
+		}
+	}
 	return nil
 }
 
@@ -297,7 +687,7 @@ func LoadAllSegments(bm *blockmanager.BlockManager, dirPath string, recordsPerSe
 		// Umesto file open → citamo blokove
 		recs, err := ReadAllRecords(bm, path)
 		if err != nil {
-			return nil, fmt.Errorf("greska u fajlu %s: %v", fname, err)
+			return nil, fmt.Errorf("greska u fajlu %s: %w", fname, err)
 		}
 
 		records = append(records, recs...)
@@ -308,54 +698,81 @@ func LoadAllSegments(bm *blockmanager.BlockManager, dirPath string, recordsPerSe
 
 // Funkcija koja se poziva sa namerom da se iskoristi ono za sta je WAL i napravljen
 // Dakle ako bismo uradili par PUT operacija i nestane nam struje, ili mi samo uradimo EXIT da ugasimo bazu, a prethodno nismo sacuvali stanje ili nije izazvana flush ili nismo uradili SNAPSHOT, po pokretanju baze ponovo sve iz wal-a se ucitava u Memtable strukturu
-func ReplayWAL(bm *blockmanager.BlockManager, walDir string, mt memtable.MemtableInterface) error {
-	files, err := os.ReadDir(walDir)
+// mode je wal_recovery_mode i odredjuje sta se radi kada se naidje na ostecen zapis
+// apply se poziva za svaki zapis redom, zajedno sa segmentom iz kog je zapis procitan,
+// a pozivalac odlucuje u koju Memtable zapis ide
+// ako je apply nil, zapisi se samo proveravaju, a ostecenja se obradjuju isto kao pri pravom replay-u
+// grupni zapis (Batch) stize ceo u jednom pozivu; ako je ostecen, ne stize nijedan njegov deo
+func ReplayWAL(bm *blockmanager.BlockManager, walDir string, mode string, apply func(segmentPath string, rec Record) error) (RecoveryReport, error) {
+	mode, err := normalizeRecoveryMode(mode)
+	report := RecoveryReport{Mode: mode}
 	if err != nil {
-		return fmt.Errorf("ne mogu da procitam WAL direktorijum: %v", err)
+		return report, err
 	}
 
-	// trazimo sve fajlove sa nastavkom .log to su nasi wal segmenti
-	var logFiles []string
-	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".log") {
-			logFiles = append(logFiles, f.Name())
-		}
+	// segmenti se pustaju po rednom broju, a ne po imenu (wal_segment_10 je posle wal_segment_2)
+	segments, err := listSegments(walDir)
+	if err != nil {
+		return report, err
 	}
 
-	//  Sortiramo WAL fajlove po imenu
-	sort.Strings(logFiles)
-
-	for _, name := range logFiles {
-		fmt.Printf(" WAL segment za replay: %s\n", name)
-		path := filepath.Join(walDir, name)
+	for i, path := range segments {
+		fmt.Printf(" WAL segment za replay: %s\n", filepath.Base(path))
 
-		// readAllRecord funkcija od gore
-		records, err := ReadAllRecords(bm, path)
+		records, end, corruption, err := scanSegment(bm, path, mode == RecoverySkipAnyCorrupted)
 		if err != nil {
-			return fmt.Errorf("ne mogu da procitam WAL zapis iz %s: %v", path, err)
+			return report, fmt.Errorf("ne mogu da procitam WAL zapis iz %s: %w", path, err)
+		}
+		report.Segments++
+
+		if corruption != nil {
+			if report.Corruption == nil {
+				report.Corruption = corruption
+			}
+			switch {
+			case mode == RecoveryAbsoluteConsistency:
+				report.Stopped = true
+				return report, corruption
+			case mode == RecoveryTolerateCorruptedTail && (i != len(segments)-1 || hasRecordsAfter(bm, path, len(records))):
+				report.Stopped = true
+				return report, fmt.Errorf("ostecenje nije na kraju WAL-a: %v", corruption)
+			case mode == RecoverySkipAnyCorrupted:
+				report.Skipped++
+			}
+		}
+
+		if apply != nil {
+			for _, rec := range records {
+				if err := apply(path, rec); err != nil {
+					return report, fmt.Errorf("ne mogu da vratim WAL zapis iz %s: %v", path, err)
+				}
+			}
+			report.Records += len(records)
 		}
 
-		for _, rec := range records {
-			if rec.Tombstone {
-				mt.Delete(string(rec.Key))
-			} else {
-				// u Memtable unosimo kljuc i vrednost iz wal segmenata po ponovnom pokretanju baze
-				mt.Put(string(rec.Key), rec.Value)
+		// tolerate_corrupted_tail i point_in_time - sve posle ostecenja se odbacuje
+		if corruption != nil && mode != RecoverySkipAnyCorrupted {
+			report.Stopped = true
+			if err := discardAfter(bm, segments, i, end); err != nil {
+				return report, err
 			}
-			// Debug info:
-			fmt.Printf(" WAL unet u memtable: %s → %s\n", rec.Key, rec.Value)
+			break
 		}
 	}
-	return nil
+	return report, nil
 }
 
 // Vraca trenutni aktivni WAL segment i broj zapisa u njemu
 // Korisceno za kasnije CLI komande o stanju baze, nije preterano bitno
 func (w *Writer) StateInfo() (string, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return filepath.Base(w.currentSegmentPath), w.currentIndex
 }
 
 func (w *Writer) GetCurrentSegmentPath() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.currentSegmentPath
 }
 
@@ -368,21 +785,59 @@ func FindMaxSegmentIndex(dirPath string) int {
 
 	maxIndex := 0
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "wal_segment_") && strings.HasSuffix(file.Name(), ".log") {
-			base := strings.TrimSuffix(strings.TrimPrefix(file.Name(), "wal_segment_"), ".log")
-			n, err := strconv.Atoi(base)
-			if err == nil && n > maxIndex {
-				maxIndex = n
-			}
+		if n, ok := segmentIndex(file.Name()); ok && n > maxIndex {
+			maxIndex = n
 		}
 	}
 	return maxIndex
 }
 
+// vraca redni broj segmenta iz imena wal_segment_N.log
+func segmentIndex(name string) (int, bool) {
+	if !strings.HasPrefix(name, "wal_segment_") || !strings.HasSuffix(name, ".log") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "wal_segment_"), ".log"))
+	return n, err == nil
+}
+
+// vraca putanje svih WAL segmenata u folderu, sortirane po rednom broju
+func listSegments(dirPath string) ([]string, error) {
+	files, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("ne mogu da procitam WAL direktorijum: %v", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		if _, ok := segmentIndex(f.Name()); ok {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := segmentIndex(names[i])
+		b, _ := segmentIndex(names[j])
+		return a < b
+	})
+
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(dirPath, name)
+	}
+	return paths, nil
+}
+
 func (w *Writer) SetCurrentIndex(index int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.currentIndex = index
+	w.offset = 0
+	w.tail = w.tail[:0]
+	w.currentSegmentPath = filepath.Join(w.dirPath, fmt.Sprintf("wal_segment_%d.log", index))
 }
 
 func (w *Writer) GetCurrentIndex() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.currentIndex
 }
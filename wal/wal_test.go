@@ -0,0 +1,171 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"napredni/blockmanager"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sameRecords(t *testing.T, got, want []Record) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("procitano %d zapisa, ocekivano %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Seq != want[i].Seq || got[i].Timestamp != want[i].Timestamp || got[i].Tombstone != want[i].Tombstone ||
+			!bytes.Equal(got[i].Key, want[i].Key) || !bytes.Equal(got[i].Value, want[i].Value) {
+			t.Fatalf("zapis %d: procitan %q (%d bajtova), ocekivan %q (%d bajtova)", i, got[i].Key, len(got[i].Value), want[i].Key, len(want[i].Value))
+		}
+	}
+}
+
+// pravi segment u starom formatu: svaki zapis u svom bloku, CRC|TIMESTAMP|TOMBSTONE|KEYSIZE|VALUESIZE|KEY|VALUE
+func writeLegacySegment(t *testing.T, path string, records []Record, bm *blockmanager.BlockManager) {
+	t.Helper()
+	for i, r := range records {
+		data := EncodeRecord(r)
+		block := binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+		block = append(block, data...)
+		if err := bm.WriteBlock(blockmanager.BlockID{Path: path, Num: int64(i)}, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// zapis veci od bloka se deli na vise blokova i cita se ceo, a sledeci zapis pocinje posle njega
+func TestRecordSpansMultipleBlocks(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+	w, err := NewWriter(dir, 16*1024, bm, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []Record{
+		{Seq: 1, Key: []byte("a"), Value: []byte("mala")},
+		{Seq: 2, Key: []byte("b"), Value: bytes.Repeat([]byte("x"), 3*bm.BlockSize())},
+		{Seq: 3, Key: []byte("c"), Value: []byte("posle velike")},
+	}
+	for _, r := range records {
+		if err := w.Write(r, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := LoadAllSegments(bm, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameRecords(t, got, records)
+}
+
+// segment pocinje zaglavljem, a writer posle ponovnog otvaranja nastavlja u isti segment
+func TestSegmentHeaderAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+	records := []Record{
+		{Seq: 1, Key: []byte("a"), Value: []byte("1")},
+		{Seq: 2, Key: []byte("b"), Tombstone: true},
+	}
+
+	w, err := NewWriter(dir, 16*1024, bm, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(records[0], false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(w.GetCurrentSegmentPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[0:4]) != segmentMagic || binary.LittleEndian.Uint32(data[4:8]) != SegmentFormatVersion {
+		t.Fatalf("segment ne pocinje zaglavljem: % x", data[:8])
+	}
+
+	w, err = NewWriter(dir, 16*1024, bm, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(records[1], false); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.log")); len(files) != 1 {
+		t.Fatalf("posle ponovnog otvaranja writer je napravio novi segment: %v", files)
+	}
+
+	got, err := LoadAllSegments(bm, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameRecords(t, got, records)
+}
+
+// segment iz stare verzije baze (bez zaglavlja) se cita starim formatom i ostaje netaknut, novi zapisi idu u sledeci segment
+func TestLegacySegmentIsReadAndKept(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+	legacy := []Record{
+		{Seq: 10, Key: []byte("a"), Value: []byte("stara")},
+		{Seq: 11, Key: []byte("b"), Tombstone: true},
+	}
+	legacyPath := filepath.Join(dir, "wal_segment_1.log")
+	writeLegacySegment(t, legacyPath, legacy, bm)
+	// stari TIMESTAMP se cita i kao Seq i kao Timestamp
+	for i := range legacy {
+		legacy[i].Timestamp = int64(legacy[i].Seq)
+	}
+	before, err := os.ReadFile(legacyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bm = blockmanager.NewBlockManager(1, 16)
+	w, err := NewWriter(dir, 16*1024, bm, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := Record{Seq: 12, Key: []byte("c"), Value: []byte("nova")}
+	if err := w.Write(added, false); err != nil {
+		t.Fatal(err)
+	}
+	if w.GetCurrentIndex() != 2 {
+		t.Fatalf("novi zapis je upisan u segment %d, ocekivan je novi segment 2", w.GetCurrentIndex())
+	}
+
+	after, err := os.ReadFile(legacyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("stari segment je izmenjen")
+	}
+
+	got, err := LoadAllSegments(bm, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameRecords(t, got, append(legacy, added))
+}
+
+// segment iz novije verzije baze se ne cita
+func TestUnknownSegmentVersionIsRefused(t *testing.T) {
+	dir := t.TempDir()
+	bm := blockmanager.NewBlockManager(1, 16)
+	header := binary.LittleEndian.AppendUint32([]byte(segmentMagic), SegmentFormatVersion+1)
+	if err := os.WriteFile(filepath.Join(dir, "wal_segment_1.log"), header, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadAllSegments(bm, dir, 0); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("ocekivana greska ErrUnsupportedFormat, dobijeno %v", err)
+	}
+	if _, err := NewWriter(dir, 16*1024, bm, SyncOptions{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("ocekivana greska ErrUnsupportedFormat, dobijeno %v", err)
+	}
+}